@@ -0,0 +1,98 @@
+package ogg
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNotSingleStream is the error used when an operation requires an ogg stream
+// holding exactly one logical stream, but it is chained or multiplexed.
+var ErrNotSingleStream = errors.New("stream is chained or multiplexed")
+
+// ErrNoPages is the error used when an ogg stream has no pages at all.
+var ErrNoPages = errors.New("no pages in stream")
+
+// ErrUnfinishedPacket is the error used by OpenForAppend when a stream's last page
+// ends partway through a packet, which appended packets would corrupt.
+var ErrUnfinishedPacket = errors.New("last page ends with an unfinished packet")
+
+// OpenForAppend prepares to append to the single logical stream in rs.
+// It finds the stream's last page and, if that page is marked EOS,
+// clears the flag and rewrites its CRC in place.
+// The returned Encoder writes to rs just after the last page, continuing the
+// stream's serial and page sequence; its Granule method reports the last page's
+// granule position, from which the caller should continue.
+//
+// Chained or multiplexed streams can't be appended to this way,
+// so ErrNotSingleStream is returned for them, and neither can a stream whose last page
+// leaves a packet unfinished, for which the error is ErrUnfinishedPacket.
+func OpenForAppend(rs io.ReadWriteSeeker) (*Encoder, error) {
+	_, err := rs.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	d := NewDecoder(rs)
+	var last Page
+	var lastOffset, offset int64
+	var lastSize, pages int
+	for {
+		p, n, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		offset += int64(n)
+
+		if pages > 0 && (p.Serial != last.Serial || p.Type&BOS != 0) {
+			return nil, ErrNotSingleStream
+		}
+		pages++
+		last = p
+		lastSize = d.size
+		lastOffset = offset - int64(lastSize)
+	}
+	if pages == 0 {
+		return nil, ErrNoPages
+	}
+	if last.Unfinished {
+		return nil, ErrUnfinishedPacket
+	}
+
+	raw := make([]byte, lastSize)
+	_, err = rs.Seek(lastOffset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.ReadFull(rs, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if raw[5]&EOS != 0 {
+		raw[5] &^= EOS
+		byteOrder.PutUint32(raw[22:], 0)
+		byteOrder.PutUint32(raw[22:], crc32(raw))
+		_, err = rs.Seek(lastOffset, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+		_, err = rs.Write(raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = rs.Seek(lastOffset+int64(lastSize), io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	e := NewEncoder(last.Serial, rs)
+	e.SetSequence(byteOrder.Uint32(raw[18:]) + 1)
+	e.granule = last.Granule
+	e.open = true
+	return e, nil
+}
@@ -0,0 +1,146 @@
+package ogg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// memFile is an in-memory io.ReadWriteSeeker.
+type memFile struct {
+	b   []byte
+	off int64
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	if f.off >= int64(len(f.b)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.b[f.off:])
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	end := f.off + int64(len(p))
+	if end > int64(len(f.b)) {
+		f.b = append(f.b, make([]byte, end-int64(len(f.b)))...)
+	}
+	copy(f.b[f.off:], p)
+	f.off = end
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += int64(len(f.b))
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func TestOpenForAppend(t *testing.T) {
+	f := &memFile{}
+	e := NewEncoder(9, f)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.Encode(100, [][]byte{[]byte("a")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := e.EncodeEOS(200, [][]byte{[]byte("b")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	e, err := OpenForAppend(f)
+	if err != nil {
+		t.Fatal("unexpected OpenForAppend error:", err)
+	}
+	if e.Granule() != 200 {
+		t.Fatal("expected granule 200, got", e.Granule())
+	}
+	if err := e.EncodeEOS(e.Granule()+100, [][]byte{[]byte("c")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	d := NewDecoder(bytes.NewReader(f.b))
+	expect := []struct {
+		typ     byte
+		granule int64
+		data    string
+	}{
+		{BOS, 0, "head"},
+		{0, 100, "a"},
+		{0, 200, "b"},
+		{EOS, 300, "c"},
+	}
+	for i, x := range expect {
+		p, _, err := d.Decode()
+		if err != nil {
+			t.Fatalf("unexpected Decode error on page %d: %v", i, err)
+		}
+		if p.Type != x.typ || p.Granule != x.granule || p.Serial != 9 || string(p.Packets[0]) != x.data {
+			t.Fatalf("page %d = %+v", i, p)
+		}
+		if seq := byteOrder.Uint32(d.buf[18:]); seq != uint32(i) {
+			t.Fatalf("page %d has sequence number %d", i, seq)
+		}
+	}
+	if _, _, err := d.Decode(); err != io.EOF {
+		t.Fatal("expected EOF, got:", err)
+	}
+}
+
+func TestOpenForAppendChained(t *testing.T) {
+	f := &memFile{}
+	e := NewEncoder(1, f)
+	if err := e.EncodeBOS(0, nil); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.EncodeEOS(0, nil); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+	e = NewEncoder(2, f)
+	if err := e.EncodeBOS(0, nil); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+
+	_, err := OpenForAppend(f)
+	if err != ErrNotSingleStream {
+		t.Fatal("expected ErrNotSingleStream, got:", err)
+	}
+
+	_, err = OpenForAppend(&memFile{})
+	if err != ErrNoPages {
+		t.Fatal("expected ErrNoPages, got:", err)
+	}
+}
+
+func TestOpenForAppendUnfinished(t *testing.T) {
+	f := &memFile{}
+	e := NewEncoder(1, f)
+	if err := e.EncodeBOS(0, nil); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.Encode(1, [][]byte{make([]byte, mps)}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	// Keep the BOS page and the first page of the long packet.
+	f.b = f.b[:headsz+1+maxPageSize]
+	orig := append([]byte(nil), f.b...)
+
+	_, err := OpenForAppend(f)
+	if err != ErrUnfinishedPacket {
+		t.Fatal("expected ErrUnfinishedPacket, got:", err)
+	}
+	if !bytes.Equal(f.b, orig) {
+		t.Fatal("expected the stream to be left alone")
+	}
+}
@@ -0,0 +1,107 @@
+package ogg
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A BatchError maps the index of each stream that BatchDecode failed to decode to its error.
+type BatchError map[int]error
+
+func (e BatchError) Error() string {
+	idx := make([]int, 0, len(e))
+	for i := range e {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+
+	var b strings.Builder
+	b.WriteString("failed to decode ")
+	b.WriteString(strconv.Itoa(len(e)))
+	b.WriteString(" stream(s)")
+	for _, i := range idx {
+		b.WriteString("; ")
+		b.WriteString(strconv.Itoa(i))
+		b.WriteString(": ")
+		b.WriteString(e[i].Error())
+	}
+	return b.String()
+}
+
+// BatchDecode decodes each of readers to its end, with up to workers of them at a time,
+// calling fn with the index of the reader and each of its pages in order.
+// Decoding a reader stops at the first error from it or from fn;
+// the rest of the readers are still decoded.
+// If any fail, the returned error is a BatchError.
+//
+// fn is called concurrently for distinct readers. Its pages' packets are
+// copied out of the decoders' buffers, so fn may retain them.
+func BatchDecode(readers []io.Reader, workers int, fn func(int, Page) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	pool := sync.Pool{
+		New: func() interface{} {
+			d := NewDecoder(nil)
+			d.CopyPackets = true
+			return d
+		},
+	}
+
+	var mu sync.Mutex
+	errs := BatchError{}
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				d := pool.Get().(*Decoder)
+				d.Reset(readers[i])
+				err := decodeAll(d, func(p Page) error {
+					return fn(i, p)
+				})
+				d.Reset(nil)
+				pool.Put(d)
+
+				if err != nil {
+					mu.Lock()
+					errs[i] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := range readers {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// decodeAll calls fn with each page from d, until the end of the stream.
+func decodeAll(d *Decoder, fn func(Page) error) error {
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestBatchDecode(t *testing.T) {
+	const files = 20
+	var readers []io.Reader
+	for i := 0; i < files; i++ {
+		var b bytes.Buffer
+		e := NewEncoder(uint32(i), &b)
+		for j := 0; j <= i; j++ {
+			if err := e.Encode(int64(j), [][]byte{[]byte(strconv.Itoa(j))}); err != nil {
+				t.Fatal("unexpected Encode error:", err)
+			}
+		}
+		readers = append(readers, &b)
+	}
+	// One bad file among the good ones.
+	readers = append(readers, bytes.NewReader([]byte("OggS\x00\x00 this is not a page")))
+
+	var mu sync.Mutex
+	pages := make(map[int][]Page)
+	err := BatchDecode(readers, 4, func(i int, p Page) error {
+		mu.Lock()
+		pages[i] = append(pages[i], p)
+		mu.Unlock()
+		return nil
+	})
+
+	be, ok := err.(BatchError)
+	if !ok {
+		t.Fatal("expected BatchError, got:", err)
+	}
+	if len(be) != 1 || be[files] == nil {
+		t.Fatalf("expected only reader %d to fail, got: %v", files, be)
+	}
+
+	for i := 0; i < files; i++ {
+		if len(pages[i]) != i+1 {
+			t.Fatalf("reader %d: got %d pages, expected %d", i, len(pages[i]), i+1)
+		}
+		// The pages were retained, so their packets must not have been overwritten.
+		for j, p := range pages[i] {
+			if p.Serial != uint32(i) || string(p.Packets[0]) != strconv.Itoa(j) {
+				t.Fatalf("reader %d, page %d: unexpected page %+v", i, j, p)
+			}
+		}
+	}
+}
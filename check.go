@@ -0,0 +1,174 @@
+package ogg
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrSkippedBytes is the error CheckFile reports when bytes that aren't a page precede one.
+type ErrSkippedBytes struct {
+	N int
+}
+
+func (e ErrSkippedBytes) Error() string {
+	return strconv.Itoa(e.N) + " bytes of junk before page"
+}
+
+// A Report is the result of CheckFile.
+type Report struct {
+	// Level is the conformance level the pages were checked against.
+	Level Conformance
+	// Pages is the number of pages read, including corrupt ones.
+	Pages int
+	// Findings are the problems found, in the order of the stream.
+	Findings []Finding
+	// Streams are the logical streams, in the order of their first pages,
+	// with the findings of their pages and of their ends.
+	// A chain may repeat a serial number, in which case each link's stream is listed.
+	Streams []StreamReport
+	// Pass is set if there are no findings.
+	Pass bool
+}
+
+// A Finding is a problem CheckFile found, described by its error:
+// one of the check errors of the conformance level, such as ErrSequenceGap,
+// or ErrBadCrc, ErrBadSegs, ErrPageTooLarge, ErrSkippedBytes, io.ErrUnexpectedEOF for a truncated final page,
+// or ErrStreamBoundary for a logical stream without an EOS page.
+// ErrTruncatedFinalPacket, for a logical stream whose last packet is unfinished, is reported at the end of the stream.
+type Finding struct {
+	// Page is the index of the page the finding concerns, counting corrupt pages,
+	// or -1 if it concerns no page: a missing EOS page, a truncated packet, or trailing bytes.
+	Page int
+	// Offset is the offset in the stream of the page, or the end of the stream if it concerns no page,
+	// relative to the position CheckFile started reading.
+	Offset int64
+	// Stream is set if Serial is the serial number of the logical stream the finding concerns,
+	// which is unknown for pages that are corrupt.
+	Stream bool
+	Serial uint32
+	Err    error
+}
+
+// A StreamReport describes a logical stream as checked by CheckFile.
+type StreamReport struct {
+	Serial   uint32
+	Codec    Codec
+	Pages    int
+	EOS      bool
+	Findings []Finding
+}
+
+// CheckFile reads the whole of rs, checking every page against the checks of level and its CRC,
+// after which rs is returned to its original position.
+// Unlike Decode, it continues past the problems it finds, to report them all,
+// including every check a page fails, rather than the first.
+// The error is ErrNoPages if rs holds no pages, or any error reading rs.
+func CheckFile(rs io.ReadSeeker, level Conformance) (*Report, error) {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &Report{Level: level}
+	d := NewDecoder(rs)
+	d.Conformance = level
+	d.KeepRawPage = true
+	var offset int64
+	// the index into rep.Streams of each serial's current stream
+	current := make(map[uint32]int)
+	find := func(f Finding) {
+		rep.Findings = append(rep.Findings, f)
+		if i, ok := current[f.Serial]; ok && f.Stream {
+			rep.Streams[i].Findings = append(rep.Streams[i].Findings, f)
+		}
+	}
+
+	for {
+		p, n, err := d.decode(false)
+		if err == io.EOF {
+			break
+		}
+		if err == io.ErrUnexpectedEOF {
+			find(Finding{Page: -1, Offset: offset, Err: err})
+			offset += int64(n)
+			break
+		}
+		if err != nil && !corrupt(err) {
+			return nil, err
+		}
+		page := rep.Pages
+		rep.Pages++
+		if err != nil {
+			find(Finding{Page: page, Offset: offset, Err: err})
+			offset += int64(n)
+			continue
+		}
+		pos := offset + int64(n-p.Size)
+		offset += int64(n)
+
+		if p.Resynced {
+			find(Finding{Page: page, Offset: pos, Stream: true, Serial: p.Serial, Err: ErrSkippedBytes{n - p.Size}})
+		}
+		i, ok := current[p.Serial]
+		if !ok || p.Type&BOS != 0 {
+			var c Codec
+			if p.Type&BOS != 0 && len(p.Packets) > 0 {
+				c = IdentifyCodec(p.Packets[0])
+			}
+			i = len(rep.Streams)
+			current[p.Serial] = i
+			rep.Streams = append(rep.Streams, StreamReport{Serial: p.Serial, Codec: c})
+		}
+		s := &rep.Streams[i]
+		s.Pages++
+		s.EOS = s.EOS || p.Type&EOS != 0
+
+		h := parseHeader(p.Raw)
+		for _, err := range d.trackAll(&h, len(p.Packets)) {
+			find(Finding{Page: page, Offset: pos, Stream: true, Serial: p.Serial, Err: err})
+		}
+	}
+
+	for _, err := range d.truncated() {
+		find(Finding{Page: -1, Offset: offset, Stream: true, Serial: err.(ErrTruncatedFinalPacket).Serial, Err: err})
+	}
+
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if rep.Pages == 0 {
+		return nil, ErrNoPages
+	}
+	for i := range rep.Streams {
+		if s := &rep.Streams[i]; !s.EOS {
+			f := Finding{Page: -1, Offset: offset, Stream: true, Serial: s.Serial, Err: ErrStreamBoundary{s.Serial, "missing EOS page"}}
+			rep.Findings = append(rep.Findings, f)
+			s.Findings = append(s.Findings, f)
+		}
+	}
+	rep.Pass = len(rep.Findings) == 0
+	return rep, nil
+}
+
+// String formats r as a report, a line for each finding, and a summary.
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, f := range r.Findings {
+		b.WriteString("offset " + strconv.FormatInt(f.Offset, 10))
+		if f.Page >= 0 {
+			b.WriteString(", page " + strconv.Itoa(f.Page))
+		}
+		b.WriteString(": " + f.Err.Error() + "\n")
+	}
+	for _, s := range r.Streams {
+		b.WriteString("stream " + strconv.FormatUint(uint64(s.Serial), 10) + ": " + s.Codec.String() +
+			", " + strconv.Itoa(s.Pages) + " pages, " + strconv.Itoa(len(s.Findings)) + " findings\n")
+	}
+	result := "pass"
+	if !r.Pass {
+		result = "fail"
+	}
+	b.WriteString(strconv.Itoa(r.Pages) + " pages, " + strconv.Itoa(len(r.Findings)) + " findings: " + result + "\n")
+	return b.String()
+}
@@ -0,0 +1,107 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCheckFile(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{vorbisIDPacket(44100, 8, 11)}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.EncodeEOS(10, [][]byte{[]byte("audio")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+	clean := append([]byte(nil), b.Bytes()...)
+
+	rep, err := CheckFile(bytes.NewReader(clean), ConformancePedantic)
+	if err != nil {
+		t.Fatal("unexpected CheckFile error:", err)
+	}
+	if !rep.Pass || rep.Pages != 2 || len(rep.Streams) != 1 || !rep.Streams[0].EOS || rep.Streams[0].Codec != CodecVorbis {
+		t.Fatalf("expected a clean report, got\n%s", rep)
+	}
+
+	b.Reset()
+	e = NewEncoder(2, &b)
+	for i, err := range []error{
+		e.EncodeBOS(0, [][]byte{[]byte("one"), []byte("two")}),
+		e.Encode(20, [][]byte{[]byte("audio")}),
+		e.Encode(30, [][]byte{[]byte("audio")}),
+		e.Encode(10, [][]byte{[]byte("audio")}),
+	} {
+		if err != nil {
+			t.Fatalf("%d: unexpected encoding error: %v", i, err)
+		}
+	}
+	pages := b.Bytes()
+	pageLen := headsz + 1 + len("audio")
+	bosLen := len(pages) - 3*pageLen
+	// junk before the second page, and the third corrupted
+	bad := append(append(append([]byte(nil), pages[:bosLen]...), "junk"...), pages[bosLen:]...)
+	bad[bosLen+4+pageLen+headsz+1] ^= 1
+	// and the last dropped, replaced by its start
+	bad = bad[:len(bad)-2]
+
+	rs := bytes.NewReader(bad)
+	rep, err = CheckFile(rs, ConformancePedantic)
+	if err != nil {
+		t.Fatal("unexpected CheckFile error:", err)
+	}
+	if pos, _ := rs.Seek(0, io.SeekCurrent); pos != 0 {
+		t.Fatalf("left the reader at %d", pos)
+	}
+
+	want := []struct {
+		page   int
+		offset int
+		err    error
+	}{
+		{0, 0, ErrLoneBOS{2, 2}},
+		{1, bosLen + 4, ErrSkippedBytes{4}},
+		{2, bosLen + 4 + pageLen, ErrBadCrc{}},
+		{-1, bosLen + 4 + 2*pageLen, io.ErrUnexpectedEOF},
+		{-1, len(bad), ErrStreamBoundary{2, "missing EOS page"}},
+	}
+	if rep.Pass || len(rep.Findings) != len(want) {
+		t.Fatalf("expected %d findings, got\n%s", len(want), rep)
+	}
+	for i, w := range want {
+		f := rep.Findings[i]
+		if _, crc := w.err.(ErrBadCrc); crc {
+			_, crc = f.Err.(ErrBadCrc)
+			if !crc {
+				t.Fatalf("%d: expected ErrBadCrc, got %v", i, f.Err)
+			}
+		} else if f.Err != w.err {
+			t.Fatalf("%d: expected %v, got %v", i, w.err, f.Err)
+		}
+		if f.Page != w.page || f.Offset != int64(w.offset) {
+			t.Fatalf("%d: expected page %d at %d, got %d at %d", i, w.page, w.offset, f.Page, f.Offset)
+		}
+	}
+	if s := rep.Streams; len(s) != 1 || len(s[0].Findings) != 3 || s[0].Pages != 2 {
+		t.Fatalf("expected 3 findings of a stream of 2 pages, got\n%s", rep)
+	}
+	if !strings.HasSuffix(rep.String(), "3 pages, 5 findings: fail\n") {
+		t.Fatalf("unexpected report\n%s", rep)
+	}
+
+	// every check a page fails is reported: the gap and the granule position
+	gap := append(append([]byte(nil), pages[:bosLen+pageLen]...), pages[bosLen+2*pageLen:]...)
+	rep, err = CheckFile(bytes.NewReader(gap), ConformanceStrict)
+	if err != nil {
+		t.Fatal("unexpected CheckFile error:", err)
+	}
+	if len(rep.Findings) != 3 || rep.Findings[0].Err != (ErrSequenceGap{2, 2, 3}) || rep.Findings[1].Err != (ErrGranuleOrder{2, 20, 10}) {
+		t.Fatalf("expected a gap, then a granule position going back, got\n%s", rep)
+	}
+
+	if _, err := CheckFile(strings.NewReader(""), ConformanceStrict); err != ErrNoPages {
+		t.Fatal("expected ErrNoPages, got", err)
+	}
+}
@@ -0,0 +1,279 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+)
+
+// A Codec identifies the format of the data encapsulated in a logical stream.
+type Codec int
+
+const (
+	CodecUnknown Codec = iota
+	CodecOpus
+	CodecVorbis
+	CodecTheora
+	CodecSpeex
+	CodecFLAC
+	CodecSkeleton
+)
+
+var codecNames = [...]string{
+	CodecUnknown:  "unknown",
+	CodecOpus:     "opus",
+	CodecVorbis:   "vorbis",
+	CodecTheora:   "theora",
+	CodecSpeex:    "speex",
+	CodecFLAC:     "flac",
+	CodecSkeleton: "skeleton",
+}
+
+func (c Codec) String() string {
+	if c < 0 || int(c) >= len(codecNames) {
+		return codecNames[CodecUnknown]
+	}
+	return codecNames[c]
+}
+
+// The magic signatures that begin the first packet of each codec's logical stream.
+var codecMagics = []struct {
+	magic []byte
+	codec Codec
+}{
+	{[]byte("OpusHead"), CodecOpus},
+	{[]byte("\x01vorbis"), CodecVorbis},
+	{[]byte("\x80theora"), CodecTheora},
+	{[]byte("Speex   "), CodecSpeex},
+	{[]byte("\x7fFLAC"), CodecFLAC},
+	{[]byte("fishead\x00"), CodecSkeleton},
+}
+
+// IdentifyCodec reports the codec of a logical stream, given the first packet of its BOS page.
+func IdentifyCodec(bosPacket []byte) Codec {
+	for _, m := range codecMagics {
+		if bytes.HasPrefix(bosPacket, m.magic) {
+			return m.codec
+		}
+	}
+	return CodecUnknown
+}
+
+// Channels returns the number of audio channels of the logical stream whose first packet is bosPacket,
+// for Opus, Vorbis, Speex, and FLAC. For Opus, it's the number of output channels,
+// which for surround streams the channel mapping assigns from however many Opus streams.
+// The error is ErrUnsupportedCodec for other codecs, including Theora, which has no audio,
+// or the codec's error for a malformed header.
+func Channels(bosPacket []byte) (int, error) {
+	var n int
+	switch IdentifyCodec(bosPacket) {
+	case CodecOpus:
+		h, err := ParseOpusHead(bosPacket)
+		if err != nil {
+			return 0, err
+		}
+		if h.Channels == 0 {
+			return 0, ErrBadOpusHead
+		}
+		return int(h.Channels), nil
+	case CodecVorbis:
+		id, err := ParseVorbisID(bosPacket)
+		if err != nil {
+			return 0, err
+		}
+		if id.Channels == 0 {
+			return 0, ErrBadVorbisHeader
+		}
+		return int(id.Channels), nil
+	case CodecSpeex:
+		// the channel count follows the rate and two more 4-byte fields
+		if len(bosPacket) < 52 {
+			return 0, ErrBadCodecHeader
+		}
+		n = int(byteOrder.Uint32(bosPacket[48:]))
+	case CodecFLAC:
+		// 3 bits, after the 20 of the rate in STREAMINFO, give the count less one
+		if len(bosPacket) < 30 || string(bosPacket[9:13]) != "fLaC" {
+			return 0, ErrBadCodecHeader
+		}
+		n = int(bosPacket[29]>>1&0x07) + 1
+	default:
+		return 0, ErrUnsupportedCodec
+	}
+	if n < 1 || n > 255 {
+		return 0, ErrBadCodecHeader
+	}
+	return n, nil
+}
+
+// StreamInfo describes a logical stream found by ListStreams.
+type StreamInfo struct {
+	Serial uint32
+	Codec  Codec
+}
+
+// ListStreams returns the logical streams in rs, in the order of their BOS pages.
+// The whole of rs is scanned so that the streams of every link in a chained file are found,
+// after which rs is returned to its original position.
+// If rs cannot actually seek (e.g. it is a pipe), only the BOS pages at the
+// start of the stream are read.
+func ListStreams(rs io.ReadSeeker) ([]StreamInfo, error) {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	seekable := err == nil
+
+	var streams []StreamInfo
+	d := NewDecoder(rs)
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return streams, err
+		}
+
+		if p.Type&BOS == 0 {
+			if !seekable {
+				return streams, nil
+			}
+			continue
+		}
+
+		var c Codec
+		if len(p.Packets) > 0 {
+			c = IdentifyCodec(p.Packets[0])
+		}
+		streams = append(streams, StreamInfo{p.Serial, c})
+	}
+
+	if seekable {
+		_, err = rs.Seek(start, io.SeekStart)
+	}
+	return streams, err
+}
+
+// contentSniffLen is the most DetectContentType reads looking for BOS pages.
+const contentSniffLen = 4 * maxPageSize
+
+// DetectContentType returns the media type of the ogg stream in r, as described in RFC 5334:
+// "video/ogg" if any stream of its first link is video, "audio/ogg" if they're all audio,
+// including Opus as in RFC 7845, or otherwise "application/ogg".
+// A Skeleton stream doesn't affect the type.
+// It reads the BOS pages at the start of r, up to contentSniffLen bytes; the returned Reader reads all of r's bytes,
+// including those already read, and should be used in place of r.
+// If r holds no pages, the error is ErrNoPages.
+func DetectContentType(r io.Reader) (string, io.Reader, error) {
+	var read bytes.Buffer
+	d := NewDecoder(io.TeeReader(io.LimitReader(r, contentSniffLen), &read))
+
+	var audio, video, other bool
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", io.MultiReader(&read, r), err
+		}
+		if p.Type&BOS == 0 {
+			break
+		}
+
+		var c Codec
+		if len(p.Packets) > 0 {
+			c = IdentifyCodec(p.Packets[0])
+		}
+		switch c {
+		case CodecTheora:
+			video = true
+		case CodecOpus, CodecVorbis, CodecSpeex, CodecFLAC:
+			audio = true
+		case CodecSkeleton:
+		default:
+			other = true
+		}
+	}
+
+	r = io.MultiReader(&read, r)
+	switch {
+	case video:
+		return "video/ogg", r, nil
+	case audio && !other:
+		return "audio/ogg", r, nil
+	case audio || other:
+		return "application/ogg", r, nil
+	}
+	return "", r, ErrNoPages
+}
+
+// A PacketKind is the role of a packet in its logical stream, as given by ClassifyPacket.
+type PacketKind int
+
+const (
+	// PacketData is a packet of the encoded media.
+	PacketData PacketKind = iota
+	// PacketHeader is the identification header that begins a logical stream.
+	PacketHeader
+	// PacketTags is a comment header, of metadata.
+	PacketTags
+	// PacketSetup is any other header, such as the codebooks of Vorbis and Theora.
+	PacketSetup
+)
+
+var packetKindNames = [...]string{
+	PacketData:   "data",
+	PacketHeader: "header",
+	PacketTags:   "tags",
+	PacketSetup:  "setup",
+}
+
+func (k PacketKind) String() string {
+	if k < 0 || int(k) >= len(packetKindNames) {
+		return "unknown"
+	}
+	return packetKindNames[k]
+}
+
+// ClassifyPacket returns the kind of pkt, the packet at index index of a logical stream of the given codec,
+// counting from 0 for the stream's first packet, as identified by IdentifyCodec.
+// For Vorbis, Theora, and FLAC, header packets are told from data packets by their type bytes,
+// and for Opus and Speex, by their position: two headers and then data,
+// though a Speex stream may have extra headers, which are classified as data.
+// Skeleton packets are all headers. For an unknown codec, only the first packet is taken for a header.
+func ClassifyPacket(codec Codec, index int, pkt []byte) PacketKind {
+	if index == 0 {
+		return PacketHeader
+	}
+	switch codec {
+	case CodecOpus, CodecSpeex:
+		if index == 1 {
+			return PacketTags
+		}
+	case CodecVorbis:
+		// Header types are odd, and followed by the codec name; audio packets' first bit is 0.
+		if len(pkt) >= 7 && pkt[0]&1 != 0 && string(pkt[1:7]) == "vorbis" {
+			return headerKind(pkt[0] == 0x03)
+		}
+	case CodecTheora:
+		// Header types have the high bit set; video packets' first bit is 0.
+		if len(pkt) >= 7 && pkt[0]&0x80 != 0 && string(pkt[1:7]) == "theora" {
+			return headerKind(pkt[0] == 0x81)
+		}
+	case CodecFLAC:
+		// Header packets are metadata blocks, whose type is 7 bits;
+		// audio frames begin with a sync code, whose first byte is 0xff.
+		if len(pkt) > 0 && pkt[0] != 0xff {
+			return headerKind(pkt[0]&0x7f == 4)
+		}
+	case CodecSkeleton:
+		return PacketSetup
+	}
+	return PacketData
+}
+
+// headerKind returns the kind of a header packet after the first, which is a comment header if tags is set.
+func headerKind(tags bool) PacketKind {
+	if tags {
+		return PacketTags
+	}
+	return PacketSetup
+}
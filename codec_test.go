@@ -0,0 +1,226 @@
+package ogg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestIdentifyCodec(t *testing.T) {
+	tests := []struct {
+		packet []byte
+		want   Codec
+	}{
+		{[]byte("OpusHead\x01\x02"), CodecOpus},
+		{[]byte("\x01vorbis\x00\x00"), CodecVorbis},
+		{[]byte("\x80theora\x03\x02"), CodecTheora},
+		{[]byte("Speex   1.2"), CodecSpeex},
+		{[]byte("\x7fFLAC\x01\x00"), CodecFLAC},
+		{[]byte("fishead\x00\x04\x00"), CodecSkeleton},
+		{[]byte("Opus"), CodecUnknown},
+		{nil, CodecUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := IdentifyCodec(tt.packet); got != tt.want {
+			t.Errorf("IdentifyCodec(%q) = %v, want %v", tt.packet, got, tt.want)
+		}
+	}
+}
+
+func chainedFile(t *testing.T) []byte {
+	var b bytes.Buffer
+
+	// A grouped link with audio and video...
+	a := NewEncoder(1, &b)
+	v := NewEncoder(2, &b)
+	if err := a.EncodeBOS(0, [][]byte{[]byte("OpusHead")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := v.EncodeBOS(0, [][]byte{[]byte("\x80theora")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := a.EncodeEOS(10, [][]byte{[]byte("a")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+	if err := v.EncodeEOS(10, [][]byte{[]byte("v")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	// ...chained to a vorbis link.
+	c := NewEncoder(3, &b)
+	if err := c.EncodeBOS(0, [][]byte{[]byte("\x01vorbis")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := c.EncodeEOS(10, [][]byte{[]byte("c")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	return b.Bytes()
+}
+
+func TestListStreams(t *testing.T) {
+	r := bytes.NewReader(chainedFile(t))
+	streams, err := ListStreams(r)
+	if err != nil {
+		t.Fatal("unexpected ListStreams error:", err)
+	}
+
+	expect := []StreamInfo{{1, CodecOpus}, {2, CodecTheora}, {3, CodecVorbis}}
+	if len(streams) != len(expect) {
+		t.Fatalf("got %d streams, expected %d", len(streams), len(expect))
+	}
+	for i := range expect {
+		if streams[i] != expect[i] {
+			t.Fatalf("stream %d = %+v, expected %+v", i, streams[i], expect[i])
+		}
+	}
+
+	if pos, _ := r.Seek(0, io.SeekCurrent); pos != 0 {
+		t.Fatal("expected ListStreams to restore the position, got", pos)
+	}
+}
+
+type unseekable struct {
+	io.Reader
+}
+
+func (unseekable) Seek(int64, int) (int64, error) {
+	return 0, errors.New("cannot seek")
+}
+
+func TestListStreamsUnseekable(t *testing.T) {
+	streams, err := ListStreams(unseekable{bytes.NewReader(chainedFile(t))})
+	if err != nil {
+		t.Fatal("unexpected ListStreams error:", err)
+	}
+
+	if len(streams) != 2 {
+		t.Fatalf("got %d streams, expected only the leading 2", len(streams))
+	}
+	if streams[0].Serial != 1 || streams[1].Serial != 2 {
+		t.Fatalf("unexpected streams: %+v", streams)
+	}
+}
+
+func TestDetectContentType(t *testing.T) {
+	bos := func(magics ...string) []byte {
+		var b bytes.Buffer
+		for i, m := range magics {
+			if err := NewEncoder(uint32(i), &b).EncodeBOS(0, [][]byte{[]byte(m)}); err != nil {
+				t.Fatal("unexpected EncodeBOS error:", err)
+			}
+		}
+		if err := NewEncoder(0, &b).Encode(1, [][]byte{[]byte("data")}); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+		return b.Bytes()
+	}
+
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{chainedFile(t), "video/ogg"},
+		{bos("OpusHead"), "audio/ogg"},
+		{bos("\x01vorbis", "Speex   "), "audio/ogg"},
+		{bos("fishead\x00", "OpusHead"), "audio/ogg"},
+		{bos("OpusHead", "\x80kate"), "application/ogg"},
+	}
+	for _, test := range tests {
+		typ, r, err := DetectContentType(bytes.NewReader(test.data))
+		if err != nil {
+			t.Fatal("unexpected DetectContentType error:", err)
+		}
+		if typ != test.want {
+			t.Fatalf("expected %s, got %s", test.want, typ)
+		}
+		all, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal("unexpected ReadAll error:", err)
+		}
+		if !bytes.Equal(all, test.data) {
+			t.Fatal("returned reader lost bytes")
+		}
+	}
+
+	_, r, err := DetectContentType(strings.NewReader("not ogg"))
+	if err != ErrNoPages {
+		t.Fatal("expected ErrNoPages, got", err)
+	}
+	if all, _ := io.ReadAll(r); string(all) != "not ogg" {
+		t.Fatal("returned reader lost bytes")
+	}
+}
+
+func TestChannels(t *testing.T) {
+	surround := append(opusHeadPacket(6, 0), 4, 2, 0, 4, 1, 2, 3, 5)
+	surround[18] = 1
+
+	speex := make([]byte, 80)
+	copy(speex, "Speex   ")
+	byteOrder.PutUint32(speex[48:], 1)
+
+	flac := append([]byte("\x7fFLAC\x01\x00\x00\x01fLaC\x00\x00\x00\x22"), make([]byte, 34)...)
+	// 44100 Hz, then 2 channels, coded as 1
+	flac[27], flac[28], flac[29] = 0x0a, 0xc4, 0x42
+
+	tests := []struct {
+		bos      []byte
+		channels int
+		err      error
+	}{
+		{opusHeadPacket(2, 312), 2, nil},
+		{surround, 6, nil},
+		{vorbisIDPacket(44100, 8, 11), 2, nil},
+		{speex, 1, nil},
+		{flac, 2, nil},
+		{speex[:50], 0, ErrBadCodecHeader},
+		{flac[:29], 0, ErrBadCodecHeader},
+		{[]byte("\x80theora\x03\x02\x01"), 0, ErrUnsupportedCodec},
+		{[]byte("mystery"), 0, ErrUnsupportedCodec},
+	}
+	for i, test := range tests {
+		n, err := Channels(test.bos)
+		if n != test.channels || err != test.err {
+			t.Fatalf("%d: expected %d, %v, got %d, %v", i, test.channels, test.err, n, err)
+		}
+	}
+}
+
+func TestClassifyPacket(t *testing.T) {
+	tests := []struct {
+		codec Codec
+		index int
+		pkt   string
+		want  PacketKind
+	}{
+		{CodecOpus, 0, "OpusHead", PacketHeader},
+		{CodecOpus, 1, "OpusTags", PacketTags},
+		{CodecOpus, 2, "\xf8\x01", PacketData},
+		{CodecVorbis, 0, "\x01vorbis", PacketHeader},
+		{CodecVorbis, 1, "\x03vorbis", PacketTags},
+		{CodecVorbis, 2, "\x05vorbis", PacketSetup},
+		{CodecVorbis, 3, "\x00audio", PacketData},
+		{CodecVorbis, 3, "", PacketData},
+		{CodecTheora, 1, "\x81theora", PacketTags},
+		{CodecTheora, 2, "\x82theora", PacketSetup},
+		{CodecTheora, 3, "\x40video", PacketData},
+		{CodecSpeex, 1, "comments", PacketTags},
+		{CodecSpeex, 2, "audio", PacketData},
+		{CodecFLAC, 0, "\x7fFLAC", PacketHeader},
+		{CodecFLAC, 1, "\x84\x00\x00\x10", PacketTags},
+		{CodecFLAC, 2, "\x06\x00\x00\x10", PacketSetup},
+		{CodecFLAC, 3, "\xff\xf8\x69\x08", PacketData},
+		{CodecSkeleton, 1, "fisbone\x00", PacketSetup},
+		{CodecUnknown, 0, "mystery", PacketHeader},
+		{CodecUnknown, 1, "mystery", PacketData},
+	}
+	for i, test := range tests {
+		if kind := ClassifyPacket(test.codec, test.index, []byte(test.pkt)); kind != test.want {
+			t.Fatalf("%d: expected %v for %s packet %d, got %v", i, test.want, test.codec, test.index, kind)
+		}
+	}
+}
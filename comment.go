@@ -0,0 +1,144 @@
+package ogg
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrBadComments is the error used when a comment header is truncated or its lengths are inconsistent.
+var ErrBadComments = errors.New("malformed comment header")
+
+// ParseComments parses a Vorbis comment structure, as used by the
+// comment headers of Vorbis, Opus, Speex, Theora, and FLAC in ogg,
+// once any codec-specific magic preceding it has been removed.
+// Comment names are case-insensitive, so they are returned in upper case.
+// Comments without an '=' are ignored.
+// The strings are returned as found, whatever their encoding; see ParseCommentsUTF8.
+func ParseComments(data []byte) (vendor string, comments map[string][]string, err error) {
+	return parseComments(data, false, false)
+}
+
+// ErrInvalidUTF8 is the error used by ParseCommentsUTF8 when the vendor string or a comment's value isn't UTF-8.
+var ErrInvalidUTF8 = errors.New("comment is not valid UTF-8")
+
+// ErrBadCommentName is the error used by ParseCommentsUTF8 when a comment's name
+// isn't printable ASCII other than '='.
+var ErrBadCommentName = errors.New("comment name is not printable ASCII")
+
+// ParseCommentsUTF8 is like ParseComments, but validates the strings as the format requires:
+// the vendor string and values must be well-formed UTF-8, and the names printable ASCII, other than '='.
+// Invalid strings are errors, ErrInvalidUTF8 or ErrBadCommentName,
+// unless replace is set, in which case each run of invalid bytes in the vendor string and values
+// is replaced with U+FFFD, the Unicode replacement character, and comments with invalid names are ignored,
+// so that the metadata is safe to display.
+func ParseCommentsUTF8(data []byte, replace bool) (vendor string, comments map[string][]string, err error) {
+	return parseComments(data, true, replace)
+}
+
+// parseComments parses a Vorbis comment structure, validating its strings if validate is set,
+// and if so, replacing those that are invalid if replace is.
+func parseComments(data []byte, validate, replace bool) (vendor string, comments map[string][]string, err error) {
+	field := func() (string, bool) {
+		if len(data) < 4 {
+			return "", false
+		}
+		n := byteOrder.Uint32(data)
+		data = data[4:]
+		if uint64(n) > uint64(len(data)) {
+			return "", false
+		}
+		s := string(data[:n])
+		data = data[n:]
+		return s, true
+	}
+
+	vendor, ok := field()
+	if !ok || len(data) < 4 {
+		return "", nil, ErrBadComments
+	}
+	if validate {
+		if vendor, err = validUTF8(vendor, replace); err != nil {
+			return "", nil, err
+		}
+	}
+	count := byteOrder.Uint32(data)
+	data = data[4:]
+
+	comments = make(map[string][]string)
+	for i := uint32(0); i < count; i++ {
+		c, ok := field()
+		if !ok {
+			return "", nil, ErrBadComments
+		}
+		eq := strings.IndexByte(c, '=')
+		if eq < 0 {
+			continue
+		}
+		name, value := c[:eq], c[eq+1:]
+		if validate {
+			if !commentName(name) {
+				if replace {
+					continue
+				}
+				return "", nil, ErrBadCommentName
+			}
+			if value, err = validUTF8(value, replace); err != nil {
+				return "", nil, err
+			}
+		}
+		key := strings.ToUpper(name)
+		comments[key] = append(comments[key], value)
+	}
+
+	return vendor, comments, nil
+}
+
+// validUTF8 returns s if it's valid UTF-8, or else, if replace is set,
+// s with each run of invalid bytes replaced with U+FFFD.
+func validUTF8(s string, replace bool) (string, error) {
+	if utf8.ValidString(s) {
+		return s, nil
+	}
+	if replace {
+		return strings.ToValidUTF8(s, "\uFFFD"), nil
+	}
+	return "", ErrInvalidUTF8
+}
+
+// commentName reports whether name is a valid comment name: printable ASCII, 0x20 through 0x7d, other than '='.
+func commentName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c < 0x20 || c > 0x7d || c == '=' {
+			return false
+		}
+	}
+	return true
+}
+
+// appendComments appends a Vorbis comment structure to b, the inverse of ParseComments,
+// with the comments in order of their names so the output is deterministic.
+func appendComments(b []byte, vendor string, comments map[string][]string) []byte {
+	field := func(s string) {
+		b = byteOrder.AppendUint32(b, uint32(len(s)))
+		b = append(b, s...)
+	}
+
+	names := make([]string, 0, len(comments))
+	count := 0
+	for name, values := range comments {
+		names = append(names, name)
+		count += len(values)
+	}
+	sort.Strings(names)
+
+	field(vendor)
+	b = byteOrder.AppendUint32(b, uint32(count))
+	for _, name := range names {
+		for _, v := range comments[name] {
+			field(name + "=" + v)
+		}
+	}
+	return b
+}
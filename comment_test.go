@@ -0,0 +1,99 @@
+package ogg
+
+import (
+	"testing"
+)
+
+func commentHeader(vendor string, comments ...string) []byte {
+	var b []byte
+	field := func(s string) {
+		var n [4]byte
+		byteOrder.PutUint32(n[:], uint32(len(s)))
+		b = append(b, n[:]...)
+		b = append(b, s...)
+	}
+
+	field(vendor)
+	var n [4]byte
+	byteOrder.PutUint32(n[:], uint32(len(comments)))
+	b = append(b, n[:]...)
+	for _, c := range comments {
+		field(c)
+	}
+	return b
+}
+
+func TestParseComments(t *testing.T) {
+	data := commentHeader("libfoo 1.0", "title=Song", "ARTIST=A", "artist=B", "junk")
+
+	vendor, comments, err := ParseComments(data)
+	if err != nil {
+		t.Fatal("unexpected ParseComments error:", err)
+	}
+	if vendor != "libfoo 1.0" {
+		t.Fatalf("vendor = %q", vendor)
+	}
+	if len(comments) != 2 {
+		t.Fatalf("got %d comment names, expected 2", len(comments))
+	}
+	if got := comments["TITLE"]; len(got) != 1 || got[0] != "Song" {
+		t.Fatalf("TITLE = %q", got)
+	}
+	if got := comments["ARTIST"]; len(got) != 2 || got[0] != "A" || got[1] != "B" {
+		t.Fatalf("ARTIST = %q", got)
+	}
+}
+
+func TestParseBadComments(t *testing.T) {
+	data := commentHeader("vendor", "a=b")
+	for i := 0; i < len(data); i++ {
+		_, _, err := ParseComments(data[:i])
+		if err != ErrBadComments {
+			t.Fatalf("expected ErrBadComments for %d bytes, got: %v", i, err)
+		}
+	}
+}
+
+func TestParseCommentsUTF8(t *testing.T) {
+	tests := []struct {
+		vendor   string
+		comment  string
+		err      error
+		replaced string // the vendor and value, joined by '|', or "" if the comment is ignored
+	}{
+		{"libfoo", "title=Café ☕", nil, "libfoo|Café ☕"},
+		{"lib\xfffoo", "title=ok", ErrInvalidUTF8, "lib�foo|ok"},
+		// a truncated sequence, and a run of invalid bytes replaced as one
+		{"libfoo", "title=Caf\xc3", ErrInvalidUTF8, "libfoo|Caf�"},
+		{"libfoo", "title=a\xff\xfeb", ErrInvalidUTF8, "libfoo|a�b"},
+		{"libfoo", "tit\x01le=ok", ErrBadCommentName, ""},
+		{"libfoo", "títle=ok", ErrBadCommentName, ""},
+		{"libfoo", "ti~tle=ok", ErrBadCommentName, ""},
+	}
+	for i, test := range tests {
+		data := commentHeader(test.vendor, test.comment)
+
+		_, _, err := ParseCommentsUTF8(data, false)
+		if err != test.err {
+			t.Fatalf("%d: expected error %v, got %v", i, test.err, err)
+		}
+		// ParseComments doesn't validate
+		if _, _, err := ParseComments(data); err != nil {
+			t.Fatalf("%d: unexpected ParseComments error: %v", i, err)
+		}
+
+		vendor, comments, err := ParseCommentsUTF8(data, true)
+		if err != nil {
+			t.Fatalf("%d: unexpected error replacing: %v", i, err)
+		}
+		if test.replaced == "" {
+			if len(comments) != 0 {
+				t.Fatalf("%d: expected the comment to be ignored, got %q", i, comments)
+			}
+			continue
+		}
+		if got := comments["TITLE"]; len(got) != 1 || vendor+"|"+got[0] != test.replaced {
+			t.Fatalf("%d: expected %q, got %q and %q", i, test.replaced, vendor, got)
+		}
+	}
+}
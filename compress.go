@@ -0,0 +1,54 @@
+package ogg
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// NewZstdReader, if set, is used by NewAutoDecoder to decompress zstd-compressed input.
+// It is nil by default, to keep the package free of dependencies;
+// callers that need zstd may set it to a function wrapping a zstd package's decoder.
+var NewZstdReader func(r io.Reader) (io.Reader, error)
+
+// ErrUnsupportedCompression is the error used by NewAutoDecoder when its input is
+// compressed in a format it can't decompress.
+var ErrUnsupportedCompression = errors.New("unsupported compression format")
+
+// NewAutoDecoder creates an ogg Decoder that decodes from r,
+// transparently decompressing it if it starts with a gzip or zstd header.
+// Otherwise, r is decoded as is. No bytes of r are lost to the sniffing.
+// Decompressing zstd requires NewZstdReader to be set.
+func NewAutoDecoder(r io.Reader) (*Decoder, error) {
+	br := bufio.NewReaderSize(r, maxPageSize)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return NewDecoder(zr), nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		if NewZstdReader == nil {
+			return nil, ErrUnsupportedCompression
+		}
+		zr, err := NewZstdReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return NewDecoder(zr), nil
+	}
+	return NewDecoder(br), nil
+}
@@ -0,0 +1,76 @@
+package ogg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+func autoDecode(t *testing.T, r io.Reader) [][]byte {
+	t.Helper()
+	d, err := NewAutoDecoder(r)
+	if err != nil {
+		t.Fatal("unexpected NewAutoDecoder error:", err)
+	}
+	d.CopyPackets = true
+	var packets [][]byte
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			return packets
+		}
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		packets = append(packets, p.Packets...)
+	}
+}
+
+func TestAutoDecoder(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("hello")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.EncodeEOS(1, [][]byte{[]byte("world")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	packets := autoDecode(t, bytes.NewReader(b.Bytes()))
+	if len(packets) != 2 || string(packets[0]) != "hello" || string(packets[1]) != "world" {
+		t.Fatalf("raw: unexpected packets %q", packets)
+	}
+
+	var z bytes.Buffer
+	zw := gzip.NewWriter(&z)
+	zw.Write(b.Bytes())
+	zw.Close()
+	packets = autoDecode(t, &z)
+	if len(packets) != 2 || string(packets[0]) != "hello" || string(packets[1]) != "world" {
+		t.Fatalf("gzip: unexpected packets %q", packets)
+	}
+}
+
+func TestAutoDecoderZstd(t *testing.T) {
+	in := append(append([]byte(nil), zstdMagic...), 0, 0)
+	_, err := NewAutoDecoder(bytes.NewReader(in))
+	if err != ErrUnsupportedCompression {
+		t.Fatal("expected ErrUnsupportedCompression, got", err)
+	}
+
+	NewZstdReader = func(r io.Reader) (io.Reader, error) {
+		io.CopyN(io.Discard, r, int64(len(zstdMagic)+2))
+		return bytes.NewReader(nil), nil
+	}
+	defer func() { NewZstdReader = nil }()
+	if packets := autoDecode(t, bytes.NewReader(in)); len(packets) != 0 {
+		t.Fatalf("unexpected packets %q", packets)
+	}
+}
+
+func TestAutoDecoderShort(t *testing.T) {
+	if packets := autoDecode(t, bytes.NewReader(nil)); len(packets) != 0 {
+		t.Fatalf("unexpected packets %q", packets)
+	}
+}
@@ -0,0 +1,316 @@
+package ogg
+
+import (
+	"sort"
+	"strconv"
+)
+
+// A Conformance level selects a set of checks for a Decoder to make on each page,
+// beyond its CRC.
+type Conformance int
+
+const (
+	// ConformanceLenient makes no checks.
+	ConformanceLenient Conformance = iota
+	// ConformanceStrict makes the checks that catch violations of RFC 3533,
+	// and truncation: CheckVersion, CheckBoundaries, CheckGranuleOrder, CheckSequence,
+	// CheckInterleave, and CheckTruncation.
+	ConformanceStrict
+	// ConformancePedantic makes the strict checks, as well as checks for
+	// unusual constructs that are legal but that codec mappings forbid or
+	// that commonly indicate a buggy muxer: CheckLoneBOS and CheckReservedBits.
+	ConformancePedantic
+)
+
+// A Check is a bitmask of page checks that a Decoder can make.
+type Check uint
+
+const (
+	// CheckVersion checks that the stream structure version is 0.
+	CheckVersion Check = 1 << iota
+	// CheckBoundaries checks that each logical stream starts with a BOS page,
+	// that no other of its pages is a BOS page, and that no page follows its EOS page.
+	CheckBoundaries
+	// CheckGranuleOrder checks that granule positions never decrease within a logical stream,
+	// ignoring pages with no granule position (-1).
+	CheckGranuleOrder
+	// CheckSequence checks that page sequence numbers increase by one within a logical stream.
+	CheckSequence
+	// CheckInterleave checks that the BOS pages of grouped logical streams precede all of their other pages.
+	CheckInterleave
+	// CheckLoneBOS checks that each BOS page holds exactly one, complete, packet.
+	CheckLoneBOS
+	// CheckReservedBits checks that the header type of each page has no bits set besides COP, BOS, and EOS.
+	CheckReservedBits
+	// CheckTruncation checks, at the end of the stream, that no logical stream's last page
+	// left a packet unfinished, promising a continuation that never came.
+	CheckTruncation
+)
+
+// Checks returns the checks made at the conformance level c.
+func (c Conformance) Checks() Check {
+	const strict = CheckVersion | CheckBoundaries | CheckGranuleOrder | CheckSequence | CheckInterleave | CheckTruncation
+	switch c {
+	case ConformanceLenient:
+		return 0
+	case ConformanceStrict:
+		return strict
+	}
+	return strict | CheckLoneBOS | CheckReservedBits
+}
+
+// checks returns the checks d makes: those of its conformance level, as overridden.
+func (d *Decoder) checks() Check {
+	return (d.Conformance.Checks() | d.EnableChecks) &^ d.DisableChecks
+}
+
+// ErrBadVersion is the error used by CheckVersion when a page has a nonzero stream structure version.
+type ErrBadVersion struct {
+	Version byte
+}
+
+func (e ErrBadVersion) Error() string {
+	return "unsupported stream structure version " + strconv.Itoa(int(e.Version))
+}
+
+// ErrStreamBoundary is the error used by CheckBoundaries when a logical stream
+// is missing its BOS page, repeats it, or continues past its EOS page.
+type ErrStreamBoundary struct {
+	Serial uint32
+	Reason string
+}
+
+func (e ErrStreamBoundary) Error() string {
+	return "stream " + strconv.FormatUint(uint64(e.Serial), 10) + ": " + e.Reason
+}
+
+// ErrGranuleOrder is the error used by CheckGranuleOrder when a granule position decreases.
+type ErrGranuleOrder struct {
+	Serial  uint32
+	Prev    int64
+	Granule int64
+}
+
+func (e ErrGranuleOrder) Error() string {
+	return "stream " + strconv.FormatUint(uint64(e.Serial), 10) +
+		": granule position went back from " + strconv.FormatInt(e.Prev, 10) +
+		" to " + strconv.FormatInt(e.Granule, 10)
+}
+
+// ErrSequenceGap is the error used by CheckSequence when a page sequence number
+// isn't one more than its predecessor's, indicating lost or reordered pages.
+type ErrSequenceGap struct {
+	Serial   uint32
+	Expected uint32
+	Found    uint32
+}
+
+func (e ErrSequenceGap) Error() string {
+	return "stream " + strconv.FormatUint(uint64(e.Serial), 10) +
+		": expected page " + strconv.FormatUint(uint64(e.Expected), 10) +
+		", got " + strconv.FormatUint(uint64(e.Found), 10)
+}
+
+// ErrInterleave is the error used by CheckInterleave when a BOS page follows
+// other pages of the grouped logical streams it belongs with.
+type ErrInterleave struct {
+	Serial uint32
+}
+
+func (e ErrInterleave) Error() string {
+	return "stream " + strconv.FormatUint(uint64(e.Serial), 10) + ": BOS page after data pages"
+}
+
+// ErrLoneBOS is the error used by CheckLoneBOS when a BOS page holds other than one complete packet.
+type ErrLoneBOS struct {
+	Serial  uint32
+	Packets int
+}
+
+func (e ErrLoneBOS) Error() string {
+	return "stream " + strconv.FormatUint(uint64(e.Serial), 10) +
+		": BOS page holds " + strconv.Itoa(e.Packets) + " packets or an unfinished packet"
+}
+
+// ErrReservedBitsSet is the error used by CheckReservedBits when a page's header type
+// has reserved bits set.
+type ErrReservedBitsSet struct {
+	Serial     uint32
+	HeaderType byte
+}
+
+func (e ErrReservedBitsSet) Error() string {
+	return "stream " + strconv.FormatUint(uint64(e.Serial), 10) +
+		": reserved bits set in header type 0x" + strconv.FormatUint(uint64(e.HeaderType), 16)
+}
+
+// ErrTruncatedFinalPacket is the error used by CheckTruncation when the stream ends
+// after a page of a logical stream whose last packet is unfinished.
+// Unlike a missing EOS page, it means a packet was cut short.
+type ErrTruncatedFinalPacket struct {
+	Serial uint32
+}
+
+func (e ErrTruncatedFinalPacket) Error() string {
+	return "stream " + strconv.FormatUint(uint64(e.Serial), 10) + ": last packet truncated"
+}
+
+// streamState is what a Decoder tracks about each logical stream of the current link.
+type streamState struct {
+	seq     uint32
+	crc     uint32 // of the last page, to recognize duplicates
+	granule int64  // the last granule position other than -1, or -1
+	eos     bool
+
+	// whether the last page's last packet is unfinished
+	unfinished bool
+}
+
+// track updates d's logical stream state with a page,
+// returning an error if the page fails any of d's checks.
+// The state is updated either way, so decoding can continue.
+func (d *Decoder) track(h *pageHeader, packets int) error {
+	if errs := d.trackAll(h, packets); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// trackAll is like track, but returns the errors of every check the page fails, in the order made.
+func (d *Decoder) trackAll(h *pageHeader, packets int) []error {
+	checks := d.checks()
+	var errs []error
+	fail := func(c Check, e error) {
+		if checks&c != 0 {
+			errs = append(errs, e)
+		}
+	}
+
+	if h.StreamVersion != 0 {
+		fail(CheckVersion, ErrBadVersion{h.StreamVersion})
+	}
+	if h.HeaderType&^(COP|BOS|EOS) != 0 {
+		fail(CheckReservedBits, ErrReservedBitsSet{h.Serial, h.HeaderType})
+	}
+
+	if d.streams == nil {
+		d.streams = make(map[uint32]*streamState)
+	}
+	s := d.streams[h.Serial]
+
+	if h.HeaderType&BOS != 0 {
+		if d.linkData {
+			if d.openStreams() > 0 {
+				fail(CheckInterleave, ErrInterleave{h.Serial})
+			} else {
+				// Every stream has ended, so this begins the next link of a chain.
+				d.streams = make(map[uint32]*streamState)
+				d.linkData = false
+				s = nil
+			}
+		}
+		if s != nil {
+			fail(CheckBoundaries, ErrStreamBoundary{h.Serial, "repeated BOS page"})
+		}
+		if packets != 1 || d.unfinished {
+			fail(CheckLoneBOS, ErrLoneBOS{h.Serial, packets})
+		}
+		s = &streamState{granule: -1}
+		d.streams[h.Serial] = s
+	} else {
+		d.linkData = true
+		if s == nil {
+			fail(CheckBoundaries, ErrStreamBoundary{h.Serial, "missing BOS page"})
+			s = &streamState{granule: -1}
+			d.streams[h.Serial] = s
+		} else {
+			if s.eos {
+				fail(CheckBoundaries, ErrStreamBoundary{h.Serial, "page after EOS page"})
+			}
+			if h.Page != s.seq+1 {
+				fail(CheckSequence, ErrSequenceGap{h.Serial, s.seq + 1, h.Page})
+			}
+		}
+	}
+
+	if h.Granule != -1 {
+		if s.granule != -1 && h.Granule < s.granule {
+			fail(CheckGranuleOrder, ErrGranuleOrder{h.Serial, s.granule, h.Granule})
+		}
+		s.granule = h.Granule
+	}
+	s.seq = h.Page
+	s.crc = h.Crc
+	s.unfinished = d.unfinished
+	if h.HeaderType&EOS != 0 {
+		s.eos = true
+	}
+
+	return errs
+}
+
+// truncated returns the errors of CheckTruncation, at the end of the stream, in order of serial number,
+// if d makes it.
+func (d *Decoder) truncated() []error {
+	if d.checks()&CheckTruncation == 0 {
+		return nil
+	}
+	var errs []error
+	for _, serial := range d.serials() {
+		if d.streams[serial].unfinished {
+			errs = append(errs, ErrTruncatedFinalPacket{serial})
+		}
+	}
+	return errs
+}
+
+// duplicate reports whether a page repeats the previous page of its logical stream,
+// having its sequence number and CRC.
+func (d *Decoder) duplicate(h *pageHeader) bool {
+	s := d.streams[h.Serial]
+	return s != nil && h.Page == s.seq && h.Crc == s.crc
+}
+
+// CleanEOF reports whether every logical stream d has seen has ended with an EOS page.
+// After Decode returns io.EOF, it tells a properly terminated stream from a truncated one,
+// without Decode having to fail on the latter.
+// In a chained stream each link's streams end before the next link's begin,
+// so only the streams of the last link can be left open.
+func (d *Decoder) CleanEOF() bool {
+	return d.openStreams() == 0
+}
+
+// ActiveStreams returns the serial numbers, in increasing order, of the logical streams
+// that d has seen begin but not end with an EOS page.
+// Each stream's EOS is tracked independently, so in a multiplexed stream
+// the others remain active after one ends, until they end in turn.
+func (d *Decoder) ActiveStreams() []uint32 {
+	var serials []uint32
+	for _, serial := range d.serials() {
+		if !d.streams[serial].eos {
+			serials = append(serials, serial)
+		}
+	}
+	return serials
+}
+
+// serials returns the serial numbers of the logical streams of the current link, in increasing order.
+func (d *Decoder) serials() []uint32 {
+	serials := make([]uint32, 0, len(d.streams))
+	for serial := range d.streams {
+		serials = append(serials, serial)
+	}
+	sort.Slice(serials, func(i, j int) bool { return serials[i] < serials[j] })
+	return serials
+}
+
+// openStreams returns the number of logical streams in the current link without an EOS page.
+func (d *Decoder) openStreams() int {
+	n := 0
+	for _, s := range d.streams {
+		if !s.eos {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,341 @@
+package ogg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// decodeErrs decodes every page of b, returning the errors of those that fail.
+func decodeErrs(t *testing.T, b []byte, level Conformance, enable, disable Check) []error {
+	t.Helper()
+	d := NewDecoder(bytes.NewReader(b))
+	d.Conformance = level
+	d.EnableChecks = enable
+	d.DisableChecks = disable
+	var errs []error
+	for {
+		_, _, err := d.Decode()
+		if err == io.EOF {
+			return errs
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+}
+
+func TestConformanceChecks(t *testing.T) {
+	if ConformanceLenient.Checks() != 0 {
+		t.Fatal("lenient level makes checks")
+	}
+	if ConformanceStrict.Checks()&(CheckLoneBOS|CheckReservedBits) != 0 {
+		t.Fatal("strict level makes pedantic checks")
+	}
+	if ConformancePedantic.Checks()&ConformanceStrict.Checks() != ConformanceStrict.Checks() {
+		t.Fatal("pedantic level omits strict checks")
+	}
+}
+
+func TestConformanceValid(t *testing.T) {
+	var b bytes.Buffer
+	e1 := NewEncoder(1, &b)
+	e2 := NewEncoder(2, &b)
+	if err := e1.EncodeBOS(0, [][]byte{[]byte("head1")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e2.EncodeBOS(0, [][]byte{[]byte("head2")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	for i := int64(1); i <= 3; i++ {
+		if err := e1.Encode(i, [][]byte{[]byte("a")}); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+		if err := e2.Encode(i, [][]byte{[]byte("b")}); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+	}
+	if err := e1.EncodeEOS(4, nil); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+	if err := e2.EncodeEOS(4, nil); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	// a chained link may follow
+	e3 := NewEncoder(3, &b)
+	if err := e3.EncodeBOS(0, [][]byte{[]byte("head3")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e3.EncodeEOS(1, [][]byte{[]byte("c")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	if errs := decodeErrs(t, b.Bytes(), ConformancePedantic, 0, 0); len(errs) != 0 {
+		t.Fatal("unexpected Decode errors:", errs)
+	}
+}
+
+func TestConformanceViolations(t *testing.T) {
+	tests := []struct {
+		name   string
+		encode func(b *bytes.Buffer) error
+		check  Check
+		want   error
+	}{
+		{"version", func(b *bytes.Buffer) error {
+			if err := NewEncoder(1, b).EncodeBOS(0, [][]byte{[]byte("x")}); err != nil {
+				return err
+			}
+			p := b.Bytes()
+			p[4] = 1
+			fixCrc(p)
+			return nil
+		}, CheckVersion, ErrBadVersion{1}},
+		{"missing BOS", func(b *bytes.Buffer) error {
+			return NewEncoder(1, b).Encode(0, [][]byte{[]byte("x")})
+		}, CheckBoundaries, ErrStreamBoundary{1, "missing BOS page"}},
+		{"repeated BOS", func(b *bytes.Buffer) error {
+			e := NewEncoder(1, b)
+			if err := e.EncodeBOS(0, [][]byte{[]byte("x")}); err != nil {
+				return err
+			}
+			return e.EncodeBOS(0, [][]byte{[]byte("x")})
+		}, CheckBoundaries, ErrStreamBoundary{1, "repeated BOS page"}},
+		{"after EOS", func(b *bytes.Buffer) error {
+			e := NewEncoder(1, b)
+			if err := e.EncodeBOS(0, [][]byte{[]byte("x")}); err != nil {
+				return err
+			}
+			e2 := NewEncoder(2, b)
+			if err := e2.EncodeBOS(0, [][]byte{[]byte("y")}); err != nil {
+				return err
+			}
+			if err := e.EncodeEOS(1, [][]byte{[]byte("x")}); err != nil {
+				return err
+			}
+			return e.Encode(2, [][]byte{[]byte("x")})
+		}, CheckBoundaries, ErrStreamBoundary{1, "page after EOS page"}},
+		{"granule order", func(b *bytes.Buffer) error {
+			e := NewEncoder(1, b)
+			if err := e.EncodeBOS(0, [][]byte{[]byte("x")}); err != nil {
+				return err
+			}
+			if err := e.Encode(5, [][]byte{[]byte("x")}); err != nil {
+				return err
+			}
+			return e.Encode(4, [][]byte{[]byte("x")})
+		}, CheckGranuleOrder, ErrGranuleOrder{1, 5, 4}},
+		{"sequence", func(b *bytes.Buffer) error {
+			e := NewEncoder(1, b)
+			if err := e.EncodeBOS(0, [][]byte{[]byte("x")}); err != nil {
+				return err
+			}
+			e.SetSequence(3)
+			return e.Encode(1, [][]byte{[]byte("x")})
+		}, CheckSequence, ErrSequenceGap{1, 1, 3}},
+		{"interleave", func(b *bytes.Buffer) error {
+			e := NewEncoder(1, b)
+			if err := e.EncodeBOS(0, [][]byte{[]byte("x")}); err != nil {
+				return err
+			}
+			if err := e.Encode(1, [][]byte{[]byte("x")}); err != nil {
+				return err
+			}
+			return NewEncoder(2, b).EncodeBOS(0, [][]byte{[]byte("y")})
+		}, CheckInterleave, ErrInterleave{2}},
+		{"lone BOS", func(b *bytes.Buffer) error {
+			return NewEncoder(1, b).EncodeBOS(0, [][]byte{[]byte("x"), []byte("y")})
+		}, CheckLoneBOS, ErrLoneBOS{1, 2}},
+		{"reserved bits", func(b *bytes.Buffer) error {
+			if err := NewEncoder(1, b).EncodeBOS(0, [][]byte{[]byte("x")}); err != nil {
+				return err
+			}
+			p := b.Bytes()
+			p[5] |= 0x10
+			fixCrc(p)
+			return nil
+		}, CheckReservedBits, ErrReservedBitsSet{1, BOS | 0x10}},
+	}
+
+	for _, test := range tests {
+		var b bytes.Buffer
+		if err := test.encode(&b); err != nil {
+			t.Fatal(test.name+": unexpected encode error:", err)
+		}
+
+		if errs := decodeErrs(t, b.Bytes(), ConformanceLenient, 0, 0); len(errs) != 0 {
+			t.Fatal(test.name+": unexpected lenient Decode errors:", errs)
+		}
+
+		errs := decodeErrs(t, b.Bytes(), ConformancePedantic, 0, 0)
+		if len(errs) != 1 || errs[0] != test.want {
+			t.Fatalf("%s: expected error %v, got %v", test.name, test.want, errs)
+		}
+
+		if errs := decodeErrs(t, b.Bytes(), ConformancePedantic, 0, test.check); len(errs) != 0 {
+			t.Fatal(test.name+": unexpected Decode errors with check disabled:", errs)
+		}
+
+		errs = decodeErrs(t, b.Bytes(), ConformanceLenient, test.check, 0)
+		if len(errs) != 1 || errs[0] != test.want {
+			t.Fatalf("%s: expected error %v with check enabled, got %v", test.name, test.want, errs)
+		}
+	}
+}
+
+// fixCrc recomputes the CRC of the page at the start of p.
+func fixCrc(p []byte) {
+	n := headsz + int(p[26])
+	for _, l := range p[headsz:n] {
+		n += int(l)
+	}
+	copy(p[22:26], []byte{0, 0, 0, 0})
+	binary.LittleEndian.PutUint32(p[22:26], crc32(p[:n]))
+}
+
+func TestCleanEOF(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.EncodeEOS(1, [][]byte{[]byte("a")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+	e = NewEncoder(2, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	truncated := b.Len()
+	if err := e.EncodeEOS(1, [][]byte{[]byte("b")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	for _, test := range []struct {
+		data  []byte
+		clean bool
+	}{
+		{b.Bytes(), true},
+		{b.Bytes()[:truncated], false},
+		{nil, true},
+	} {
+		d := NewDecoder(bytes.NewReader(test.data))
+		for {
+			_, _, err := d.Decode()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal("unexpected Decode error:", err)
+			}
+		}
+		if d.CleanEOF() != test.clean {
+			t.Fatalf("%d bytes: expected CleanEOF %v", len(test.data), test.clean)
+		}
+	}
+}
+
+func TestActiveStreams(t *testing.T) {
+	var b bytes.Buffer
+	a := NewEncoder(1, &b)
+	v := NewEncoder(2, &b)
+	if err := a.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := v.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := v.EncodeEOS(1, [][]byte{[]byte("v")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+	if err := a.Encode(1, [][]byte{[]byte("a")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := a.EncodeEOS(2, [][]byte{[]byte("a")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	expected := [][]uint32{{1}, {1, 2}, {1}, {1}, nil}
+	d := NewDecoder(&b)
+	d.Conformance = ConformanceStrict
+	for i, want := range expected {
+		if _, _, err := d.Decode(); err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		got := d.ActiveStreams()
+		if len(got) != len(want) {
+			t.Fatalf("page %d: expected active streams %v, got %v", i, want, got)
+		}
+		for j := range want {
+			if got[j] != want[j] {
+				t.Fatalf("page %d: expected active streams %v, got %v", i, want, got)
+			}
+		}
+	}
+	if !d.CleanEOF() {
+		t.Fatal("expected a clean EOF")
+	}
+}
+
+func TestTruncatedFinalPacket(t *testing.T) {
+	var b bytes.Buffer
+	e1 := NewEncoder(1, &b)
+	e2 := NewEncoder(2, &b)
+	for i, err := range []error{
+		e1.EncodeBOS(0, [][]byte{[]byte("head")}),
+		e2.EncodeBOS(0, [][]byte{[]byte("head")}),
+		// the first stream's last page promises a continuation that never comes
+		e1.EncodePage(Page{Serial: 1, Granule: -1, Packets: [][]byte{[]byte("a"), bytes.Repeat([]byte{'b'}, mss)}, Unfinished: true}),
+		e2.Encode(1, [][]byte{[]byte("c")}),
+	} {
+		if err != nil {
+			t.Fatalf("%d: unexpected encoding error: %v", i, err)
+		}
+	}
+
+	for _, level := range []Conformance{ConformanceLenient, ConformanceStrict} {
+		d := NewDecoder(bytes.NewReader(b.Bytes()))
+		d.Conformance = level
+		for i := 0; i < 4; i++ {
+			if _, _, err := d.Decode(); err != nil {
+				t.Fatalf("level %d: unexpected Decode error: %v", level, err)
+			}
+		}
+		_, _, err := d.Decode()
+		if level == ConformanceStrict {
+			if err != (ErrTruncatedFinalPacket{1}) {
+				t.Fatal("expected ErrTruncatedFinalPacket, got", err)
+			}
+			_, _, err = d.Decode()
+		}
+		if err != io.EOF {
+			t.Fatalf("level %d: expected EOF, got %v", level, err)
+		}
+	}
+
+	// The truncated packet can still be emitted.
+	d := NewDecoder(bytes.NewReader(b.Bytes()))
+	d.Conformance = ConformanceStrict
+	d.EmitPartialOnEOF = true
+	var partial Packet
+	var err error
+	for err == nil {
+		var pkt Packet
+		if pkt, err = d.DecodePacket(); pkt.Partial {
+			partial = pkt
+		}
+	}
+	if err != io.EOF || partial.Serial != 1 || len(partial.Data) != mss {
+		t.Fatalf("expected a partial packet of stream 1, then EOF, got %v, %v", partial, err)
+	}
+
+	rep, err := CheckFile(bytes.NewReader(b.Bytes()), ConformanceStrict)
+	if err != nil {
+		t.Fatal("unexpected CheckFile error:", err)
+	}
+	if len(rep.Findings) != 3 || rep.Findings[0].Err != (ErrTruncatedFinalPacket{1}) {
+		t.Fatalf("expected the truncation and two missing EOS pages, got\n%s", rep)
+	}
+}
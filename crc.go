@@ -0,0 +1,48 @@
+package ogg
+
+import "hash"
+
+// CRC32 returns the checksum of p as ogg computes it: a CRC-32 with the polynomial 0x04c11db7,
+// unreflected, with an initial value and final XOR of 0, unlike the IEEE CRC-32 of hash/crc32.
+// A page's checksum is that of the whole page with its CRC field, bytes 22 to 25, zeroed.
+func CRC32(p []byte) uint32 {
+	return crc32(p)
+}
+
+// NewCRC returns a hash.Hash32 computing the checksum CRC32 does, incrementally,
+// so that a page can be checksummed as it's streamed, as with io.Copy.
+// Its Sum appends the checksum in big-endian order, as those of hash/crc32 do;
+// in a page header, it's stored little-endian.
+func NewCRC() hash.Hash32 {
+	return new(crcDigest)
+}
+
+// A crcDigest is the hash.Hash32 returned by NewCRC.
+type crcDigest struct {
+	crc uint32
+}
+
+func (d *crcDigest) Write(p []byte) (int, error) {
+	d.crc = crcUpdate(d.crc, p)
+	return len(p), nil
+}
+
+func (d *crcDigest) Sum32() uint32 {
+	return d.crc
+}
+
+func (d *crcDigest) Sum(b []byte) []byte {
+	return append(b, byte(d.crc>>24), byte(d.crc>>16), byte(d.crc>>8), byte(d.crc))
+}
+
+func (d *crcDigest) Reset() {
+	d.crc = 0
+}
+
+func (d *crcDigest) Size() int {
+	return 4
+}
+
+func (d *crcDigest) BlockSize() int {
+	return 1
+}
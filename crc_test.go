@@ -0,0 +1,46 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestNewCRC(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{bytes.Repeat([]byte("packet"), 100)}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	page := append([]byte(nil), b.Bytes()...)
+	want := byteOrder.Uint32(page[22:26])
+	byteOrder.PutUint32(page[22:26], 0)
+
+	if got := CRC32(page); got != want {
+		t.Fatalf("expected CRC32 %#x, got %#x", want, got)
+	}
+
+	crc := NewCRC()
+	// a byte at a time, to check the checksum continues across writes
+	if _, err := io.Copy(crc, iotest.OneByteReader(bytes.NewReader(page))); err != nil {
+		t.Fatal("unexpected Copy error:", err)
+	}
+	if got := crc.Sum32(); got != want {
+		t.Fatalf("expected Sum32 %#x, got %#x", want, got)
+	}
+	sum := crc.Sum([]byte("x"))
+	if len(sum) != 1+crc.Size() || sum[0] != 'x' || sum[1] != byte(want>>24) || sum[4] != byte(want) {
+		t.Fatalf("expected Sum to append %#x, got %x", want, sum)
+	}
+
+	crc.Reset()
+	if crc.Sum32() != 0 {
+		t.Fatal("expected Reset to zero the checksum, got", crc.Sum32())
+	}
+	crc.Write(page[:10])
+	crc.Write(page[10:])
+	if got := crc.Sum32(); got != want {
+		t.Fatalf("expected Sum32 %#x after Reset, got %#x", want, got)
+	}
+}
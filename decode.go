@@ -1,26 +1,180 @@
 package ogg
 
 import (
+	"bufio"
 	"bytes"
-	"encoding/binary"
 	"errors"
-	"fmt"
 	"io"
 	"strconv"
 	"time"
 )
 
-// A Decoder decodes an ogg stream page-by-page with its Decode method.
+// A Decoder decodes an ogg stream page-by-page with its Decode method,
+// or packet-by-packet with its DecodePacket method.
 type Decoder struct {
+	// EmitPartialOnEOF makes DecodePacket return a packet left unfinished
+	// at the end of the stream, marked Partial, rather than dropping it.
+	EmitPartialOnEOF bool
+
+	// MaxPacketBytes and MaxContinuationPages, if positive, limit the packets DecodePacket reassembles
+	// from pages, in bytes and in the number of pages continuing them, to bound the memory and work
+	// a hostile stream can demand by fragmenting a packet across many pages.
+	// A packet over either limit is dropped, and DecodePacket returns ErrPacketTooLarge
+	// or ErrTooManyContinuations.
+	MaxPacketBytes       int
+	MaxContinuationPages int
+
+	// CopyPackets makes Decode return packets in memory of their own,
+	// instead of in the Decoder's buffer, so they may be retained.
+	CopyPackets bool
+
+	// SkipErrors makes VerifyOnly skip corrupt pages, rather than stop at the first.
+	SkipErrors bool
+
+	// DropDuplicates makes Decode skip the pages it would return with Duplicate set,
+	// so that their packets aren't delivered twice.
+	DropDuplicates bool
+
+	// KeepRawPage makes Decode set each Page's Raw field to the page's bytes.
+	KeepRawPage bool
+
+	// Timestamps makes Decode set each Page's Timestamp field,
+	// with the GranuleInterpreter registered for the codec of each logical stream
+	// (see RegisterCodec), created from the stream's first packet.
+	// GranuleRates, if set, overrides the rates of the logical streams with the given serial numbers,
+	// which allows timestamping the pages of other codecs whose granule positions count at a fixed rate.
+	// Other streams' pages aren't timestamped.
+	Timestamps   bool
+	GranuleRates map[uint32]int
+
+	// RebaseGranules makes Timestamps treat a page whose granule position is less than the last
+	// of its logical stream as a restart of the stream's granule counter, as some live sources do,
+	// rather than a jump back in time. Granule positions never decrease within a conformant stream,
+	// so any decrease is taken for a restart, from 0, and the timestamps continue from the last
+	// before it, keeping them monotonic for a stream that runs for days.
+	RebaseGranules bool
+
+	// MaxResyncBytes, if positive, limits the junk Decode skips looking for a page;
+	// past it, Decode returns ErrResyncLimit.
+	// Junk is streamed past, never buffered, so skipping any amount of it takes constant memory.
+	MaxResyncBytes int64
+
+	// MaxPages, if positive, limits the pages Decode reads, of all logical streams together,
+	// counting corrupt and duplicate pages; past it, Decode returns ErrTooManyPages.
+	// With the limits on packets and junk, it bounds the work an untrusted stream can demand,
+	// as by packing many tiny pages into a small file.
+	MaxPages int
+
+	// Conformance selects the checks Decode makes on each page.
+	// EnableChecks and DisableChecks add to and remove from its checks.
+	Conformance   Conformance
+	EnableChecks  Check
+	DisableChecks Check
+
 	// buffer for packet lengths, to avoid allocating (mss is also the max per page)
 	lenbuf [mss]int
 	r      io.Reader
-	buf    [maxPageSize]byte
+	// r, if it is a *bufio.Reader large enough to peek a page header
+	br  *bufio.Reader
+	buf []byte
+
+	// bytes consumed from r
+	offset int64
+
+	// the size of the most recent page, and
+	// whether its last packet continues on the next
+	size       int
+	unfinished bool
+
+	// reassembly state for DecodePacket: the packets yet to be returned,
+	// and those held for their continuations, by serial number
+	pending []Packet
+	held    map[uint32]*heldPacket
+
+	// the logical streams of the current link, and
+	// whether any of their non-BOS pages have been seen
+	streams  map[uint32]*streamState
+	linkData bool
+
+	// the logical streams not yet ended that Timestamps can interpret, by serial,
+	// and the rebasing of their timestamps for RebaseGranules
+	tsStreams map[uint32]tsStream
+	rebases   map[uint32]*GranuleRebase
+
+	// a page whose header was read by Peek, and whose payload is yet to be read
+	peeked       bool
+	peekHeader   pageHeader
+	peekLens     []int
+	peekPayload  int
+	peekResynced bool
+
+	// whether the last read ended partway through a page, for AtLimit
+	atLimit bool
+
+	// the pages read, for MaxPages
+	pages int
 }
 
 // NewDecoder creates an ogg Decoder.
+// If r is a *bufio.Reader, the Decoder scans for page headers
+// directly in its buffer rather than copying through its own.
+// Short reads are read past, so r may join a stream split across several readers anywhere,
+// even in the middle of a page, as io.MultiReader does for a recording split across files.
 func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{r: r}
+	d, _ := NewDecoderWithBuffer(r, make([]byte, maxPageSize))
+	return d
+}
+
+// ErrBufferTooSmall is the error used when a buffer given to NewDecoderWithBuffer can't hold a page.
+var ErrBufferTooSmall = errors.New("buffer is smaller than the maximum page size")
+
+// NewDecoderWithBuffer creates an ogg Decoder that decodes pages into buf
+// instead of allocating its own buffer,
+// so that callers decoding many streams can pool the buffers.
+// The buffer must be at least 65307 bytes, the maximum size of a page.
+//
+// The Decoder owns buf until the caller is done with it
+// and with every Page it returned; only then may buf be reused.
+func NewDecoderWithBuffer(r io.Reader, buf []byte) (*Decoder, error) {
+	if len(buf) < maxPageSize {
+		return nil, ErrBufferTooSmall
+	}
+
+	d := &Decoder{buf: buf}
+	d.setReader(r)
+	return d, nil
+}
+
+// Reset discards d's state and makes it decode from r,
+// keeping its buffer and options.
+// This allows Decoders to be pooled.
+func (d *Decoder) Reset(r io.Reader) {
+	*d = Decoder{
+		EmitPartialOnEOF:     d.EmitPartialOnEOF,
+		MaxPacketBytes:       d.MaxPacketBytes,
+		MaxContinuationPages: d.MaxContinuationPages,
+		CopyPackets:          d.CopyPackets,
+		SkipErrors:           d.SkipErrors,
+		DropDuplicates:       d.DropDuplicates,
+		KeepRawPage:          d.KeepRawPage,
+		Timestamps:           d.Timestamps,
+		GranuleRates:         d.GranuleRates,
+		RebaseGranules:       d.RebaseGranules,
+		MaxResyncBytes:       d.MaxResyncBytes,
+		MaxPages:             d.MaxPages,
+		Conformance:          d.Conformance,
+		EnableChecks:         d.EnableChecks,
+		DisableChecks:        d.DisableChecks,
+		buf:                  d.buf,
+	}
+	d.setReader(r)
+}
+
+func (d *Decoder) setReader(r io.Reader) {
+	d.r = r
+	if br, ok := r.(*bufio.Reader); ok && br.Size() >= headsz {
+		d.br = br
+	}
 }
 
 // A Page represents a logical ogg page.
@@ -31,12 +185,92 @@ type Page struct {
 	Serial uint32
 	// Granule is the granule position, whose meaning is dependent on the encapsulated codec.
 	Granule int64
+	// Sequence is the page's sequence number within its logical stream.
+	Sequence uint32
 	// Packets are the raw packet data.
 	// If Type & COP != 0, the first element is
 	// a continuation of the previous page's last packet.
 	Packets [][]byte
+	// Unfinished is set if the last element of Packets is continued on the next page.
+	Unfinished bool
+	// Resynced is set if bytes preceding the page had to be skipped
+	// to find its capture pattern, which suggests the stream is corrupt.
+	Resynced bool
+	// Size is the length of the page in the stream: its header, segment table, and payload.
+	// Unlike the byte count Decode returns, it excludes any junk skipped before the page.
+	Size int
+	// Duplicate is set if the page repeats the previous page of its logical stream,
+	// as retransmission can leave in recorded streams; see Decoder.DropDuplicates.
+	// A duplicate page isn't checked against the Decoder's Conformance, having been checked as the original.
+	Duplicate bool
+	// Timestamp is the presentation time at the end of the page, according to its granule position.
+	// It's only set if Decoder.Timestamps is, and the page has a granule position.
+	// It may be negative for a page that ends before presentation starts, as with the pre-skip of Opus.
+	Timestamp time.Duration
+	// Raw is the whole page as read: header, segment table, and payload.
+	// It's only set if Decoder.KeepRawPage is, and like Packets,
+	// it's in the Decoder's buffer unless Decoder.CopyPackets is set.
+	Raw []byte
+}
+
+// GranuleUint64 returns p's granule position as the unsigned 64-bit field it is in the page header,
+// for codecs whose granule positions are bit fields, such as Theora's (see SplitTheoraGranule),
+// whose upper bits would read as negative in an int64. The position -1, meaning none, is the maximum uint64.
+func (p Page) GranuleUint64() uint64 {
+	return uint64(p.Granule)
+}
+
+// IsBOS reports whether p is a beginning-of-stream page, with the BOS flag set in its Type.
+func (p Page) IsBOS() bool {
+	return p.Type&BOS != 0
+}
+
+// IsEOS reports whether p is an end-of-stream page, with the EOS flag set in its Type.
+func (p Page) IsEOS() bool {
+	return p.Type&EOS != 0
+}
+
+// IsContinuation reports whether p's first packet continues the previous page's last,
+// with the COP flag set in its Type.
+func (p Page) IsContinuation() bool {
+	return p.Type&COP != 0
+}
+
+// TypeString renders p's Type for logging, as its flags joined by "|", such as "BOS|EOS",
+// followed by any bits that aren't flags, in hexadecimal, or as "none" if it's 0.
+func (p Page) TypeString() string {
+	var s string
+	for _, f := range []struct {
+		flag byte
+		name string
+	}{{COP, "COP"}, {BOS, "BOS"}, {EOS, "EOS"}} {
+		if p.Type&f.flag != 0 {
+			s += "|" + f.name
+		}
+	}
+	if rest := p.Type &^ (COP | BOS | EOS); rest != 0 {
+		s += "|0x" + strconv.FormatUint(uint64(rest), 16)
+	}
+	if s == "" {
+		return "none"
+	}
+	return s[1:]
 }
 
+// PacketAt returns p's packet i, Packets[i], or ErrPacketIndex if there's no such packet,
+// for callers that take the index from elsewhere, such as a packet count.
+// Like Packets, the packet is in the Decoder's buffer unless Decoder.CopyPackets is set.
+// To slice only the packet asked for, decode the page with Decoder.DecodeLazy and use LazyPage.PacketAt.
+func (p Page) PacketAt(i int) ([]byte, error) {
+	if i < 0 || i >= len(p.Packets) {
+		return nil, ErrPacketIndex
+	}
+	return p.Packets[i], nil
+}
+
+// ErrPacketIndex is the error used by Page.PacketAt and LazyPage.PacketAt for an index with no packet.
+var ErrPacketIndex = errors.New("packet index out of range")
+
 // ErrBadSegs is the error used when trying to decode a page with a segment table size less than 1.
 var ErrBadSegs = errors.New("invalid segment table size")
 
@@ -51,69 +285,331 @@ func (bc ErrBadCrc) Error() string {
 		", expected " + strconv.FormatInt(int64(bc.Expected), 16)
 }
 
+// ErrPageTooLarge is the error used when an ogg page's header declares a page
+// larger than the Decoder can hold.
+type ErrPageTooLarge struct {
+	Size int
+}
+
+func (e ErrPageTooLarge) Error() string {
+	return "page too large: " + strconv.Itoa(e.Size) + " bytes"
+}
+
 var oggs = []byte{'O', 'g', 'g', 'S'}
 
 // Decode reads from d's Reader to the next ogg page, then returns the decoded Page or an error.
 // The error may be io.EOF if that's what the Reader returned.
 //
 // The buffer underlying the returned Page's Packets' bytes is owned by the Decoder.
-// It may be overwritten by subsequent calls to Decode.
+// It may be overwritten by subsequent calls to Decode, unless d.CopyPackets is set.
+//
+// Besides checking each page's CRC, Decode checks the pages against d.Conformance.
+// After a page fails a check, or its CRC, Decode may be called again to continue with the next page.
+// At the end of the stream, CheckTruncation has Decode return an ErrTruncatedFinalPacket
+// for each logical stream left with an unfinished packet, before it returns io.EOF.
 //
 // It is safe to call Decode concurrently on distinct Decoders if their Readers are distinct.
 // Otherwise, the behavior is undefined.
 func (d *Decoder) Decode() (Page, int, error) {
-	nread := 0
-	hbuf := d.buf[0:headsz]
-	b := 0
+	p, n, err := d.DecodeLazy()
+	if err != nil {
+		return Page{}, n, err
+	}
+	return p.page(), n, nil
+}
+
+// DecodeLazy is like Decode, but returns a LazyPage, which slices its packets only on demand,
+// saving the allocation of Packets for callers that look at few of them.
+// Like Decode's, the LazyPage's packets are in d's buffer, and may be overwritten
+// by subsequent calls, unless d.CopyPackets is set.
+func (d *Decoder) DecodeLazy() (LazyPage, int, error) {
+	skipped := 0
 	for {
-		n, err := io.ReadFull(d.r, hbuf[b:])
-		nread += n
-		if err != nil {
-			return Page{}, nread, err
+		if d.MaxPages > 0 && d.pages >= d.MaxPages {
+			return LazyPage{}, skipped, ErrTooManyPages
+		}
+		peeked := d.peeked
+		p, n, err := d.decodeLazy(true)
+		if err == nil || corrupt(err) {
+			d.pages++
+		}
+		d.offset += int64(n)
+		d.atLimit = cutShort(n > 0 || peeked, err)
+		if err == io.EOF && !d.atLimit {
+			if errs := d.truncated(); len(errs) > 0 {
+				// Report each stream's truncation once, before the end of the stream.
+				d.streams[errs[0].(ErrTruncatedFinalPacket).Serial].unfinished = false
+				return LazyPage{}, skipped + n, errs[0]
+			}
 		}
+		if err == nil && p.Duplicate && d.DropDuplicates {
+			skipped += n
+			continue
+		}
+		return p, skipped + n, err
+	}
+}
 
-		i := bytes.Index(hbuf, oggs)
-		if i == 0 {
-			break
+// AtLimit reports whether the last call to Decode, DecodePacket, Peek, SkipPage, or VerifyOnly
+// failed because d's Reader ran out partway through a page, as opposed to at the end of a page,
+// or failing otherwise. The error alone can't tell: it's io.ErrUnexpectedEOF if the Reader ended
+// partway through a read, but io.EOF if it ended between the reads of a page's parts.
+//
+// This tells a caller reading a prefix of a stream, such as with an io.LimitedReader
+// or the body of an HTTP range request, that the limit cut a page short,
+// so that it may fetch more and decode the page again from its start,
+// which is Offset less the byte count the failed call returned.
+func (d *Decoder) AtLimit() bool {
+	return d.atLimit
+}
+
+// VerifyOnly reads the rest of the stream, checking each page's CRC but not decoding its packets,
+// which makes it faster than Decode for checking a stream's integrity.
+// It returns the number of valid pages read.
+// It stops at the first corrupt page, returning its error, unless d.SkipErrors is set;
+// then it returns the first such error after reading the whole stream.
+// The end of the stream isn't an error, unless it cuts a page short.
+func (d *Decoder) VerifyOnly() (pages int, err error) {
+	for {
+		peeked := d.peeked
+		_, _, n, _, perr := d.readPage()
+		d.offset += int64(n)
+		d.atLimit = cutShort(n > 0 || peeked, perr)
+		switch {
+		case perr == nil:
+			pages++
+			continue
+		case perr == io.EOF:
+			return pages, err
+		case !corrupt(perr) || !d.SkipErrors:
+			return pages, perr
+		}
+		if err == nil {
+			err = perr
 		}
+	}
+}
 
-		if i < 0 {
-			const n = headsz
-			if hbuf[n-1] == 'O' {
-				i = n - 1
-			} else if hbuf[n-2] == 'O' && hbuf[n-1] == 'g' {
-				i = n - 2
-			} else if hbuf[n-3] == 'O' && hbuf[n-2] == 'g' && hbuf[n-1] == 'g' {
-				i = n - 3
+// Peek reads the header and segment table of the next page, without its payload,
+// and returns the page without Packets, Timestamp, or Raw,
+// so the caller can choose to Decode it or skip it with SkipPage.
+// Calling Peek again returns the same page, having read nothing more.
+// The count of bytes read is the header's, and a subsequent Decode's count excludes it.
+func (d *Decoder) Peek() (Page, int, error) {
+	if d.peeked {
+		return d.headerPage(), 0, nil
+	}
+	h, packetlens, payloadlen, n, resynced, err := d.readHeader()
+	d.offset += int64(n)
+	d.atLimit = cutShort(n > 0, err)
+	if err != nil {
+		return Page{}, n, err
+	}
+	d.peeked = true
+	d.peekHeader, d.peekLens, d.peekPayload, d.peekResynced = h, packetlens, payloadlen, resynced
+	return d.headerPage(), n, nil
+}
+
+// SkipPage skips the next page, or the one returned by Peek, without reading its payload into d's buffer,
+// and returns the page without Packets, Timestamp, or Raw, so the caller knows what was skipped.
+// Skipped pages aren't checked against d.Conformance, nor is their CRC checked,
+// and DecodePacket doesn't see their packets,
+// so it's meant for skipping the pages of logical streams the caller isn't interested in.
+func (d *Decoder) SkipPage() (Page, int, error) {
+	var n int
+	if !d.peeked {
+		h, packetlens, payloadlen, nh, resynced, err := d.readHeader()
+		d.offset += int64(nh)
+		d.atLimit = cutShort(nh > 0, err)
+		if err != nil {
+			return Page{}, nh, err
+		}
+		d.peekHeader, d.peekLens, d.peekPayload, d.peekResynced = h, packetlens, payloadlen, resynced
+		n = nh
+	}
+	d.peeked = false
+	p := d.headerPage()
+
+	skipped, err := io.CopyN(io.Discard, d.r, int64(d.peekPayload))
+	d.offset += skipped
+	n += int(skipped)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	d.atLimit = cutShort(true, err)
+	if err != nil {
+		return Page{}, n, err
+	}
+	return p, n, nil
+}
+
+// cutShort reports whether reading a page, if started, failed with err because the Reader ran out.
+func cutShort(started bool, err error) bool {
+	return started && (err == io.EOF || err == io.ErrUnexpectedEOF)
+}
+
+// headerPage returns the Page for the header held by Peek or SkipPage, without its payload.
+func (d *Decoder) headerPage() Page {
+	h := &d.peekHeader
+	return Page{
+		Type:       h.HeaderType,
+		Serial:     h.Serial,
+		Granule:    h.Granule,
+		Sequence:   h.Page,
+		Unfinished: d.unfinished,
+		Resynced:   d.peekResynced,
+		Size:       headsz + int(h.Nsegs) + d.peekPayload,
+	}
+}
+
+// Offset returns the number of bytes d has consumed from its Reader.
+// After a successful call to Decode, this is the offset of the end of the returned page.
+func (d *Decoder) Offset() int64 {
+	return d.offset
+}
+
+// decode decodes the next page, checking it against d's checks if check is set.
+func (d *Decoder) decode(check bool) (Page, int, error) {
+	p, nread, err := d.decodeLazy(check)
+	if err != nil {
+		return Page{}, nread, err
+	}
+	return p.page(), nread, nil
+}
+
+// decodeLazy decodes the next page, without slicing its packets,
+// checking it against d's checks if check is set.
+func (d *Decoder) decodeLazy(check bool) (LazyPage, int, error) {
+	h, packetlens, nread, resynced, err := d.readPage()
+	if err != nil {
+		return LazyPage{}, nread, err
+	}
+	nsegs := int(h.Nsegs)
+	page := d.buf[:d.size]
+	payload := page[headsz+nsegs:]
+
+	var dup bool
+	if check {
+		// A duplicate was checked as the original.
+		if dup = d.duplicate(&h); !dup {
+			err = d.track(&h, len(packetlens))
+			if err != nil {
+				return LazyPage{}, nread, err
 			}
 		}
+	}
 
-		if i > 0 {
-			b = copy(hbuf, hbuf[i:])
+	var raw []byte
+	if d.KeepRawPage {
+		byteOrder.PutUint32(page[22:26], h.Crc)
+		raw = page
+	}
+
+	if d.CopyPackets {
+		if raw != nil {
+			raw = append([]byte(nil), raw...)
+			payload = raw[headsz+nsegs:]
+		} else {
+			payload = append([]byte(nil), payload...)
+		}
+		packetlens = append([]int(nil), packetlens...)
+	}
+
+	p := LazyPage{
+		Type:       h.HeaderType,
+		Serial:     h.Serial,
+		Granule:    h.Granule,
+		Sequence:   h.Page,
+		Unfinished: d.unfinished,
+		Resynced:   resynced,
+		Size:       d.size,
+		Duplicate:  dup,
+		Raw:        raw,
+		lens:       packetlens,
+		payload:    payload,
+	}
+	if d.Timestamps {
+		var first []byte
+		if len(packetlens) > 0 {
+			first = p.Packet(0)
+		}
+		p.Timestamp = d.timestamp(&h, first)
+	}
+	return p, nread, nil
+}
+
+// readPage reads the next page into d's buffer, or the rest of the one returned by Peek, and checks its CRC,
+// returning its header and the lengths of its packets.
+func (d *Decoder) readPage() (h pageHeader, packetlens []int, nread int, resynced bool, err error) {
+	var payloadlen int
+	if d.peeked {
+		d.peeked = false
+		h, packetlens, payloadlen, resynced = d.peekHeader, d.peekLens, d.peekPayload, d.peekResynced
+	} else {
+		h, packetlens, payloadlen, nread, resynced, err = d.readHeader()
+		if err != nil {
+			return h, nil, nread, resynced, err
 		}
 	}
 
-	var h pageHeader
-	_ = binary.Read(bytes.NewBuffer(hbuf), byteOrder, &h)
+	nsegs := int(h.Nsegs)
+	payload := d.buf[headsz+nsegs : headsz+nsegs+payloadlen]
+	n, err := io.ReadFull(d.r, payload)
+	nread += n
+	if err != nil {
+		return h, nil, nread, resynced, err
+	}
+
+	page := d.buf[0 : headsz+nsegs+payloadlen]
+	d.size = len(page)
+	// Clear out existing crc before calculating it
+	page[22] = 0
+	page[23] = 0
+	page[24] = 0
+	page[25] = 0
+	crc := crc32(page)
+	if crc != h.Crc {
+		return h, nil, nread, resynced, ErrBadCrc{h.Crc, crc}
+	}
+	return h, packetlens, nread, resynced, nil
+}
+
+// readHeader reads the next page's header and segment table into d's buffer,
+// returning the header, the lengths of its packets, and the length of its payload.
+func (d *Decoder) readHeader() (h pageHeader, packetlens []int, payloadlen, nread int, resynced bool, err error) {
+	hbuf := d.buf[0:headsz]
+	if d.br != nil {
+		nread, err = d.syncBuffered(hbuf)
+	} else {
+		nread, err = d.sync(hbuf)
+	}
+	if err != nil {
+		return h, nil, 0, nread, false, err
+	}
+	resynced = nread > headsz
+
+	h = parseHeader(hbuf)
 
 	if h.Nsegs < 1 {
-		return Page{}, 0, ErrBadSegs
+		return h, nil, 0, nread, resynced, ErrBadSegs
 	}
 
 	nsegs := int(h.Nsegs)
+	if headsz+nsegs > len(d.buf) {
+		return h, nil, 0, nread, resynced, ErrPageTooLarge{headsz + nsegs}
+	}
 	segtbl := d.buf[headsz : headsz+nsegs]
 	n, err := io.ReadFull(d.r, segtbl)
 	nread += n
 	if err != nil {
-		return Page{}, nread, err
+		return h, nil, 0, nread, resynced, err
 	}
 
 	// A page can contain multiple packets; record their lengths from the table
 	// now and slice up the payload after reading it.
 	// I'm inclined to limit the Read calls this way,
 	// but it's possible it isn't worth the annoyance of iterating twice
-	packetlens := d.lenbuf[0:0]
-	payloadlen := 0
+	packetlens = d.lenbuf[0:0]
 	more := false
 	for _, l := range segtbl {
 		if more {
@@ -126,81 +622,169 @@ func (d *Decoder) Decode() (Page, int, error) {
 		payloadlen += int(l)
 	}
 
-	payload := d.buf[headsz+nsegs : headsz+nsegs+payloadlen]
-	n, err = io.ReadFull(d.r, payload)
-	nread += n
-	if err != nil {
-		return Page{}, nread, err
-	}
+	d.unfinished = more
 
-	page := d.buf[0 : headsz+nsegs+payloadlen]
-	// Clear out existing crc before calculating it
-	page[22] = 0
-	page[23] = 0
-	page[24] = 0
-	page[25] = 0
-	crc := crc32(page)
-	if crc != h.Crc {
-		return Page{}, nread, ErrBadCrc{h.Crc, crc}
+	// The segment table's limits keep a page within maxPageSize,
+	// but check anyway, in case of a larger buffer, rather than trust them.
+	if size := headsz + nsegs + payloadlen; size > maxPageSize || size > len(d.buf) {
+		return h, nil, 0, nread, resynced, ErrPageTooLarge{size}
 	}
+	return h, packetlens, payloadlen, nread, resynced, nil
+}
 
-	packets := make([][]byte, len(packetlens))
-	s := 0
-	for i, l := range packetlens {
-		packets[i] = payload[s : s+l]
-		s += l
-	}
+// ErrTooManyPages is returned by Decode when a stream has more pages than the Decoder's MaxPages.
+var ErrTooManyPages = errors.New("too many pages")
+
+// ErrResyncLimit is returned when more than a Decoder's MaxResyncBytes precede a page.
+var ErrResyncLimit = errors.New("no page found within the resync limit")
 
-	return Page{h.HeaderType, h.Serial, h.Granule, packets}, nread, nil
+// resyncLimited reports whether skipping has exceeded d.MaxResyncBytes.
+func (d *Decoder) resyncLimited(skipped int) bool {
+	return d.MaxResyncBytes > 0 && int64(skipped) > d.MaxResyncBytes
 }
 
-// ParseOpusFrameDuration parses the frame duration from an Opus packet.
-// Assumes the packet has a valid TOC byte.
-func (d *Decoder) GetPacketDuration(pkt []byte) (time.Duration, error) {
-	if len(pkt) == 0 {
-		return 0, fmt.Errorf("empty opus packet")
+// sync reads from d's Reader until hbuf holds a full header starting with the capture pattern.
+func (d *Decoder) sync(hbuf []byte) (int, error) {
+	nread := 0
+	b := 0
+	for {
+		n, err := io.ReadFull(d.r, hbuf[b:])
+		nread += n
+		if err != nil {
+			return nread, err
+		}
+
+		i := bytes.Index(hbuf, oggs)
+		if i == 0 {
+			return nread, nil
+		}
+
+		if i < 0 {
+			i = len(hbuf) - partialCapture(hbuf)
+		}
+
+		if i > 0 {
+			b = copy(hbuf, hbuf[i:])
+		}
+		if d.resyncLimited(nread - b) {
+			return nread, ErrResyncLimit
+		}
 	}
+}
 
-	toc := pkt[0]
+// syncBuffered is like sync, but skips junk by peeking into d.br,
+// so only the header itself is copied into hbuf.
+func (d *Decoder) syncBuffered(hbuf []byte) (int, error) {
+	nread := 0
+	for {
+		b, err := d.br.Peek(headsz)
+		if err != nil {
+			n, _ := d.br.Discard(len(b))
+			nread += n
+			if err == io.EOF && n > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nread, err
+		}
 
-	config := toc >> 3        // Bits 0-4 (upper 5 bits)
-	frameCountCode := toc & 0x03 // Bits 6-7 (lower 2 bits)
+		i := bytes.Index(b, oggs)
+		if i == 0 {
+			copy(hbuf, b)
+			n, _ := d.br.Discard(headsz)
+			return nread + n, nil
+		}
 
-	// Mapping for frame size based on config
-	var frameSizeMs int
+		if i < 0 {
+			i = headsz - partialCapture(b)
+		}
+
+		n, _ := d.br.Discard(i)
+		nread += n
+		if d.resyncLimited(nread) {
+			return nread, ErrResyncLimit
+		}
+	}
+}
+
+// findChunkSize is the size of the chunks FindNextPage reads from readers that aren't buffered.
+const findChunkSize = 4096
 
-	switch config {
-	case 0, 1, 2, 3:
-		frameSizeMs = 10
-	case 4, 5, 6, 7:
-		frameSizeMs = 20
-	case 8, 9, 10, 11:
-		frameSizeMs = 40
-	case 12, 13, 14, 15:
-		frameSizeMs = 60
-	default:
-		frameSizeMs = 20 // default/fallback (common for Opus packets)
+// FindNextPage scans r for the next capture pattern, "OggS", that begins each page,
+// returning its offset from where r was, or io.EOF if there is none.
+// It reads r a chunk at a time, never holding more, so it can scan any amount of data;
+// the pattern may be a coincidence in corrupt data, which the page's CRC can rule out.
+//
+// If r is a *bufio.Reader, FindNextPage leaves it at the capture pattern,
+// and if r is an io.Seeker, it seeks back to the pattern; either way,
+// r may then be decoded from the page, or advanced a byte to find the next.
+// Otherwise, it reads past the pattern, leaving r at an unspecified position.
+func FindNextPage(r io.Reader) (int64, error) {
+	if br, ok := r.(*bufio.Reader); ok && br.Size() >= len(oggs) {
+		return findBuffered(br)
 	}
 
-	// Determine frame count
-	frameCount := 1
-	switch frameCountCode {
-	case 0:
-		frameCount = 1
-	case 1:
-		frameCount = 2
-	case 2:
-		frameCount = 2 // CELT only packets with padding (rare)
-	case 3:
-		if len(pkt) < 2 {
-			return 0, fmt.Errorf("invalid opus packet: frame count code 3 but packet is too short")
+	buf := make([]byte, findChunkSize)
+	off := int64(0)
+	kept := 0 // the bytes of a partial match carried over from the previous chunk
+	for {
+		n, err := r.Read(buf[kept:])
+		b := buf[:kept+n]
+		if i := bytes.Index(b, oggs); i >= 0 {
+			if s, ok := r.(io.Seeker); ok {
+				if _, err := s.Seek(int64(i-len(b)), io.SeekCurrent); err != nil {
+					return 0, err
+				}
+			}
+			return off + int64(i), nil
 		}
-		frameCount = int(pkt[1]) + 1
-		if frameCount < 1 {
-			return 0, fmt.Errorf("invalid opus packet: frame count code 3 but frame count is less than 1")
+		if err == io.EOF {
+			return off + int64(len(b)), io.EOF
 		}
+		if err != nil {
+			return 0, err
+		}
+
+		kept = copy(buf, b[len(b)-partialCapture(b):])
+		off += int64(len(b) - kept)
 	}
+}
 
-	totalDurationMs := frameSizeMs * frameCount
-	return time.Duration(totalDurationMs) * time.Millisecond, nil
+// findBuffered is FindNextPage for a *bufio.Reader, scanning its buffer in place.
+func findBuffered(br *bufio.Reader) (int64, error) {
+	off := int64(0)
+	for {
+		if _, err := br.Peek(len(oggs)); err != nil {
+			n, _ := br.Discard(br.Buffered())
+			off += int64(n)
+			return off, err
+		}
+		b, _ := br.Peek(br.Buffered())
+		if i := bytes.Index(b, oggs); i >= 0 {
+			br.Discard(i)
+			return off + int64(i), nil
+		}
+		n, _ := br.Discard(len(b) - partialCapture(b))
+		off += int64(n)
+	}
+}
+
+// partialCapture returns the length of the longest proper prefix
+// of the capture pattern that b ends with.
+func partialCapture(b []byte) int {
+	for n := len(oggs) - 1; n > 0; n-- {
+		if bytes.HasSuffix(b, oggs[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// GetPacketDuration returns the duration of an Opus packet,
+// from the frame size and frame count given by its TOC byte.
+func (d *Decoder) GetPacketDuration(pkt []byte) (time.Duration, error) {
+	samples, err := opusSamples(pkt)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(samples) * time.Second / 48000, nil
 }
@@ -3,11 +3,13 @@
 package ogg
 
 import (
+	"bufio"
 	"bytes"
 	"io"
 	"math/rand"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -27,6 +29,10 @@ func TestBasicDecode(t *testing.T) {
 		t.Fatal("unexpected Decode error:", err)
 	}
 
+	if p.Resynced {
+		t.Fatal("unexpected resync")
+	}
+
 	if p.Type != BOS {
 		t.Fatal("expected BOS, got", p.Type)
 	}
@@ -280,6 +286,10 @@ func TestSyncDecode(t *testing.T) {
 		t.Fatal("unexpected Decode error:", err)
 	}
 
+	if !p.Resynced {
+		t.Fatal("expected the page to be marked as resynced")
+	}
+
 	if p.Type != BOS {
 		t.Fatal("expected BOS, got", p.Type)
 	}
@@ -537,43 +547,49 @@ func TestGetPacketDuration(t *testing.T) {
         },
         {
             name:    "single 20ms frame",
-            packet:  []byte{0x20}, // config 4, frame count code 0
+            packet:  []byte{0x08}, // config 1, frame count code 0
             want:    20 * time.Millisecond,
             wantErr: false,
         },
         {
             name:    "single 40ms frame",
-            packet:  []byte{0x40}, // config 8, frame count code 0
+            packet:  []byte{0x10}, // config 2, frame count code 0
             want:    40 * time.Millisecond,
             wantErr: false,
         },
         {
             name:    "single 60ms frame",
-            packet:  []byte{0x60}, // config 12, frame count code 0
+            packet:  []byte{0x18}, // config 3, frame count code 0
             want:    60 * time.Millisecond,
             wantErr: false,
         },
         {
             name:    "two 20ms frames (code 1)",
-            packet:  []byte{0x21}, // config 4, frame count code 1
+            packet:  []byte{0x09}, // config 1, frame count code 1
             want:    40 * time.Millisecond,
             wantErr: false,
         },
         {
             name:    "two 20ms frames (code 2)",
-            packet:  []byte{0x22}, // config 4, frame count code 2
+            packet:  []byte{0x0a}, // config 1, frame count code 2
             want:    40 * time.Millisecond,
             wantErr: false,
         },
         {
             name:    "variable frame count (3 frames)",
-            packet:  []byte{0x23, 0x02}, // config 4, frame count code 3, count=2+1
+            packet:  []byte{0x0b, 0x03}, // config 1, frame count code 3, count=3
             want:    60 * time.Millisecond,
             wantErr: false,
         },
+        {
+            name:    "single 2.5ms CELT frame",
+            packet:  []byte{0x80}, // config 16, frame count code 0
+            want:    2500 * time.Microsecond,
+            wantErr: false,
+        },
         {
             name:    "code 3 but packet too short",
-            packet:  []byte{0x23}, // config 4, frame count code 3, but no second byte
+            packet:  []byte{0x0b}, // config 1, frame count code 3, but no second byte
             wantErr: true,
             errMsg:  "invalid opus packet: frame count code 3 but packet is too short",
         },
@@ -602,3 +618,763 @@ func TestGetPacketDuration(t *testing.T) {
         })
     }
 }
+
+func TestBufferedSyncDecode(t *testing.T) {
+	var b bytes.Buffer
+	for i := 0; i < headsz-3; i++ {
+		b.Write([]byte("x"))
+	}
+	b.Write([]byte("Og"))
+	for i := 0; i < 1000; i++ {
+		b.Write([]byte("x"))
+	}
+
+	e := NewEncoder(1, &b)
+	err := e.EncodeBOS(2, [][]byte{[]byte("hello")})
+	if err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	b.Write([]byte("xxO"))
+
+	total := b.Len()
+	d := NewDecoder(bufio.NewReader(&b))
+	if d.br == nil {
+		t.Fatal("expected the decoder to use the bufio.Reader directly")
+	}
+
+	p, n, err := d.Decode()
+	if err != nil {
+		t.Fatal("unexpected Decode error:", err)
+	}
+	if !p.Resynced || p.Type != BOS || p.Serial != 1 || p.Granule != 2 {
+		t.Fatalf("unexpected page: %+v", p)
+	}
+	if len(p.Packets) != 1 || !bytes.Equal(p.Packets[0], []byte("hello")) {
+		t.Fatalf("unexpected packets: %q", p.Packets)
+	}
+
+	_, n2, err := d.Decode()
+	if err != io.ErrUnexpectedEOF {
+		t.Fatal("expected ErrUnexpectedEOF, got:", err)
+	}
+	if n+n2 != total {
+		t.Fatalf("read %d bytes, expected %d", n+n2, total)
+	}
+}
+
+func TestLargeJunkDecode(t *testing.T) {
+	// megabytes of junk, full of near-misses of the capture pattern
+	junk := bytes.Repeat([]byte("OggOgOxOggxxx"), 1<<18)
+	var page bytes.Buffer
+	e := NewEncoder(1, &page)
+	if err := e.EncodeBOS(2, [][]byte{[]byte("hello")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	data := append(append([]byte(nil), junk...), page.Bytes()...)
+
+	wraps := []func(io.Reader) io.Reader{
+		func(r io.Reader) io.Reader { return r },
+		func(r io.Reader) io.Reader { return bufio.NewReader(r) },
+	}
+	for i, wrap := range wraps {
+		tests := []struct {
+			limit int64
+			err   error
+		}{
+			{0, nil},
+			{int64(len(junk)), nil},
+			{int64(len(junk)) - 1, ErrResyncLimit},
+			{1000, ErrResyncLimit},
+		}
+		for _, test := range tests {
+			d := NewDecoder(wrap(bytes.NewReader(data)))
+			d.MaxResyncBytes = test.limit
+			p, n, err := d.Decode()
+			if err != test.err {
+				t.Fatalf("%d, limit %d: expected %v, got %v", i, test.limit, test.err, err)
+			}
+			if err != nil {
+				if int64(n) > test.limit+headsz {
+					t.Fatalf("%d, limit %d: read %d bytes before giving up", i, test.limit, n)
+				}
+				continue
+			}
+			if !p.Resynced || n != len(data) || len(p.Packets) != 1 || string(p.Packets[0]) != "hello" {
+				t.Fatalf("%d, limit %d: unexpected page after %d bytes: %+v", i, test.limit, n, p)
+			}
+		}
+
+		// skipping the junk must not buffer it
+		d := NewDecoder(nil)
+		allocs := testing.AllocsPerRun(1, func() {
+			d.Reset(wrap(bytes.NewReader(data)))
+			if _, _, err := d.Decode(); err != nil {
+				t.Fatal("unexpected Decode error:", err)
+			}
+		})
+		if allocs > 10 {
+			t.Fatalf("%d: %v allocations to skip the junk", i, allocs)
+		}
+	}
+}
+
+func junkedPages(b *testing.B) []byte {
+	var buf bytes.Buffer
+	e := NewEncoder(1, &buf)
+	pkt := bytes.Repeat([]byte("p"), 100)
+	for i := 0; i < 100; i++ {
+		buf.Write(bytes.Repeat([]byte("x"), 500))
+		err := e.Encode(int64(i), [][]byte{pkt})
+		if err != nil {
+			b.Fatal("unexpected Encode error:", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func benchmarkDecode(b *testing.B, wrap func(io.Reader) io.Reader) {
+	data := junkedPages(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d := NewDecoder(wrap(bytes.NewReader(data)))
+		for {
+			_, _, err := d.Decode()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal("unexpected Decode error:", err)
+			}
+		}
+	}
+}
+
+func BenchmarkDecodeBufio(b *testing.B) {
+	benchmarkDecode(b, func(r io.Reader) io.Reader {
+		return bufio.NewReader(r)
+	})
+}
+
+func BenchmarkDecodeHiddenBufio(b *testing.B) {
+	benchmarkDecode(b, func(r io.Reader) io.Reader {
+		// Hide the bufio.Reader so the decoder copies through its own buffer.
+		return struct{ io.Reader }{bufio.NewReader(r)}
+	})
+}
+
+func BenchmarkVerifyOnly(b *testing.B) {
+	data := junkedPages(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d := NewDecoder(bufio.NewReader(bytes.NewReader(data)))
+		if _, err := d.VerifyOnly(); err != nil {
+			b.Fatal("unexpected VerifyOnly error:", err)
+		}
+	}
+}
+
+func TestVerifyOnly(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	for i := 0; i < 5; i++ {
+		if err := e.Encode(int64(i), [][]byte{[]byte("hello")}); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+	}
+	pagesz := b.Len() / 5
+
+	d := NewDecoder(bytes.NewReader(b.Bytes()))
+	pages, err := d.VerifyOnly()
+	if err != nil || pages != 5 {
+		t.Fatal("expected 5 valid pages, got", pages, err)
+	}
+	if d.Offset() != int64(b.Len()) {
+		t.Fatal("expected offset", b.Len(), "got", d.Offset())
+	}
+
+	// corrupt the third page
+	b.Bytes()[2*pagesz+headsz+1] = 'j'
+
+	d = NewDecoder(bytes.NewReader(b.Bytes()))
+	pages, err = d.VerifyOnly()
+	if _, ok := err.(ErrBadCrc); !ok || pages != 2 {
+		t.Fatal("expected ErrBadCrc after 2 pages, got", pages, err)
+	}
+
+	d = NewDecoder(bytes.NewReader(b.Bytes()))
+	d.SkipErrors = true
+	pages, err = d.VerifyOnly()
+	if _, ok := err.(ErrBadCrc); !ok || pages != 4 {
+		t.Fatal("expected ErrBadCrc with 4 valid pages, got", pages, err)
+	}
+
+	d = NewDecoder(bytes.NewReader(b.Bytes()[:b.Len()-1]))
+	d.SkipErrors = true
+	if _, err := d.VerifyOnly(); err != io.ErrUnexpectedEOF {
+		t.Fatal("expected io.ErrUnexpectedEOF, got", err)
+	}
+}
+
+func TestDecodeWithBuffer(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+
+	err := e.EncodeBOS(2, [][]byte{[]byte("hello")})
+	if err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+
+	_, err = NewDecoderWithBuffer(&b, make([]byte, maxPageSize-1))
+	if err != ErrBufferTooSmall {
+		t.Fatal("expected ErrBufferTooSmall, got:", err)
+	}
+
+	buf := make([]byte, maxPageSize)
+	d, err := NewDecoderWithBuffer(&b, buf)
+	if err != nil {
+		t.Fatal("unexpected NewDecoderWithBuffer error:", err)
+	}
+
+	p, _, err := d.Decode()
+	if err != nil {
+		t.Fatal("unexpected Decode error:", err)
+	}
+	if !bytes.Equal(p.Packets[0], []byte("hello")) {
+		t.Fatalf("unexpected packet: %q", p.Packets[0])
+	}
+	if &p.Packets[0][0] != &buf[headsz+1] {
+		t.Fatal("expected the packet to be decoded into the given buffer")
+	}
+}
+
+func TestPageTooLarge(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+
+	err := e.Encode(2, [][]byte{bytes.Repeat([]byte("x"), 200)})
+	if err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+
+	d := NewDecoder(&b)
+	// Shrink the buffer so the page's declared size overflows it.
+	d.buf = d.buf[:headsz+1+100]
+
+	_, _, err = d.Decode()
+	if tl, ok := err.(ErrPageTooLarge); !ok {
+		t.Fatal("expected ErrPageTooLarge, got:", err)
+	} else if tl.Size != headsz+1+200 {
+		t.Fatal("unexpected size:", tl.Size)
+	}
+}
+
+func TestAdversarialPageSizes(t *testing.T) {
+	// A header declaring the largest possible page, whose data then runs out.
+	h := []byte{'O', 'g', 'g', 'S', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 255}
+	tests := [][]byte{
+		append(append([]byte(nil), h...), bytes.Repeat([]byte{255}, 100)...),
+		append(append(append([]byte(nil), h...), bytes.Repeat([]byte{255}, 255)...), make([]byte, 1000)...),
+	}
+	for i, in := range tests {
+		d, err := NewDecoderWithBuffer(bytes.NewReader(in), make([]byte, 2*maxPageSize))
+		if err != nil {
+			t.Fatal("unexpected NewDecoderWithBuffer error:", err)
+		}
+		_, n, err := d.Decode()
+		if err != io.ErrUnexpectedEOF {
+			t.Fatalf("%d: expected io.ErrUnexpectedEOF, got %v", i, err)
+		}
+		if n != len(in) {
+			t.Fatalf("%d: expected %d bytes read, got %d", i, len(in), n)
+		}
+	}
+
+	// The largest possible page is fine, even with a larger buffer.
+	var b bytes.Buffer
+	if err := NewEncoder(1, &b).Encode(2, [][]byte{make([]byte, mps)}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	d, _ := NewDecoderWithBuffer(&b, make([]byte, 2*maxPageSize))
+	p, n, err := d.Decode()
+	if err != nil {
+		t.Fatal("unexpected Decode error:", err)
+	}
+	if n != maxPageSize || !p.Unfinished {
+		t.Fatalf("expected a full, unfinished page, got %d bytes", n)
+	}
+}
+
+func TestKeepRawPage(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.EncodeEOS(2, [][]byte{[]byte("hello"), []byte("world")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	for _, copyPackets := range []bool{false, true} {
+		d := NewDecoder(bytes.NewReader(b.Bytes()))
+		d.KeepRawPage = true
+		d.CopyPackets = copyPackets
+
+		var raw []byte
+		var packets [][]byte
+		for {
+			p, _, err := d.Decode()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal("unexpected Decode error:", err)
+			}
+			raw = append(raw, p.Raw...)
+			packets = append(packets, p.Packets...)
+		}
+		if !bytes.Equal(raw, b.Bytes()) {
+			t.Fatalf("copy %v: raw pages != encoded pages:\n%x\n%x", copyPackets, raw, b.Bytes())
+		}
+		if copyPackets && string(packets[1]) != "hello" {
+			t.Fatalf("copy %v: unexpected packet %q", copyPackets, packets[1])
+		}
+	}
+
+	p, _, err := NewDecoder(bytes.NewReader(b.Bytes())).Decode()
+	if err != nil {
+		t.Fatal("unexpected Decode error:", err)
+	}
+	if p.Raw != nil {
+		t.Fatal("expected no raw page without KeepRawPage")
+	}
+}
+
+func TestPeekSkipPage(t *testing.T) {
+	var b bytes.Buffer
+	e1 := NewEncoder(1, &b)
+	e2 := NewEncoder(2, &b)
+	for i, err := range []error{
+		e1.EncodeBOS(0, [][]byte{[]byte("one")}),
+		e2.EncodeBOS(0, [][]byte{[]byte("two")}),
+		e2.Encode(1, [][]byte{bytes.Repeat([]byte("x"), 1000)}),
+		e1.EncodeEOS(1, [][]byte{[]byte("done")}),
+		e2.EncodeEOS(2, [][]byte{[]byte("also done")}),
+	} {
+		if err != nil {
+			t.Fatalf("%d: unexpected encoding error: %v", i, err)
+		}
+	}
+	data := b.Bytes()
+
+	for _, wrap := range []func(io.Reader) io.Reader{
+		func(r io.Reader) io.Reader { return r },
+		func(r io.Reader) io.Reader { return bufio.NewReader(r) },
+	} {
+		d := NewDecoder(wrap(bytes.NewReader(data)))
+		var packets []string
+		var skipped []uint32
+		total := 0
+		for {
+			p, n, err := d.Peek()
+			total += n
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal("unexpected Peek error:", err)
+			}
+			if p.Packets != nil {
+				t.Fatal("expected Peek to return no packets")
+			}
+			if again, n, err := d.Peek(); err != nil || n != 0 || again.Sequence != p.Sequence || again.Serial != p.Serial {
+				t.Fatalf("expected the same page peeking again, got %+v, %d, %v", again, n, err)
+			}
+
+			if p.Serial == 1 {
+				dp, n, err := d.Decode()
+				total += n
+				if err != nil {
+					t.Fatal("unexpected Decode error:", err)
+				}
+				if dp.Serial != p.Serial || dp.Sequence != p.Sequence || dp.Type != p.Type {
+					t.Fatalf("decoded %+v after peeking %+v", dp, p)
+				}
+				packets = append(packets, string(dp.Packets[0]))
+			} else {
+				sp, n, err := d.SkipPage()
+				total += n
+				if err != nil {
+					t.Fatal("unexpected SkipPage error:", err)
+				}
+				if sp.Serial != p.Serial || sp.Sequence != p.Sequence {
+					t.Fatalf("skipped %+v after peeking %+v", sp, p)
+				}
+				skipped = append(skipped, sp.Sequence)
+			}
+			if d.Offset() != int64(total) {
+				t.Fatalf("offset %d, read %d bytes", d.Offset(), total)
+			}
+		}
+		if len(packets) != 2 || packets[0] != "one" || packets[1] != "done" {
+			t.Fatalf("unexpected packets: %q", packets)
+		}
+		if len(skipped) != 3 || total != len(data) {
+			t.Fatalf("skipped pages %v, read %d of %d bytes", skipped, total, len(data))
+		}
+	}
+
+	// without Peek, SkipPage reads the header itself
+	d := NewDecoder(bytes.NewReader(data))
+	p, n, err := d.SkipPage()
+	if err != nil || p.Serial != 1 || p.Type != BOS || n != headsz+1+3 {
+		t.Fatalf("unexpected SkipPage result: %+v, %d, %v", p, n, err)
+	}
+	p, _, err = d.Decode()
+	if err != nil || p.Serial != 2 || string(p.Packets[0]) != "two" {
+		t.Fatalf("unexpected Decode result: %+v, %v", p, err)
+	}
+
+	// a payload cut short
+	d = NewDecoder(bytes.NewReader(data[:headsz+1+2]))
+	if _, _, err := d.SkipPage(); err != io.ErrUnexpectedEOF {
+		t.Fatal("expected ErrUnexpectedEOF, got", err)
+	}
+}
+
+func TestFindNextPage(t *testing.T) {
+	// near misses, and capture patterns straddling the chunk boundaries
+	var b bytes.Buffer
+	b.WriteString("OgOggOgg")
+	b.Write(bytes.Repeat([]byte("x"), findChunkSize-10))
+	first := b.Len()
+	b.WriteString("OggS")
+	b.Write(bytes.Repeat([]byte("O"), 2*findChunkSize))
+	second := b.Len()
+	b.WriteString("OggSjunk")
+	data := b.Bytes()
+
+	readers := map[string]func() io.Reader{
+		"seeker":   func() io.Reader { return bytes.NewReader(data) },
+		"buffered": func() io.Reader { return bufio.NewReaderSize(bytes.NewReader(data), 16) },
+		"plain":    func() io.Reader { return iotest.HalfReader(struct{ io.Reader }{bytes.NewReader(data)}) },
+	}
+	for name, reader := range readers {
+		r := reader()
+		off, err := FindNextPage(r)
+		if err != nil || off != int64(first) {
+			t.Fatalf("%s: expected %d, got %d, %v", name, first, off, err)
+		}
+		if name == "plain" {
+			continue
+		}
+
+		// r is at the pattern: skip it to find the next
+		if _, err := io.ReadFull(r, make([]byte, 1)); err != nil {
+			t.Fatal("unexpected read error:", err)
+		}
+		off, err = FindNextPage(r)
+		if err != nil || off != int64(second-first-1) {
+			t.Fatalf("%s: expected %d, got %d, %v", name, second-first-1, off, err)
+		}
+		rest, _ := io.ReadAll(r)
+		if string(rest) != "OggSjunk" {
+			t.Fatalf("%s: expected the reader at the pattern, got %q", name, rest)
+		}
+	}
+
+	off, err := FindNextPage(strings.NewReader("xxOgg"))
+	if err != io.EOF || off != 5 {
+		t.Fatalf("expected EOF after 5 bytes, got %d, %v", off, err)
+	}
+}
+
+func TestAtLimit(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("header")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	first := b.Len()
+	if err := e.EncodeEOS(1, [][]byte{[]byte("data")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+	data := b.Bytes()
+
+	tests := []struct {
+		limit   int
+		err     error
+		atLimit bool
+	}{
+		{0, io.EOF, false},
+		{first, io.EOF, false},
+		{len(data), io.EOF, false},
+		{first + 10, io.ErrUnexpectedEOF, true},
+		// between the header and the segment table
+		{first + headsz, io.EOF, true},
+		{first + headsz + 2, io.ErrUnexpectedEOF, true},
+	}
+	for _, test := range tests {
+		d := NewDecoder(&io.LimitedReader{R: bytes.NewReader(data), N: int64(test.limit)})
+		var err error
+		var n int
+		for err == nil {
+			_, n, err = d.Decode()
+		}
+		if err != test.err || d.AtLimit() != test.atLimit {
+			t.Fatalf("limit %d: expected %v, %v, got %v, %v", test.limit, test.err, test.atLimit, err, d.AtLimit())
+		}
+		if test.atLimit && d.Offset()-int64(n) != int64(first) {
+			t.Fatalf("limit %d: expected the cut page to start at %d, got %d", test.limit, first, d.Offset()-int64(n))
+		}
+	}
+
+	// after Peek, a payload cut short
+	d := NewDecoder(&io.LimitedReader{R: bytes.NewReader(data), N: headsz + 1})
+	if _, _, err := d.Peek(); err != nil {
+		t.Fatal("unexpected Peek error:", err)
+	}
+	if _, _, err := d.Decode(); err != io.EOF || !d.AtLimit() {
+		t.Fatalf("expected EOF at the limit, got %v, %v", err, d.AtLimit())
+	}
+}
+
+func TestDuplicatePages(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("header")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	start := b.Len()
+	if err := e.Encode(1, [][]byte{[]byte("one")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	page := append([]byte(nil), b.Bytes()[start:]...)
+	// retransmitted
+	b.Write(page)
+	if err := e.EncodeEOS(2, [][]byte{[]byte("two")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+	data := b.Bytes()
+
+	d := NewDecoder(bytes.NewReader(data))
+	d.Conformance = ConformanceStrict
+	var dups []bool
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		dups = append(dups, p.Duplicate)
+	}
+	if len(dups) != 4 || dups[0] || dups[1] || !dups[2] || dups[3] {
+		t.Fatal("expected the third of four pages to be flagged, got", dups)
+	}
+
+	d = NewDecoder(bytes.NewReader(data))
+	d.Conformance = ConformanceStrict
+	d.DropDuplicates = true
+	var packets []string
+	total := 0
+	for {
+		p, err := d.DecodePacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected DecodePacket error:", err)
+		}
+		packets = append(packets, string(p.Data))
+	}
+	if strings.Join(packets, " ") != "header one two" {
+		t.Fatal("expected the duplicate's packet to be dropped, got", packets)
+	}
+
+	d = NewDecoder(bytes.NewReader(data))
+	d.DropDuplicates = true
+	for i := 0; i < 3; i++ {
+		p, n, err := d.Decode()
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		if p.Duplicate {
+			t.Fatal("returned a duplicate page")
+		}
+		total += n
+	}
+	if total != len(data) || d.Offset() != int64(len(data)) {
+		t.Fatalf("expected %d bytes consumed, got %d, offset %d", len(data), total, d.Offset())
+	}
+
+	// a page repeating only the sequence number is a gap, not a duplicate
+	bad := append([]byte(nil), data...)
+	bad[start+len(page)+headsz+1] = 'x'
+	byteOrder.PutUint32(bad[start+len(page)+22:], 0)
+	byteOrder.PutUint32(bad[start+len(page)+22:], crc32(bad[start+len(page):start+2*len(page)]))
+	d = NewDecoder(bytes.NewReader(bad))
+	d.Conformance = ConformanceStrict
+	d.DropDuplicates = true
+	var err error
+	for err == nil {
+		_, _, err = d.Decode()
+	}
+	if _, ok := err.(ErrSequenceGap); !ok {
+		t.Fatal("expected ErrSequenceGap, got", err)
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	var b bytes.Buffer
+	b.WriteString("junk")
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("header")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.EncodeEOS(1, [][]byte{bytes.Repeat([]byte{'x'}, 600), []byte("data")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	d := NewDecoder(bytes.NewReader(b.Bytes()))
+	d.KeepRawPage = true
+	total := 0
+	for i, junk := range []int{4, 0} {
+		peeked, _, err := d.Peek()
+		if err != nil {
+			t.Fatal("unexpected Peek error:", err)
+		}
+		p, _, err := d.Decode()
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		size := headsz + int(p.Raw[26])
+		for _, pkt := range p.Packets {
+			size += len(pkt)
+		}
+		if p.Size != size || p.Size != len(p.Raw) || peeked.Size != size {
+			t.Fatalf("%d: expected size %d, got %d, peeked %d", i, size, p.Size, peeked.Size)
+		}
+		total += p.Size + junk
+		if d.Offset() != int64(total) {
+			t.Fatalf("%d: expected offset %d, got %d", i, total, d.Offset())
+		}
+	}
+}
+
+func TestMaxPages(t *testing.T) {
+	var b bytes.Buffer
+	e1 := NewEncoder(1, &b)
+	e2 := NewEncoder(2, &b)
+	for i, err := range []error{
+		e1.EncodeBOS(0, nil),
+		e2.EncodeBOS(0, nil),
+		e1.Encode(1, nil),
+		e2.Encode(1, nil),
+		e1.EncodeEOS(2, nil),
+		e2.EncodeEOS(2, nil),
+	} {
+		if err != nil {
+			t.Fatalf("%d: unexpected encoding error: %v", i, err)
+		}
+	}
+
+	d := NewDecoder(bytes.NewReader(b.Bytes()))
+	d.MaxPages = 5
+	for i := 0; i < 5; i++ {
+		if _, _, err := d.Decode(); err != nil {
+			t.Fatalf("page %d: unexpected Decode error: %v", i, err)
+		}
+	}
+	offset := d.Offset()
+	if _, n, err := d.Decode(); err != ErrTooManyPages || n != 0 {
+		t.Fatalf("expected ErrTooManyPages, got %d, %v", n, err)
+	}
+	if d.Offset() != offset {
+		t.Fatal("read past the limit")
+	}
+
+	d.Reset(bytes.NewReader(b.Bytes()))
+	var err error
+	packets := 0
+	for err == nil {
+		_, err = d.DecodePacket()
+		packets++
+	}
+	if err != ErrTooManyPages || packets != 6 {
+		t.Fatalf("expected ErrTooManyPages after 5 packets, got %v after %d", err, packets-1)
+	}
+}
+
+func TestMultiReaderDecode(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	long := bytes.Repeat([]byte{'l'}, 2*mss)
+	for i, err := range []error{
+		e.EncodeBOS(0, [][]byte{[]byte("head")}),
+		// a packet continued on the next page
+		e.EncodePage(Page{Serial: 1, Granule: -1, Packets: [][]byte{[]byte("a"), long[:mss]}, Unfinished: true}),
+		e.EncodePage(Page{Type: COP, Serial: 1, Granule: 2, Packets: [][]byte{long[mss:], []byte("b")}}),
+		e.EncodeEOS(3, [][]byte{[]byte("c")}),
+	} {
+		if err != nil {
+			t.Fatalf("%d: unexpected encoding error: %v", i, err)
+		}
+	}
+	stream := b.Bytes()
+	expected := []string{"head", "a", string(long), "b", "c"}
+
+	for i := 0; i <= len(stream); i++ {
+		for _, buffered := range []bool{false, true} {
+			var r io.Reader = io.MultiReader(bytes.NewReader(stream[:i]), bytes.NewReader(stream[i:]))
+			if buffered {
+				r = bufio.NewReaderSize(r, 64)
+			}
+			d := NewDecoder(r)
+			d.Conformance = ConformanceStrict
+			var got []string
+			for {
+				pkt, err := d.DecodePacket()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("split at %d: unexpected DecodePacket error: %v", i, err)
+				}
+				got = append(got, string(pkt.Data))
+			}
+			if len(got) != len(expected) {
+				t.Fatalf("split at %d: expected %d packets, got %d", i, len(expected), len(got))
+			}
+			for j := range expected {
+				if got[j] != expected[j] {
+					t.Fatalf("split at %d: packet %d differs", i, j)
+				}
+			}
+		}
+	}
+}
+
+func TestPageType(t *testing.T) {
+	for _, test := range []struct {
+		typ            byte
+		bos, eos, cont bool
+		s              string
+	}{
+		{0, false, false, false, "none"},
+		{BOS, true, false, false, "BOS"},
+		{COP | EOS, false, true, true, "COP|EOS"},
+		{BOS | EOS, true, true, false, "BOS|EOS"},
+		{COP | 0x18, false, false, true, "COP|0x18"},
+	} {
+		p := Page{Type: test.typ}
+		if p.IsBOS() != test.bos || p.IsEOS() != test.eos || p.IsContinuation() != test.cont {
+			t.Fatalf("type %d: expected BOS %v, EOS %v, COP %v", test.typ, test.bos, test.eos, test.cont)
+		}
+		if s := p.TypeString(); s != test.s {
+			t.Fatalf("type %d: expected %q, got %q", test.typ, test.s, s)
+		}
+	}
+}
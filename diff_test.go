@@ -0,0 +1,47 @@
+package ogg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDiffPages(t *testing.T) {
+	encode := func(granule int64, last []byte) []byte {
+		var b bytes.Buffer
+		e := NewEncoder(1, &b)
+		if err := e.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+			t.Fatal("unexpected EncodeBOS error:", err)
+		}
+		if err := e.Encode(granule, [][]byte{[]byte("one"), last}); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+		return b.Bytes()
+	}
+	base := encode(10, []byte("two"))
+
+	for _, test := range []struct {
+		b    []byte
+		want *PageDiff
+	}{
+		{base, nil},
+		{encode(11, []byte("two")), &PageDiff{1, 32, 32, "granule", "10", "11"}},
+		{encode(10, []byte("three")), &PageDiff{1, 32, 32, "lacing", "1:3", "1:5"}},
+		{encode(10, []byte("twx")), &PageDiff{1, 32, 32, "payload", "5:111", "5:120"}},
+		{base[:32], &PageDiff{1, 32, 32, "pages", "page", "end"}},
+		{append([]byte("junk"), base...), nil},
+	} {
+		diff, err := DiffPages(bytes.NewReader(base), bytes.NewReader(test.b))
+		if err != nil {
+			t.Fatal("unexpected DiffPages error:", err)
+		}
+		if test.want == nil {
+			if diff != nil {
+				t.Fatal("expected no difference, got", diff)
+			}
+			continue
+		}
+		if diff == nil || *diff != *test.want {
+			t.Fatalf("expected %v, got %v", test.want, diff)
+		}
+	}
+}
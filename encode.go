@@ -2,17 +2,41 @@ package ogg
 
 import (
 	"bytes"
-	"encoding/binary"
+	"errors"
 	"io"
 )
 
 // An Encoder encodes raw bytes into an ogg stream.
 type Encoder struct {
-	serial uint32
-	page   uint32
-	dummy  [1][]byte // convenience field to handle nil packets args without allocating
-	w      io.Writer
-	buf    [maxPageSize]byte
+	// Strict makes EncodePage validate pages before encoding them.
+	Strict bool
+
+	// RenumberRawPages makes WriteRawPage give pages of w's logical stream w's next sequence numbers,
+	// instead of writing them as is. Pages of other logical streams are still written as is.
+	RenumberRawPages bool
+
+	// AllowSegmentMismatch makes EncodeRaw write payloads whose length doesn't match the segment table.
+	AllowSegmentMismatch bool
+
+	// OnePacketPerPage makes EncodeBOS, Encode, EncodeEOS, and EncodePackets put each packet
+	// on pages of its own, even if more would fit, for simple decoders that expect one packet per page;
+	// a packet too long for a page is still continued across as many as it needs.
+	// Every page costs at least 28 bytes of header, so a stream of small packets grows considerably:
+	// 20-byte packets, say, take 48 bytes each rather than about 21.
+	// EncodeBOS, Encode, and EncodeEOS give all their packets a single granule position,
+	// which can't be right for each of their pages, so they take only one packet with it set,
+	// or the error is ErrPacketGranules; use EncodePackets to write several.
+	OnePacketPerPage bool
+
+	serial  uint32
+	page    uint32
+	granule int64
+	dummy   [1][]byte // convenience field to handle nil packets args without allocating
+	w       io.Writer
+	buf     [maxPageSize]byte
+
+	// whether pages of the stream have been written since its EOS page, if any
+	open bool
 }
 
 // NewEncoder creates an ogg encoder with the given serial ID.
@@ -31,6 +55,33 @@ func NewEncoder(id uint32, w io.Writer) *Encoder {
 	return &Encoder{serial: id, w: w}
 }
 
+// SetSequence sets the page sequence number of the next page written by w,
+// after which numbering continues from there.
+// This is useful for resuming an interrupted stream without a gap in the sequence.
+func (w *Encoder) SetSequence(seq uint32) {
+	w.page = seq
+}
+
+// BeginChain starts a new logical stream with the given serial number, chained after w's current one,
+// so that w's next page is the new stream's first, numbered 0, which should be a BOS page.
+// This lets one Encoder write a chained stream, such as of several tracks.
+// The error is an ErrStreamBoundary if the current stream hasn't ended with an EOS page,
+// as it must before the next begins.
+func (w *Encoder) BeginChain(serial uint32) error {
+	if w.open {
+		return ErrStreamBoundary{w.serial, "missing EOS page"}
+	}
+	w.serial = serial
+	w.page = 0
+	w.granule = 0
+	return nil
+}
+
+// Granule returns the granule position of the last page written by w.
+func (w *Encoder) Granule() int64 {
+	return w.granule
+}
+
 // EncodeBOS writes a beginning-of-stream packet to the ogg stream,
 // using the provided granule position.
 // If the packets are larger than can fit in a page, the payload is split into multiple
@@ -40,7 +91,7 @@ func (w *Encoder) EncodeBOS(granule int64, packets [][]byte) error {
 	if len(packets) == 0 {
 		packets = w.dummy[:]
 	}
-	return w.writePackets(BOS, granule, packets)
+	return w.writeEach(BOS, granule, nil, packets)
 }
 
 // Encode writes a data packet to the ogg stream,
@@ -48,11 +99,22 @@ func (w *Encoder) EncodeBOS(granule int64, packets [][]byte) error {
 // If the packet is larger than can fit in a page, it is split into multiple
 // pages with the continuation-of-packet flag set.
 // Packets can be empty or nil, in which one segment of size 0 is encoded.
+//
+// Nothing is buffered between calls: the pages are written before Encode returns,
+// the last ending with the last packet, so each call forces a page boundary after its packets,
+// as for aligning segments to keyframes, however little they fill the page.
+// Only that boundary is forced: when the packets need more than one page,
+// the pages before the last are filled to their 255 segments, and may end partway through a packet.
+// To end a page after each of several packets, encode them in separate calls.
+//
+// Every page on which a packet ends takes the granule position; the pages before the last
+// on which none does, as in the middle of a long packet, take -1, as the ogg format requires.
+// The same goes for EncodeBOS, EncodeEOS, and EncodePage.
 func (w *Encoder) Encode(granule int64, packets [][]byte) error {
 	if len(packets) == 0 {
 		packets = w.dummy[:]
 	}
-	return w.writePackets(0, granule, packets)
+	return w.writeEach(0, granule, nil, packets)
 }
 
 // EncodeEOS writes an end-of-stream packet to the ogg stream.
@@ -61,61 +123,470 @@ func (w *Encoder) EncodeEOS(granule int64, packets [][]byte) error {
 	if len(packets) == 0 {
 		packets = w.dummy[:]
 	}
-	return w.writePackets(EOS, granule, packets)
+	return w.writeEach(EOS, granule, nil, packets)
+}
+
+// EncodePackets writes packets to the ogg stream, each with its own granule position,
+// filling pages as full as they go.
+// Each page takes the granule position of the last packet that ends on it,
+// as the ogg format defines, or -1 if none does because a long packet spans the page.
+// So where a packet's granule position lands depends on how the packets fill the pages;
+// use Encode to force a page boundary after a packet.
+// The first page is a BOS page if the first packet's BOS field is set,
+// and the last an EOS page if the last packet's EOS field is.
+// The packets' other fields are ignored.
+func (w *Encoder) EncodePackets(packets []Packet) error {
+	if len(packets) == 0 {
+		return nil
+	}
+
+	var kind byte
+	if packets[0].BOS {
+		kind |= BOS
+	}
+	if packets[len(packets)-1].EOS {
+		kind |= EOS
+	}
+
+	data := make([][]byte, len(packets))
+	granules := make([]int64, len(packets))
+	for i, p := range packets {
+		data[i] = p.Data
+		granules[i] = p.Granule
+	}
+	return w.writeEach(kind, -1, granules, data)
+}
+
+// streamChunkSize is the size of the chunks EncodeStream reads.
+const streamChunkSize = 32 << 10
+
+// EncodeStream reads an elementary stream from r, splits it into packets with framer,
+// and writes them to the ogg stream, as a whole logical stream:
+// the first page is a BOS page and the last an EOS page.
+// This is the inverse of RawPacketReader, for codecs whose framing the caller supplies.
+//
+// EncodeStream calls framer with each chunk it reads from r, in order,
+// and framer returns the packets completed so far, buffering any incomplete remainder itself
+// until later chunks complete it. Once r is exhausted, framer is called with an empty chunk
+// to return whatever packets remain. The chunk is only valid during the call,
+// so framer must copy what it buffers, but the packets it returns may alias the chunk.
+// An error from framer stops EncodeStream, which returns it.
+//
+// Not knowing the codec, EncodeStream gives each page the granule position of
+// the number of packets completed by the end of the page.
+func (w *Encoder) EncodeStream(r io.Reader, framer func([]byte) ([][]byte, error)) error {
+	// The latest packet is held back, to be written with EOS if it's the last.
+	var held []byte
+	holding := false
+	first := true
+	count := int64(0)
+	emit := func(packets [][]byte, last bool) error {
+		if holding {
+			packets = append([][]byte{held}, packets...)
+		}
+		holding = !last
+		if holding {
+			// copied, since it must outlive the chunk
+			held = append([]byte(nil), packets[len(packets)-1]...)
+			packets = packets[:len(packets)-1]
+		}
+		if len(packets) == 0 {
+			return nil
+		}
+
+		batch := make([]Packet, len(packets))
+		for i, p := range packets {
+			count++
+			batch[i] = Packet{Data: p, Granule: count}
+		}
+		batch[0].BOS = first
+		batch[len(batch)-1].EOS = last
+		first = false
+		return w.EncodePackets(batch)
+	}
+
+	buf := make([]byte, streamChunkSize)
+	for {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			packets, err := framer(buf[:n])
+			if err != nil {
+				return err
+			}
+			if len(packets) > 0 {
+				if err := emit(packets, false); err != nil {
+					return err
+				}
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+
+	packets, err := framer(buf[:0])
+	if err != nil {
+		return err
+	}
+	return emit(packets, true)
+}
+
+// Errors returned by Page.Validate.
+var (
+	ErrPageNoSerial   = errors.New("page has serial number 0")
+	ErrPageNoPackets  = errors.New("page has no packets")
+	ErrPageFlags      = errors.New("page has inconsistent type flags")
+	ErrPageUnfinished = errors.New("page's unfinished packet is not a nonzero multiple of 255 bytes")
+)
+
+// Validate checks a Page constructed for encoding for likely programming errors,
+// returning ErrPageNoSerial if its Serial is 0, which is legal but usually means it was left unset,
+// ErrPageNoPackets if it has no packets, ErrPageFlags if its Type has bits other than COP, BOS, and EOS,
+// or is both BOS and COP, since a stream can't start with a continued packet,
+// ErrPageUnfinished if it's Unfinished but its last packet couldn't be,
+// or ErrPageTooLarge if it's both BOS and EOS, so must fit in a page, but doesn't.
+func (p Page) Validate() error {
+	if p.Serial == 0 {
+		return ErrPageNoSerial
+	}
+	if len(p.Packets) == 0 {
+		return ErrPageNoPackets
+	}
+	if p.Type&^(COP|BOS|EOS) != 0 || p.Type&(BOS|COP) == BOS|COP {
+		return ErrPageFlags
+	}
+	if last := p.Packets[len(p.Packets)-1]; p.Unfinished && (len(last) == 0 || len(last)%mss != 0) {
+		return ErrPageUnfinished
+	}
+	if p.Type&(BOS|EOS) == BOS|EOS {
+		nsegs, size := 0, 0
+		for _, pkt := range p.Packets {
+			nsegs += len(pkt)/mss + 1
+			size += len(pkt)
+		}
+		if nsegs > mss {
+			return ErrPageTooLarge{headsz + nsegs + size}
+		}
+	}
+	return nil
+}
+
+// EncodePage writes p's packets to the ogg stream with its type flags and granule position,
+// in w's logical stream regardless of p.Serial, and w's sequence regardless of p.Sequence.
+// If p.Unfinished is set, its last packet is left to be continued by the next page.
+// If the packets are larger than can fit in a page, they're split as by Encode.
+// If w.Strict is set, p is validated first, and not written if invalid.
+//
+// A page returned by Decode is re-encoded byte for byte, lacing values and all,
+// as long as w's sequence number matches the page's, as it does for a logical stream
+// numbered from 0 and written to its own Encoder in order, or after SetSequence,
+// and the page's stream structure version is 0, the only version EncodePage writes.
+// Transmux does this for a whole stream.
+func (w *Encoder) EncodePage(p Page) error {
+	if w.Strict {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	packets := p.Packets
+	if len(packets) == 0 {
+		packets = w.dummy[:]
+	}
+	return w.writePackets(p.Type, p.Granule, nil, packets, p.Unfinished)
+}
+
+// ErrMixedSerials is the error used by EncodePages when pages of several logical streams
+// are given without allowing multiplexing.
+var ErrMixedSerials = errors.New("pages have different serial numbers")
+
+// EncodePages writes pages to w as by EncodePage, with an Encoder per logical stream,
+// so each stream's pages are numbered in sequence from 0 and given correct CRCs,
+// whatever their Sequence fields.
+// Unless multiplexed is set, the pages must all have the same Serial, or the error is ErrMixedSerials.
+// Each logical stream's pages must begin with a BOS page and end with an EOS page,
+// with no other BOS or EOS pages; if not, the error is an ErrStreamBoundary.
+// The pages are checked before any is written.
+func EncodePages(w io.Writer, pages []Page, multiplexed bool) error {
+	ended := make(map[uint32]bool)
+	for _, p := range pages {
+		if p.Serial != pages[0].Serial && !multiplexed {
+			return ErrMixedSerials
+		}
+		eos, started := ended[p.Serial]
+		switch {
+		case !started && p.Type&BOS == 0:
+			return ErrStreamBoundary{p.Serial, "missing BOS page"}
+		case started && p.Type&BOS != 0:
+			return ErrStreamBoundary{p.Serial, "repeated BOS page"}
+		case eos:
+			return ErrStreamBoundary{p.Serial, "page after EOS page"}
+		}
+		ended[p.Serial] = p.Type&EOS != 0
+	}
+	for serial, eos := range ended {
+		if !eos {
+			return ErrStreamBoundary{serial, "missing EOS page"}
+		}
+	}
+
+	encoders := make(map[uint32]*Encoder)
+	for _, p := range pages {
+		e := encoders[p.Serial]
+		if e == nil {
+			e = NewEncoder(p.Serial, w)
+			encoders[p.Serial] = e
+		}
+		if err := e.EncodePage(p); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (w *Encoder) writePackets(kind byte, granule int64, packets [][]byte) error {
+// ErrSegmentMismatch is the error used by EncodeRaw when a payload's length isn't the sum of the segment table.
+var ErrSegmentMismatch = errors.New("payload length does not match segment table")
+
+// EncodeRaw writes a page with exactly the given header type, granule position, serial number,
+// segment table, and payload data, giving it w's next sequence number and computing its CRC,
+// but otherwise bypassing w's lacing, for crafting edge cases such as invalid pages to test decoders with.
+// The only checks are that the segment table has at most 255 entries, or the error is ErrTooManySegments,
+// and that the length of data is the sum of its lacing values, or the error is ErrSegmentMismatch,
+// unless w.AllowSegmentMismatch is set.
+// The page must still fit in 65307 bytes, or the error is ErrPageTooLarge.
+func (w *Encoder) EncodeRaw(headerType byte, granule int64, serial uint32, segtable, data []byte) error {
+	if len(segtable) > 255 {
+		return ErrTooManySegments
+	}
+	sum := 0
+	for _, l := range segtable {
+		sum += int(l)
+	}
+	if sum != len(data) && !w.AllowSegmentMismatch {
+		return ErrSegmentMismatch
+	}
+	if size := headsz + len(segtable) + len(data); size > maxPageSize {
+		return ErrPageTooLarge{size}
+	}
+
 	h := pageHeader{
 		OggS:       [4]byte{'O', 'g', 'g', 'S'},
-		HeaderType: kind,
-		Serial:     w.serial,
+		HeaderType: headerType,
 		Granule:    granule,
+		Serial:     serial,
 	}
+	copy(w.buf[headsz:], segtable)
+	return w.writePage(&h, w.buf[headsz:headsz+len(segtable)], payload{data, nil, nil})
+}
 
-	// Write the lacing values before filling in their quantity
-	segtbl, car, cdr := w.segmentize(payload{packets[0], packets[1:], nil})
-	err := w.writePage(&h, segtbl, car)
-	if err != nil {
-		return err
+// ErrBadRawPage is the error used when a raw page given to WriteRawPage isn't a single whole page.
+var ErrBadRawPage = errors.New("not a single whole page")
+
+// WriteRawPage writes raw, the bytes of a whole page such as Page.Raw, to the ogg stream.
+// The page is written as is, for an exact copy, and if it belongs to w's logical stream,
+// w continues its sequence numbering after the page's, and its granule position becomes the page's.
+// If w.RenumberRawPages is set and the page belongs to w's logical stream, it's instead given
+// w's next sequence number and its CRC recomputed, as for splicing pages into another stream,
+// and w's granule position becomes the page's; raw itself isn't modified.
+// Pages of other logical streams are never renumbered, as w's sequence numbers aren't theirs.
+func (w *Encoder) WriteRawPage(raw []byte) error {
+	size, ok := pageSize(raw)
+	if !ok || len(raw) != size || !bytes.HasPrefix(raw, oggs) {
+		return ErrBadRawPage
 	}
 
-	h.HeaderType |= COP
-	for len(cdr.leftover) > 0 {
-		segtbl, car, cdr = w.segmentize(cdr)
-		err = w.writePage(&h, segtbl, car)
-		if err != nil {
+	serial := byteOrder.Uint32(raw[14:18])
+	if w.RenumberRawPages && serial == w.serial {
+		b := w.buf[:size]
+		copy(b, raw)
+		byteOrder.PutUint32(b[18:22], w.page)
+		byteOrder.PutUint32(b[22:26], 0)
+		byteOrder.PutUint32(b[22:26], crc32(b))
+		if _, err := w.w.Write(b); err != nil {
 			return err
 		}
+		w.page++
+		w.granule = int64(byteOrder.Uint64(raw[6:14]))
+		w.open = raw[5]&EOS == 0
+		return nil
+	}
+
+	if _, err := w.w.Write(raw); err != nil {
+		return err
 	}
+	if serial == w.serial {
+		w.page = byteOrder.Uint32(raw[18:22]) + 1
+		w.granule = int64(byteOrder.Uint64(raw[6:14]))
+		w.open = raw[5]&EOS == 0
+	}
+	return nil
+}
+
+// ErrPacketGranules is the error used when packets sharing one granule position are to be put
+// on pages of their own, as with Encoder.OnePacketPerPage.
+var ErrPacketGranules = errors.New("several packets given one granule position")
 
+// writeEach writes packets as writePackets does, but each to pages of its own if w.OnePacketPerPage is set,
+// in which case granules must be given for more than one packet.
+func (w *Encoder) writeEach(kind byte, granule int64, granules []int64, packets [][]byte) error {
+	if !w.OnePacketPerPage {
+		return w.writePackets(kind, granule, granules, packets, false)
+	}
+	if granules == nil && len(packets) > 1 {
+		return ErrPacketGranules
+	}
+	for i := range packets {
+		k := kind
+		if i > 0 {
+			k &^= BOS
+		}
+		if i < len(packets)-1 {
+			k &^= EOS
+		}
+		var g []int64
+		if granules != nil {
+			g = granules[i : i+1]
+		}
+		if err := w.writePackets(k, granule, g, packets[i:i+1], false); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// writePackets writes packets to as many pages as they need.
+// BOS in kind is only set on the first page, and EOS only on the last.
+// If granules is nil, each page's granule position is granule, except -1 for pages before the last
+// on which no packet ends; otherwise it's the element of granules for the last packet completed on the page,
+// or -1 if none is.
+func (w *Encoder) writePackets(kind byte, granule int64, granules []int64, packets [][]byte, unfinished bool) error {
+	h := pageHeader{
+		OggS:    [4]byte{'O', 'g', 'g', 'S'},
+		Serial:  w.serial,
+		Granule: granule,
+	}
+
+	// Write the lacing values before filling in their quantity
+	segtbl, car, cdr, more := w.segmentize(payload{packets[0], packets[1:], nil})
+	h.HeaderType = kind &^ EOS
+	completed := 0
+	for {
+		// An unfinished last packet goes without the lacing value that would end it.
+		if unfinished && len(packets[len(packets)-1]) > 0 {
+			if more && len(cdr.leftover) == 0 && len(cdr.packets) == 0 {
+				more = false
+			} else if !more && segtbl[len(segtbl)-1] == 0 {
+				segtbl = segtbl[:len(segtbl)-1]
+			}
+		}
+		if !more {
+			h.HeaderType |= kind & EOS
+		}
+
+		if granules != nil {
+			h.Granule = -1
+			for _, l := range segtbl {
+				if l < mss {
+					h.Granule = granules[completed]
+					completed++
+				}
+			}
+		} else if more {
+			// A page before the last on which no packet ends has no granule position.
+			h.Granule = -1
+			for _, l := range segtbl {
+				if l < mss {
+					h.Granule = granule
+					break
+				}
+			}
+		} else {
+			h.Granule = granule
+		}
+
+		err := w.writePage(&h, segtbl, car)
+		if err != nil || !more {
+			return err
+		}
+
+		h.HeaderType = 0
+		if segtbl[len(segtbl)-1] == mss {
+			h.HeaderType = COP
+		}
+		segtbl, car, cdr, more = w.segmentize(cdr)
+	}
+}
+
+// writePage writes a page to w's Writer in a single Write,
+// assembling it in w's buffer, where segtbl already is.
 func (w *Encoder) writePage(h *pageHeader, segtbl []byte, pay payload) error {
 	h.Page = w.page
 	w.page++
+	w.granule = h.Granule
+	w.open = h.HeaderType&EOS == 0
 	h.Nsegs = byte(len(segtbl))
-	hb := bytes.NewBuffer(w.buf[0:0:cap(w.buf)])
-	_ = binary.Write(hb, byteOrder, h)
 
-	// segtbl is already written in the buffer,
-	// but the writer needs to move along anyhow
-	hb.Write(segtbl)
+	b := w.buf[:]
+	copy(b[0:4], h.OggS[:])
+	b[4] = h.StreamVersion
+	b[5] = h.HeaderType
+	byteOrder.PutUint64(b[6:14], uint64(h.Granule))
+	byteOrder.PutUint32(b[14:18], h.Serial)
+	byteOrder.PutUint32(b[18:22], h.Page)
+	byteOrder.PutUint32(b[22:26], 0)
+	b[26] = h.Nsegs
 
-	hb.Write(pay.leftover)
+	n := headsz + len(segtbl)
+	n += copy(b[n:], pay.leftover)
 	for _, p := range pay.packets {
-		hb.Write(p)
+		n += copy(b[n:], p)
 	}
-	hb.Write(pay.rightover)
+	n += copy(b[n:], pay.rightover)
 
-	bb := hb.Bytes()
-	crc := crc32(bb)
-	_ = binary.Write(bytes.NewBuffer(bb[22:22:26]), byteOrder, crc)
+	byteOrder.PutUint32(b[22:26], crc32(b[:n]))
 
-	_, err := hb.WriteTo(w.w)
+	_, err := w.w.Write(b[:n])
 	return err
 }
 
+// ErrTooManySegments is the error used by BuildSegmentTable when the packets need more than 255 segments.
+var ErrTooManySegments = errors.New("more than 255 segments")
+
+// ErrNegativePacketLength is the error used by BuildSegmentTable when a packet length is negative.
+var ErrNegativePacketLength = errors.New("negative packet length")
+
+// BuildSegmentTable returns the segment table of a page holding packets of the given lengths.
+// Each packet is laced as a run of 255s, one for each whole 255 bytes,
+// followed by the remainder, which is 0 for a length that's a multiple of 255,
+// since a lacing value of 255 means the packet continues.
+// A packet continued from the previous page is laced the same,
+// given the length of its part on this page.
+// To leave the last packet unfinished, to be continued on the next page,
+// drop the final 0 of a table for a length that's a multiple of 255.
+func BuildSegmentTable(packetLens []int) ([]byte, error) {
+	nsegs := 0
+	for _, n := range packetLens {
+		if n < 0 {
+			return nil, ErrNegativePacketLength
+		}
+		nsegs += n/mss + 1
+	}
+	if nsegs > mss {
+		return nil, ErrTooManySegments
+	}
+
+	segtbl := make([]byte, 0, nsegs)
+	for _, n := range packetLens {
+		for ; n >= mss; n -= mss {
+			segtbl = append(segtbl, mss)
+		}
+		segtbl = append(segtbl, byte(n))
+	}
+	return segtbl, nil
+}
+
 // payload represents a potentially-split group of packets.
 // For the "left" portion of a split,
 // rightover is the beginning portion of the *last* packet,
@@ -143,8 +614,11 @@ type payload struct {
 // It returns the segment table (sized appropriately),
 // the payload to write with the segment table in the current page,
 // and any leftover payload that remains due to not fitting in a page.
-func (w *Encoder) segmentize(pay payload) ([]byte, payload, payload) {
-	segtbl := w.buf[headsz : headsz+mss]
+// The leftover payload must be written if more is set, even if it's empty:
+// a packet whose length is a multiple of 255 that fills the page
+// still needs the 0 lacing value that ends it.
+func (w *Encoder) segmentize(pay payload) (segtbl []byte, good, bad payload, more bool) {
+	segtbl = w.buf[headsz : headsz+mss]
 	i := 0
 
 	s255s := len(pay.leftover) / mss
@@ -159,9 +633,9 @@ func (w *Encoder) segmentize(pay payload) ([]byte, payload, payload) {
 		i++
 	} else {
 		leftStart := len(pay.leftover) - (s255s * mss) - rem
-		good := payload{pay.leftover[0:leftStart], nil, nil}
-		bad := payload{pay.leftover[leftStart:], pay.packets, nil}
-		return segtbl, good, bad
+		good = payload{pay.leftover[0:leftStart], nil, nil}
+		bad = payload{pay.leftover[leftStart:], pay.packets, nil}
+		return segtbl, good, bad, true
 	}
 
 	// Now loop through the rest and track if we need to split
@@ -178,13 +652,11 @@ func (w *Encoder) segmentize(pay payload) ([]byte, payload, payload) {
 			i++
 		} else {
 			right := len(pay.packets[p]) - (s255s * mss) - rem
-			good := payload{pay.leftover, pay.packets[0:p], pay.packets[p][0:right]}
-			bad := payload{pay.packets[p][right:], pay.packets[p+1:], nil}
-			return segtbl, good, bad
+			good = payload{pay.leftover, pay.packets[0:p], pay.packets[p][0:right]}
+			bad = payload{pay.packets[p][right:], pay.packets[p+1:], nil}
+			return segtbl, good, bad, true
 		}
 	}
 
-	good := pay
-	bad := payload{}
-	return segtbl[0:i], good, bad
+	return segtbl[0:i], pay, payload{}, false
 }
@@ -2,8 +2,13 @@ package ogg
 
 import (
 	"bytes"
+	"errors"
 	"io"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestBasicEncodeBOS(t *testing.T) {
@@ -189,10 +194,11 @@ func TestLongEncode(t *testing.T) {
 		'O', 'g', 'g', 'S',
 		0,
 		0,
-		2, 0, 0, 0, 0, 0, 0, 0,
+		// no packet ends on the page
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
 		1, 0, 0, 0,
 		0, 0, 0, 0,
-		0xee, 0xb2, 0x0b, 0xca, // crc
+		0xf6, 0x57, 0x1d, 0x19, // crc
 		255,
 	}
 
@@ -204,16 +210,32 @@ func TestLongEncode(t *testing.T) {
 		'O', 'g', 'g', 'S',
 		0,
 		COP,
-		2, 0, 0, 0, 0, 0, 0, 0,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
 		1, 0, 0, 0,
 		1, 0, 0, 0,
-		0x17, 0x0d, 0xe6, 0xe6, // crc
+		0x0f, 0xe8, 0xf0, 0x35, // crc
 		255,
 	}
 
 	if !bytes.Equal(bb[maxPageSize:maxPageSize+headsz], expect2) {
 		t.Fatalf("bytes != expected:\n%x\n%x", bb[maxPageSize:maxPageSize+headsz], expect2)
 	}
+
+	// the packet ends on the last page, which takes the granule position
+	expect3 := []byte{
+		'O', 'g', 'g', 'S',
+		0,
+		COP,
+		2, 0, 0, 0, 0, 0, 0, 0,
+		1, 0, 0, 0,
+		2, 0, 0, 0,
+		0x36, 0xd5, 0x2d, 0x47, // crc
+		3,
+	}
+
+	if !bytes.Equal(bb[2*maxPageSize:2*maxPageSize+headsz], expect3) {
+		t.Fatalf("bytes != expected:\n%x\n%x", bb[2*maxPageSize:2*maxPageSize+headsz], expect3)
+	}
 }
 
 type limitedWriter struct {
@@ -248,3 +270,837 @@ func TestShortWrites(t *testing.T) {
 		t.Fatal("expected ErrClosedPipe, got:", err)
 	}
 }
+
+func TestSetSequence(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	e.SetSequence(41)
+
+	err := e.Encode(2, [][]byte{[]byte("hello")})
+	if err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	err = e.Encode(3, [][]byte{[]byte("there")})
+	if err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+
+	bb := b.Bytes()
+	if seq := byteOrder.Uint32(bb[18:22]); seq != 41 {
+		t.Fatal("expected first sequence number 41, got", seq)
+	}
+	if seq := byteOrder.Uint32(bb[headsz+1+5+18:]); seq != 42 {
+		t.Fatal("expected second sequence number 42, got", seq)
+	}
+}
+
+func TestExactMultipleLacing(t *testing.T) {
+	for _, n := range []int{255, 510, mps} {
+		var b bytes.Buffer
+		e := NewEncoder(1, &b)
+		pkt := bytes.Repeat([]byte{'x'}, n)
+		err := e.Encode(2, [][]byte{pkt, []byte("after")})
+		if err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+
+		if n < mps {
+			nsegs := int(b.Bytes()[26])
+			if nsegs != n/mss+2 || b.Bytes()[headsz+n/mss] != 0 {
+				t.Fatalf("%d bytes: expected a 0 lacing value after %d 255s", n, n/mss)
+			}
+		}
+
+		d := NewDecoder(&b)
+		d.CopyPackets = true
+		var packets [][]byte
+		for {
+			p, err := d.DecodePacket()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal("unexpected DecodePacket error:", err)
+			}
+			packets = append(packets, p.Data)
+		}
+		if len(packets) != 2 || !bytes.Equal(packets[0], pkt) || string(packets[1]) != "after" {
+			t.Fatalf("%d bytes: packets did not round-trip: got %d packets", n, len(packets))
+		}
+	}
+}
+
+func TestEncodeAllocs(t *testing.T) {
+	e := NewEncoder(1, io.Discard)
+	packets := [][]byte{[]byte("hello"), []byte("world")}
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := e.Encode(2, packets); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatal("expected no allocations per Encode, got", allocs)
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	e := NewEncoder(1, io.Discard)
+	packets := [][]byte{make([]byte, 100)}
+	b.ReportAllocs()
+	b.SetBytes(100)
+	for i := 0; i < b.N; i++ {
+		if err := e.Encode(int64(i), packets); err != nil {
+			b.Fatal("unexpected Encode error:", err)
+		}
+	}
+}
+
+func TestWriteRawPage(t *testing.T) {
+	var src bytes.Buffer
+	if err := NewEncoder(1, &src).EncodeBOS(5, [][]byte{[]byte("hello")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	raw := src.Bytes()
+
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.WriteRawPage(raw); err != nil {
+		t.Fatal("unexpected WriteRawPage error:", err)
+	}
+	if err := e.Encode(6, [][]byte{[]byte("world")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if !bytes.Equal(b.Bytes()[:len(raw)], raw) {
+		t.Fatal("raw page was not written as is")
+	}
+	if e.Granule() != 6 || b.Bytes()[len(raw)+18] != 1 {
+		t.Fatal("expected the sequence to continue after the raw page")
+	}
+
+	for _, bad := range [][]byte{nil, raw[:len(raw)-1], append(raw, 0), []byte("OggT" + string(raw[4:]))} {
+		if err := e.WriteRawPage(bad); err != ErrBadRawPage {
+			t.Fatal("expected ErrBadRawPage, got", err)
+		}
+	}
+}
+
+func TestPageValidate(t *testing.T) {
+	big := make([]byte, mps)
+	tests := []struct {
+		page Page
+		want error
+	}{
+		{Page{Type: BOS, Serial: 1, Packets: [][]byte{[]byte("head")}}, nil},
+		{Page{Type: COP | EOS, Serial: 1, Packets: [][]byte{big, big}}, nil},
+		{Page{Type: BOS, Packets: [][]byte{[]byte("head")}}, ErrPageNoSerial},
+		{Page{Serial: 1}, ErrPageNoPackets},
+		{Page{Type: 8, Serial: 1, Packets: [][]byte{nil}}, ErrPageFlags},
+		{Page{Type: BOS | COP, Serial: 1, Packets: [][]byte{nil}}, ErrPageFlags},
+		{Page{Type: BOS | EOS, Serial: 1, Packets: [][]byte{big}}, ErrPageTooLarge{headsz + 256 + mps}},
+	}
+	for i, test := range tests {
+		if err := test.page.Validate(); err != test.want {
+			t.Fatalf("%d: expected %v, got %v", i, test.want, err)
+		}
+	}
+}
+
+func TestEncodePage(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	err := e.EncodePage(Page{Type: BOS | EOS, Serial: 1, Granule: 3, Packets: [][]byte{[]byte("hello")}})
+	if err != nil {
+		t.Fatal("unexpected EncodePage error:", err)
+	}
+
+	p, _, err := NewDecoder(&b).Decode()
+	if err != nil {
+		t.Fatal("unexpected Decode error:", err)
+	}
+	if p.Type != BOS|EOS || p.Granule != 3 || len(p.Packets) != 1 || string(p.Packets[0]) != "hello" {
+		t.Fatalf("unexpected page: %+v", p)
+	}
+
+	e.Strict = true
+	if err := e.EncodePage(Page{Serial: 1}); err != ErrPageNoPackets {
+		t.Fatal("expected ErrPageNoPackets, got", err)
+	}
+	if b.Len() != 0 {
+		t.Fatal("invalid page was written")
+	}
+}
+
+func TestEncodePackets(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	err := e.EncodePackets([]Packet{
+		{Data: []byte("head"), Granule: 0, BOS: true},
+		{Data: []byte("a"), Granule: 10},
+		{Data: make([]byte, 3*mps), Granule: 30},
+		{Data: []byte("b"), Granule: 40, EOS: true},
+	})
+	if err != nil {
+		t.Fatal("unexpected EncodePackets error:", err)
+	}
+
+	expected := []struct {
+		typ     byte
+		granule int64
+	}{
+		{BOS, 10},
+		{COP, -1},
+		{COP, -1},
+		{COP | EOS, 40},
+	}
+	d := NewDecoder(&b)
+	d.Conformance = ConformanceStrict
+	for i, want := range expected {
+		p, _, err := d.Decode()
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		if p.Type != want.typ || p.Granule != want.granule {
+			t.Fatalf("page %d: expected type %d granule %d, got type %d granule %d",
+				i, want.typ, want.granule, p.Type, p.Granule)
+		}
+	}
+	if _, _, err := d.Decode(); err != io.EOF {
+		t.Fatal("expected io.EOF, got", err)
+	}
+}
+
+func TestSplitPageFlags(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{make([]byte, 2*mps)}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.Encode(1, [][]byte{make([]byte, mps)}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	// The first packet fills the page exactly, so the next doesn't continue it.
+	if err := e.EncodeEOS(2, [][]byte{make([]byte, 254*mss), []byte("x")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	// BOS and EOS are only set on the first and last pages of their calls,
+	// and COP only on pages that continue a packet.
+	expected := []byte{BOS, COP, COP, 0, COP, 0, EOS}
+	d := NewDecoder(&b)
+	d.Conformance = ConformanceStrict
+	for i, want := range expected {
+		p, _, err := d.Decode()
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		if p.Type != want {
+			t.Fatalf("page %d: expected type %d, got %d", i, want, p.Type)
+		}
+	}
+	if _, _, err := d.Decode(); err != io.EOF {
+		t.Fatal("expected io.EOF, got", err)
+	}
+}
+
+func TestBuildSegmentTable(t *testing.T) {
+	tests := []struct {
+		lens []int
+		want []byte
+	}{
+		{[]int{0}, []byte{0}},
+		{[]int{1, 254}, []byte{1, 254}},
+		{[]int{255}, []byte{255, 0}},
+		{[]int{256}, []byte{255, 1}},
+		{[]int{510, 3}, []byte{255, 255, 0, 3}},
+		{nil, []byte{}},
+	}
+	for _, test := range tests {
+		segtbl, err := BuildSegmentTable(test.lens)
+		if err != nil {
+			t.Fatal("unexpected BuildSegmentTable error:", err)
+		}
+		if !bytes.Equal(segtbl, test.want) {
+			t.Fatalf("%v: expected %v, got %v", test.lens, test.want, segtbl)
+		}
+	}
+
+	segtbl, err := BuildSegmentTable([]int{254 * 255})
+	if err != nil || len(segtbl) != 255 {
+		t.Fatal("expected 255 segments, got", len(segtbl), err)
+	}
+	if _, err := BuildSegmentTable([]int{255 * 255}); err != ErrTooManySegments {
+		t.Fatal("expected ErrTooManySegments, got", err)
+	}
+	if _, err := BuildSegmentTable([]int{100, 254 * 255}); err != ErrTooManySegments {
+		t.Fatal("expected ErrTooManySegments, got", err)
+	}
+	if _, err := BuildSegmentTable([]int{-1}); err != ErrNegativePacketLength {
+		t.Fatal("expected ErrNegativePacketLength, got", err)
+	}
+}
+
+func TestRenumberRawPages(t *testing.T) {
+	var src bytes.Buffer
+	s := NewEncoder(1, &src)
+	s.SetSequence(40)
+	if err := s.Encode(5, [][]byte{[]byte("hello")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	raw := append([]byte(nil), src.Bytes()...)
+
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	e.RenumberRawPages = true
+	if err := e.Encode(1, [][]byte{[]byte("first")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := e.WriteRawPage(raw); err != nil {
+		t.Fatal("unexpected WriteRawPage error:", err)
+	}
+	if err := e.WriteRawPage(raw); err != nil {
+		t.Fatal("unexpected WriteRawPage error:", err)
+	}
+	if !bytes.Equal(raw, src.Bytes()) {
+		t.Fatal("raw page was modified")
+	}
+
+	d := NewDecoder(&b)
+	d.Conformance = ConformanceStrict
+	d.DisableChecks = CheckBoundaries
+	for i := uint32(0); i < 3; i++ {
+		p, _, err := d.Decode()
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		if p.Sequence != i {
+			t.Fatalf("expected sequence %d, got %d", i, p.Sequence)
+		}
+	}
+	if e.Granule() != 5 {
+		t.Fatal("expected granule 5, got", e.Granule())
+	}
+}
+
+func TestRenumberRawPagesForeignSerial(t *testing.T) {
+	var src bytes.Buffer
+	s := NewEncoder(2, &src)
+	s.SetSequence(40)
+	if err := s.Encode(5, [][]byte{[]byte("hello")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	raw := append([]byte(nil), src.Bytes()...)
+
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	e.RenumberRawPages = true
+	if err := e.Encode(1, [][]byte{[]byte("first")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	n := b.Len()
+	if err := e.WriteRawPage(raw); err != nil {
+		t.Fatal("unexpected WriteRawPage error:", err)
+	}
+	if !bytes.Equal(b.Bytes()[n:], raw) {
+		t.Fatal("page of another logical stream was modified")
+	}
+	if err := e.Encode(2, [][]byte{[]byte("second")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+
+	d := NewDecoder(&b)
+	for i, want := range []struct {
+		serial, seq uint32
+	}{{1, 0}, {2, 40}, {1, 1}} {
+		p, _, err := d.Decode()
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		if p.Serial != want.serial || p.Sequence != want.seq {
+			t.Fatalf("page %d: expected serial %d sequence %d, got %d and %d", i, want.serial, want.seq, p.Serial, p.Sequence)
+		}
+	}
+	if e.Granule() != 2 {
+		t.Fatal("expected granule 2, got", e.Granule())
+	}
+}
+
+func TestEncodePages(t *testing.T) {
+	var b bytes.Buffer
+	e1 := NewEncoder(1, &b)
+	e2 := NewEncoder(2, &b)
+	for i, err := range []error{
+		e1.EncodeBOS(0, [][]byte{[]byte("one")}),
+		e2.EncodeBOS(0, [][]byte{[]byte("two")}),
+		e1.Encode(1, [][]byte{bytes.Repeat([]byte("x"), mps+1000), []byte("y")}),
+		e2.Encode(2, [][]byte{make([]byte, 2*mss)}),
+		e1.EncodeEOS(3, nil),
+		e2.EncodeEOS(4, [][]byte{[]byte("end")}),
+	} {
+		if err != nil {
+			t.Fatalf("%d: unexpected encoding error: %v", i, err)
+		}
+	}
+
+	d := NewDecoder(bytes.NewReader(b.Bytes()))
+	d.CopyPackets = true
+	var pages []Page
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		// EncodePages numbers the pages itself
+		p.Sequence = 99
+		pages = append(pages, p)
+	}
+
+	var out bytes.Buffer
+	if err := EncodePages(&out, pages, true); err != nil {
+		t.Fatal("unexpected EncodePages error:", err)
+	}
+	if !bytes.Equal(out.Bytes(), b.Bytes()) {
+		t.Fatal("re-encoded pages differ from the original")
+	}
+
+	if err := EncodePages(io.Discard, pages, false); err != ErrMixedSerials {
+		t.Fatal("expected ErrMixedSerials, got", err)
+	}
+
+	var single []Page
+	for _, p := range pages {
+		if p.Serial == 1 {
+			single = append(single, p)
+		}
+	}
+	tests := []struct {
+		pages []Page
+		err   error
+	}{
+		{single, nil},
+		{single[1:], ErrStreamBoundary{1, "missing BOS page"}},
+		{append([]Page{single[0]}, single...), ErrStreamBoundary{1, "repeated BOS page"}},
+		{append(append([]Page(nil), single...), single[1]), ErrStreamBoundary{1, "page after EOS page"}},
+		{single[:len(single)-1], ErrStreamBoundary{1, "missing EOS page"}},
+	}
+	for i, test := range tests {
+		var out bytes.Buffer
+		if err := EncodePages(&out, test.pages, false); err != test.err {
+			t.Fatalf("%d: expected %v, got %v", i, test.err, err)
+		}
+		if test.err != nil && out.Len() != 0 {
+			t.Fatalf("%d: wrote %d bytes of invalid pages", i, out.Len())
+		}
+	}
+}
+
+// lineFramer returns a framer for EncodeStream that makes a packet of each line.
+func lineFramer() func([]byte) ([][]byte, error) {
+	var rest []byte
+	return func(chunk []byte) ([][]byte, error) {
+		if len(chunk) == 0 {
+			if len(rest) == 0 {
+				return nil, nil
+			}
+			return [][]byte{rest}, nil
+		}
+		rest = append(rest, chunk...)
+		var packets [][]byte
+		for {
+			i := bytes.IndexByte(rest, '\n')
+			if i < 0 {
+				return packets, nil
+			}
+			packets = append(packets, rest[:i:i])
+			rest = rest[i+1:]
+		}
+	}
+}
+
+func TestEncodeStream(t *testing.T) {
+	lines := []string{"one", "two", strings.Repeat("long", 20000), "", "last"}
+	input := strings.Join(lines, "\n")
+
+	for _, r := range []io.Reader{
+		strings.NewReader(input),
+		iotest.OneByteReader(strings.NewReader(input)),
+	} {
+		var b bytes.Buffer
+		if err := NewEncoder(1, &b).EncodeStream(r, lineFramer()); err != nil {
+			t.Fatal("unexpected EncodeStream error:", err)
+		}
+
+		d := NewDecoder(&b)
+		d.Conformance = ConformanceStrict
+		for i, line := range lines {
+			pkt, err := d.DecodePacket()
+			if err != nil {
+				t.Fatalf("%d: unexpected DecodePacket error: %v", i, err)
+			}
+			if string(pkt.Data) != line || pkt.BOS != (i == 0) || pkt.EOS != (i == len(lines)-1) {
+				t.Fatalf("%d: unexpected packet: %.20q, BOS %v, EOS %v", i, pkt.Data, pkt.BOS, pkt.EOS)
+			}
+			if pkt.Granule != -1 && pkt.Granule != int64(i+1) {
+				t.Fatalf("%d: unexpected granule %d", i, pkt.Granule)
+			}
+		}
+		if _, err := d.DecodePacket(); err != io.EOF {
+			t.Fatal("expected EOF, got", err)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := NewEncoder(1, &b).EncodeStream(strings.NewReader(""), lineFramer()); err != nil || b.Len() != 0 {
+		t.Fatalf("expected nothing written for an empty stream, got %d bytes, %v", b.Len(), err)
+	}
+
+	errFramer := errors.New("framing failed")
+	err := NewEncoder(1, io.Discard).EncodeStream(strings.NewReader("data"), func([]byte) ([][]byte, error) {
+		return nil, errFramer
+	})
+	if err != errFramer {
+		t.Fatal("expected the framer's error, got", err)
+	}
+}
+
+// lacedPage assembles a page with the given lacing values by hand, as another muxer might,
+// with a payload of the bytes the lacing values call for.
+func lacedPage(serial, seq uint32, typ byte, granule int64, lacing ...byte) []byte {
+	p := make([]byte, headsz, headsz+len(lacing))
+	copy(p, oggs)
+	p[5] = typ
+	byteOrder.PutUint64(p[6:14], uint64(granule))
+	byteOrder.PutUint32(p[14:18], serial)
+	byteOrder.PutUint32(p[18:22], seq)
+	p[26] = byte(len(lacing))
+	p = append(p, lacing...)
+	for _, l := range lacing {
+		for i := 0; i < int(l); i++ {
+			p = append(p, byte(seq+uint32(i)))
+		}
+	}
+	fixCrc(p)
+	return p
+}
+
+func TestEncodePageRoundTrip(t *testing.T) {
+	full := bytes.Repeat([]byte{mss}, mss)
+	pages := [][]byte{
+		lacedPage(1, 0, BOS, 0, 30),
+		lacedPage(1, 1, 0, -1, 100, 0, 10),
+		// a packet of a multiple of 255 bytes, ending on the next page with a 0 lacing value
+		lacedPage(1, 2, 0, 5, 20, mss, mss),
+		lacedPage(1, 3, COP, 7, 0, 1),
+		// a packet filling a page, then another beginning a page but continued
+		lacedPage(1, 4, 0, -1, full...),
+		lacedPage(1, 5, COP, -1, append(full[:mss-1:mss-1], 7)...),
+		lacedPage(1, 6, 0, 9, 50, mss),
+		lacedPage(1, 7, COP, 11, mss, 3, 0, 0),
+		lacedPage(1, 8, EOS, 12, 0),
+	}
+	data := bytes.Join(pages, nil)
+
+	d := NewDecoder(bytes.NewReader(data))
+	d.CopyPackets = true
+	var out bytes.Buffer
+	e := NewEncoder(1, &out)
+	for i := range pages {
+		p, _, err := d.Decode()
+		if err != nil {
+			t.Fatalf("%d: unexpected Decode error: %v", i, err)
+		}
+		if err := e.EncodePage(p); err != nil {
+			t.Fatalf("%d: unexpected EncodePage error: %v", i, err)
+		}
+		if got := out.Bytes()[out.Len()-len(pages[i]):]; !bytes.Equal(got, pages[i]) {
+			t.Fatalf("%d: re-encoded page differs:\n%x\n%x", i, got, pages[i])
+		}
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("re-encoded stream differs")
+	}
+}
+
+func TestEncodePageRoundTripVorbis(t *testing.T) {
+	data, err := os.ReadFile("testdata/vorbis.ogg")
+	if err != nil {
+		t.Fatal("unexpected ReadFile error:", err)
+	}
+
+	d := NewDecoder(bytes.NewReader(data))
+	d.CopyPackets = true
+	var out bytes.Buffer
+	var e *Encoder
+	var pages int
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%d: unexpected Decode error: %v", pages, err)
+		}
+		if e == nil {
+			e = NewEncoder(p.Serial, &out)
+		}
+		if err := e.EncodePage(p); err != nil {
+			t.Fatalf("%d: unexpected EncodePage error: %v", pages, err)
+		}
+		pages++
+	}
+	if pages != 3 {
+		t.Fatal("expected 3 pages, got", pages)
+	}
+	if e.Granule() != 44100 {
+		t.Fatal("expected granule 44100, got", e.Granule())
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("re-encoded stream differs")
+	}
+}
+
+func TestBeginChain(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("first")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.Encode(10, [][]byte{[]byte("data")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := e.BeginChain(2); err != (ErrStreamBoundary{1, "missing EOS page"}) {
+		t.Fatal("expected a missing EOS error, got", err)
+	}
+	if err := e.EncodeEOS(20, [][]byte{[]byte("data")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+	if err := e.BeginChain(2); err != nil {
+		t.Fatal("unexpected BeginChain error:", err)
+	}
+	if err := e.EncodeBOS(0, [][]byte{[]byte("second")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.EncodeEOS(5, [][]byte{[]byte("data")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	d := NewDecoder(bytes.NewReader(b.Bytes()))
+	d.Conformance = ConformanceStrict
+	var pages []string
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		pages = append(pages, strconv.Itoa(int(p.Serial))+":"+strconv.Itoa(int(p.Sequence))+":"+strconv.Itoa(int(p.Type)))
+	}
+	if want := "1:0:2 1:1:0 1:2:4 2:0:2 2:1:4"; strings.Join(pages, " ") != want {
+		t.Fatalf("expected pages %s, got %s", want, strings.Join(pages, " "))
+	}
+	if !d.CleanEOF() {
+		t.Fatal("expected both streams to end")
+	}
+
+	prof, err := ProfileStream(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal("unexpected ProfileStream error:", err)
+	}
+	if !prof.Chained || prof.Links != 2 {
+		t.Fatalf("expected a chain of two links, got\n%s", prof)
+	}
+
+	// a fresh Encoder may begin a chain
+	if err := NewEncoder(1, io.Discard).BeginChain(2); err != nil {
+		t.Fatal("unexpected BeginChain error:", err)
+	}
+}
+
+func TestEncodePageBoundary(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	keyframe := bytes.Repeat([]byte{'k'}, 300*mss)
+	for i, err := range []error{
+		e.EncodeBOS(0, [][]byte{[]byte("header")}),
+		e.Encode(1, [][]byte{[]byte("a"), []byte("b")}),
+		// a boundary before the keyframe, and after it, though it spans pages
+		e.Encode(2, [][]byte{[]byte("c")}),
+		e.Encode(3, [][]byte{keyframe}),
+		e.EncodeEOS(4, [][]byte{[]byte("d")}),
+	} {
+		if err != nil {
+			t.Fatalf("%d: unexpected encoding error: %v", i, err)
+		}
+	}
+
+	d := NewDecoder(bytes.NewReader(b.Bytes()))
+	var pages []string
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		var packets []string
+		for _, pkt := range p.Packets {
+			packets = append(packets, string(pkt[:1])+strconv.Itoa(len(pkt)))
+		}
+		if p.Unfinished {
+			packets = append(packets, "...")
+		}
+		pages = append(pages, strings.Join(packets, ","))
+	}
+	want := []string{"h6", "a1,b1", "c1", "k" + strconv.Itoa(mss*mss) + ",...", "k" + strconv.Itoa(45*mss), "d1"}
+	if strings.Join(pages, " ") != strings.Join(want, " ") {
+		t.Fatalf("expected pages %v, got %v", want, pages)
+	}
+}
+
+func TestEncodeRaw(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	// an EOS page whose last packet claims to continue
+	if err := e.EncodeRaw(EOS, 5, 1, []byte{3, mss}, bytes.Repeat([]byte{'x'}, 3+mss)); err != nil {
+		t.Fatal("unexpected EncodeRaw error:", err)
+	}
+
+	d := NewDecoder(bytes.NewReader(b.Bytes()))
+	if _, _, err := d.Decode(); err != nil {
+		t.Fatal("unexpected Decode error:", err)
+	}
+	p, _, err := d.Decode()
+	if err != nil {
+		t.Fatal("unexpected Decode error:", err)
+	}
+	if p.Type != EOS || p.Granule != 5 || p.Sequence != 1 || !p.Unfinished || len(p.Packets) != 2 || len(p.Packets[1]) != mss {
+		t.Fatalf("unexpected page: type %d, granule %d, sequence %d, unfinished %v, %d packets",
+			p.Type, p.Granule, p.Sequence, p.Unfinished, len(p.Packets))
+	}
+
+	if err := e.EncodeRaw(0, 0, 1, make([]byte, 256), nil); err != ErrTooManySegments {
+		t.Fatal("expected ErrTooManySegments, got", err)
+	}
+	if err := e.EncodeRaw(0, 0, 1, []byte{10}, make([]byte, 5)); err != ErrSegmentMismatch {
+		t.Fatal("expected ErrSegmentMismatch, got", err)
+	}
+
+	// a page whose payload is shorter than its segment table says
+	b.Reset()
+	e.AllowSegmentMismatch = true
+	if err := e.EncodeRaw(0, 0, 1, bytes.Repeat([]byte{mss}, 255), make([]byte, maxPageSize)); err != (ErrPageTooLarge{headsz + 255 + maxPageSize}) {
+		t.Fatal("expected ErrPageTooLarge, got", err)
+	}
+	if err := e.EncodeRaw(BOS, 0, 2, []byte{10}, make([]byte, 5)); err != nil {
+		t.Fatal("unexpected EncodeRaw error:", err)
+	}
+	if b.Len() != headsz+1+5 {
+		t.Fatal("expected a page of", headsz+1+5, "bytes, got", b.Len())
+	}
+	if _, _, err := NewDecoder(&b).Decode(); err != io.ErrUnexpectedEOF {
+		t.Fatal("expected io.ErrUnexpectedEOF, got", err)
+	}
+}
+
+func TestOnePacketPerPage(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	e.OnePacketPerPage = true
+	long := bytes.Repeat([]byte{'l'}, mps+10)
+	for i, err := range []error{
+		e.EncodeBOS(0, [][]byte{[]byte("id")}),
+		e.Encode(0, [][]byte{[]byte("setup")}),
+		e.EncodePackets([]Packet{{Data: []byte("a"), Granule: 5}, {Data: long, Granule: 6}, {Data: []byte("b"), Granule: 7}}),
+		e.Encode(8, [][]byte{[]byte("c")}),
+		e.EncodePackets([]Packet{{Data: []byte("d"), Granule: 9}, {Data: []byte("e"), Granule: 10, EOS: true}}),
+	} {
+		if err != nil {
+			t.Fatalf("%d: unexpected encoding error: %v", i, err)
+		}
+	}
+
+	type page struct {
+		typ     byte
+		granule int64
+		packet  string
+	}
+	expected := []page{
+		{BOS, 0, "id"},
+		{0, 0, "setup"},
+		{0, 5, "a"},
+		{0, -1, string(long[:mps])},
+		{COP, 6, string(long[mps:])},
+		{0, 7, "b"},
+		{0, 8, "c"},
+		{0, 9, "d"},
+		{EOS, 10, "e"},
+	}
+	d := NewDecoder(&b)
+	for i, want := range expected {
+		p, _, err := d.Decode()
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		if len(p.Packets) != 1 || p.Type != want.typ || p.Granule != want.granule || string(p.Packets[0]) != want.packet {
+			t.Fatalf("page %d: expected type %d, granule %d, and one packet of %d bytes; got type %d, granule %d, and %d packets",
+				i, want.typ, want.granule, len(want.packet), p.Type, p.Granule, len(p.Packets))
+		}
+	}
+	if _, _, err := d.Decode(); err != io.EOF {
+		t.Fatal("expected EOF, got", err)
+	}
+}
+
+func TestOnePacketPerPageGranules(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	e.OnePacketPerPage = true
+	two := [][]byte{[]byte("a"), []byte("b")}
+	for i, err := range []error{e.EncodeBOS(0, two), e.Encode(5, two), e.EncodeEOS(5, two)} {
+		if err != ErrPacketGranules {
+			t.Fatalf("%d: expected ErrPacketGranules, got %v", i, err)
+		}
+	}
+	if b.Len() != 0 {
+		t.Fatal("expected nothing written, got", b.Len(), "bytes")
+	}
+}
+
+func TestEncodeSplitGranules(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	long := make([]byte, 3*mps)
+	for i, err := range []error{
+		e.EncodeBOS(0, [][]byte{[]byte("head")}),
+		// a packet ends on the first page, so it keeps the granule position
+		e.Encode(10, [][]byte{[]byte("a"), long}),
+		e.EncodeEOS(20, [][]byte{long}),
+	} {
+		if err != nil {
+			t.Fatalf("%d: unexpected encoding error: %v", i, err)
+		}
+	}
+
+	expected := []int64{0, 10, -1, -1, 10, -1, -1, -1, 20}
+	d := NewDecoder(&b)
+	for i, want := range expected {
+		p, _, err := d.Decode()
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		if p.Granule != want {
+			t.Fatalf("page %d: expected granule %d, got %d", i, want, p.Granule)
+		}
+	}
+	if _, _, err := d.Decode(); err != io.EOF {
+		t.Fatal("expected EOF, got", err)
+	}
+}
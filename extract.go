@@ -0,0 +1,410 @@
+package ogg
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrEmptyRange is the error used by ExtractRange when no packets fall within the range.
+var ErrEmptyRange = errors.New("no packets in range")
+
+// ExtractRange writes to w a clip of the first logical stream in rs, from start to end,
+// as a new ogg stream that begins with copies of the stream's header packets.
+// The times are those of the stream's GranuleInterpreter, so the codec must be registered,
+// and its granule positions must count linearly, as those of every built-in codec but Theora do;
+// for Theora, the error is ErrUnsupportedCodec.
+//
+// The clip is cut at page boundaries, since most codecs can't cut a page's packets cleanly:
+// it starts with the page following the last page whose granule position is at or before start,
+// and ends with the first page whose granule position is at or after end, which is given the EOS flag.
+// So it may start early, and end late, by up to a page's duration.
+// Its granule positions are rebased to count from the granule position of the page before the clip,
+// so that it starts at 0; for Opus, the pre-skip is reduced to match, leaving none unless the clip
+// starts within it. Decoders start the clip cold, so its first packets may not sound as they did.
+// A packet continued from before the clip is dropped, as are any packets after the last page
+// with a granule position in a stream that ends without an EOS page.
+//
+// rs is read from its current position, and the page to start from is found by bisection,
+// so that only a few pages besides the clip are read.
+// The error is ErrEmptyRange if end isn't after start, or no packets of the stream fall in the range.
+func ExtractRange(rs io.ReadSeeker, start, end time.Duration, w io.Writer) error {
+	if end <= start {
+		return ErrEmptyRange
+	}
+	from, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	h, err := readHeaders(rs, from, 0, true)
+	if h.codec == CodecTheora {
+		return ErrUnsupportedCodec
+	}
+	if err != nil {
+		return err
+	}
+	serial, codec, headers := h.serial, h.codec, h.packets
+	gi, err := NewGranuleInterpreter(headers[0])
+	if err != nil {
+		return err
+	}
+
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	offset, base, err := seekPage(rs, serial, h.dataStart, size, func(granule int64) bool {
+		return gi.GranuleToDuration(granule) <= start
+	})
+	if err != nil {
+		return err
+	}
+	if base < 0 {
+		base = 0
+	}
+	if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	var e *Encoder
+	var held, group [][]byte
+	var heldGranule int64
+	d := NewDecoder(rs)
+	d.CopyPackets = true
+	for {
+		pkt, err := d.DecodePacket()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if pkt.Serial != serial {
+			continue
+		}
+		group = append(group, pkt.Data)
+		if pkt.Granule == -1 {
+			continue
+		}
+
+		if e == nil {
+			e = NewEncoder(serial, w)
+			if err := writeClipHeaders(e, codec, headers, base); err != nil {
+				return err
+			}
+		} else if err := e.Encode(heldGranule, held); err != nil {
+			return err
+		}
+		held, heldGranule, group = group, pkt.Granule-base, nil
+		if pkt.EOS || gi.GranuleToDuration(pkt.Granule) >= end {
+			break
+		}
+	}
+	if e == nil {
+		return ErrEmptyRange
+	}
+	return e.EncodeEOS(heldGranule, held)
+}
+
+// streamHeaders are the header packets of a logical stream, as read by readHeaders.
+type streamHeaders struct {
+	packets [][]byte
+	serial  uint32
+	codec   Codec
+	// the offset of the end of the page on which the last header packet ends
+	dataStart int64
+}
+
+// readHeaders reads the header packets of a logical stream from r, which is at offset from,
+// the start of a link: the stream with the given serial number, or the first stream if first is set.
+// The error is ErrNoPages if r holds no packets, ErrStreamBoundary if the stream has no BOS page,
+// or ErrEmptyRange if it has no data packets, in which case the codec is still returned.
+func readHeaders(r io.Reader, from int64, serial uint32, first bool) (streamHeaders, error) {
+	h := streamHeaders{serial: serial, dataStart: from}
+	d := NewDecoder(r)
+	d.CopyPackets = true
+	seen := false
+	for {
+		pkt, err := d.DecodePacket()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if !seen {
+				return h, ErrNoPages
+			}
+			if h.packets == nil {
+				return h, ErrStreamBoundary{h.serial, "missing BOS page"}
+			}
+			return h, ErrEmptyRange
+		}
+		if err != nil {
+			return h, err
+		}
+		seen = true
+		if h.packets == nil {
+			if first {
+				h.serial = pkt.Serial
+			}
+			if pkt.Serial != h.serial {
+				if !pkt.BOS {
+					return h, ErrStreamBoundary{h.serial, "missing BOS page"}
+				}
+				continue
+			}
+			if !pkt.BOS {
+				return h, ErrStreamBoundary{pkt.Serial, "missing BOS page"}
+			}
+			h.codec = IdentifyCodec(pkt.Data)
+		} else if pkt.Serial != h.serial {
+			continue
+		}
+		if ClassifyPacket(h.codec, len(h.packets), pkt.Data) == PacketData {
+			return h, nil
+		}
+		h.packets = append(h.packets, pkt.Data)
+		if len(d.pending) == 0 {
+			// the data starts on a later page, as the codecs' mappings require
+			h.dataStart = from + d.Offset()
+		}
+	}
+}
+
+// CopyGranuleRange copies to w the pages of the logical stream in rs with the given serial number
+// whose granule positions are from start to end, inclusive, after the pages of its header packets.
+// Unlike ExtractRange, it copies the pages verbatim, keeping their granule positions, sequence numbers,
+// and CRCs, as a faithful subset of the stream for analysis or re-hosting. So the copy isn't a conformant
+// stream of its own: it has no EOS page unless the range reaches the stream's end, its sequence numbers
+// skip from the headers to the range, and it starts at a granule position players may not expect,
+// and mid-packet, so it may not play without its granule positions being rebased, as ExtractRange does.
+// The pages without a granule position that precede the first page in the range are copied too,
+// since they hold the beginnings of its packets, as are those between pages in the range.
+//
+// rs is read from its current position, which must be the start of the stream or of the link of a chain
+// that holds the logical stream, and the first page in the range is found by bisection,
+// which requires the stream's granule positions to be in order.
+// The error is ErrEmptyRange if end is before start, or no page's granule position is in the range.
+func CopyGranuleRange(rs io.ReadSeeker, serial uint32, start, end int64, w io.Writer) error {
+	if end < start {
+		return ErrEmptyRange
+	}
+	from, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	h, err := readHeaders(rs, from, serial, false)
+	if err != nil {
+		return err
+	}
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	offset, _, err := seekPage(rs, serial, h.dataStart, size, func(granule int64) bool {
+		return granule < start
+	})
+	if err != nil {
+		return err
+	}
+
+	// Find the first page in range before writing anything.
+	if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	d := NewDecoder(rs)
+	d.KeepRawPage = true
+	d.CopyPackets = true
+	var held [][]byte
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrEmptyRange
+		}
+		if err != nil {
+			if corrupt(err) {
+				continue
+			}
+			return err
+		}
+		if p.Serial != serial {
+			continue
+		}
+		if p.Granule == -1 {
+			held = append(held, p.Raw)
+			continue
+		}
+		if p.Granule > end {
+			return ErrEmptyRange
+		}
+		held = append(held, p.Raw)
+		break
+	}
+	next := offset + d.Offset()
+
+	if err := copyPages(rs, from, h.dataStart, serial, w); err != nil {
+		return err
+	}
+	for _, raw := range held {
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+	}
+
+	if _, err := rs.Seek(next, io.SeekStart); err != nil {
+		return err
+	}
+	held = held[:0]
+	d = NewDecoder(rs)
+	d.KeepRawPage = true
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			if corrupt(err) {
+				continue
+			}
+			return err
+		}
+		if p.Serial != serial {
+			continue
+		}
+		if p.Granule == -1 {
+			// held until a page in the range shows the packets end there
+			held = append(held, append([]byte(nil), p.Raw...))
+			continue
+		}
+		if p.Granule > end {
+			return nil
+		}
+		for _, raw := range append(held, p.Raw) {
+			if _, err := w.Write(raw); err != nil {
+				return err
+			}
+		}
+		held = held[:0]
+		if p.Type&EOS != 0 {
+			return nil
+		}
+	}
+}
+
+// copyPages writes to w the pages of the logical stream with the given serial number
+// from offset from of rs up to offset to.
+func copyPages(rs io.ReadSeeker, from, to int64, serial uint32, w io.Writer) error {
+	if _, err := rs.Seek(from, io.SeekStart); err != nil {
+		return err
+	}
+	d := NewDecoder(rs)
+	d.KeepRawPage = true
+	for from+d.Offset() < to {
+		p, _, err := d.Decode()
+		if err != nil {
+			return err
+		}
+		if p.Serial != serial {
+			continue
+		}
+		if _, err := w.Write(p.Raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeClipHeaders writes the header packets of a clip whose granule positions are rebased by base.
+func writeClipHeaders(e *Encoder, codec Codec, headers [][]byte, base int64) error {
+	head := headers[0]
+	if codec == CodecOpus && base > 0 {
+		skip := int64(byteOrder.Uint16(head[10:12])) - base
+		if skip < 0 {
+			skip = 0
+		}
+		head = append([]byte(nil), head...)
+		byteOrder.PutUint16(head[10:12], uint16(skip))
+	}
+	if err := e.EncodeBOS(0, [][]byte{head}); err != nil {
+		return err
+	}
+	if len(headers) == 1 {
+		return nil
+	}
+	return e.Encode(0, headers[1:])
+}
+
+// seekPage returns the offset in rs of the page following the last page of the given logical stream
+// whose granule position satisfies before, and that granule position,
+// or lo and -1 if no page from lo on does.
+// The pages from lo, which must be the offset of a page, up to hi are searched by bisection,
+// which requires the stream's granule positions to be in order, and before to hold of a prefix of them.
+func seekPage(rs io.ReadSeeker, serial uint32, lo, hi int64, before func(granule int64) bool) (offset, granule int64, err error) {
+	granule = -1
+	for hi-lo > maxPageSize {
+		mid := lo + (hi-lo)/2
+		end, g, err := nextGranule(rs, serial, mid, hi)
+		if err != nil {
+			return 0, -1, err
+		}
+		if end < 0 || !before(g) {
+			hi = mid
+			continue
+		}
+		lo, granule = end, g
+	}
+
+	// Finish with a linear scan.
+	if _, err := rs.Seek(lo, io.SeekStart); err != nil {
+		return 0, -1, err
+	}
+	offset, pos := lo, lo
+	d := NewDecoder(rs)
+	for {
+		p, n, err := d.Decode()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		pos += int64(n)
+		if err != nil {
+			if corrupt(err) {
+				continue
+			}
+			return 0, -1, err
+		}
+		if p.Serial == serial && p.Granule != -1 {
+			if !before(p.Granule) {
+				break
+			}
+			offset, granule = pos, p.Granule
+		}
+	}
+	return offset, granule, nil
+}
+
+// nextGranule returns the offset of the end of the first page of the given logical stream
+// with a granule position that starts at or after from, and before limit, and that granule position,
+// or -1 if there's none.
+func nextGranule(rs io.ReadSeeker, serial uint32, from, limit int64) (end, granule int64, err error) {
+	if _, err := rs.Seek(from, io.SeekStart); err != nil {
+		return -1, -1, err
+	}
+	pos := from
+	d := NewDecoder(rs)
+	for {
+		p, n, err := d.Decode()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return -1, -1, nil
+		}
+		pos += int64(n)
+		if err != nil {
+			if corrupt(err) {
+				continue
+			}
+			return -1, -1, err
+		}
+		if pos-int64(p.Size) >= limit {
+			return -1, -1, nil
+		}
+		if p.Serial == serial && p.Granule != -1 {
+			return pos, p.Granule, nil
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestExtractRange(t *testing.T) {
+	// 20ms packets, numbered, and large enough that seeking bisects
+	var packets [][]byte
+	for i := 0; i < 200; i++ {
+		pkt := make([]byte, 1000)
+		pkt[0], pkt[1] = 0x08, byte(i)
+		packets = append(packets, pkt)
+	}
+	tags := opusTagsPacket("test")
+	file := opusFile(t, 312, tags, packets...)
+
+	for _, test := range []struct {
+		start, end time.Duration
+		first, n   int
+		preSkip    uint16
+		granule    int64 // the last
+	}{
+		// page 15 ends at (15*960-312)/48000 = 293.5ms
+		{300 * time.Millisecond, 500 * time.Millisecond, 15, 11, 0, 11 * 960},
+		{0, 100 * time.Millisecond, 0, 6, 312, 6 * 960},
+		// the clip ends with the stream, at its last granule position
+		{3900 * time.Millisecond, time.Hour, 195, 5, 0, 5 * 960},
+	} {
+		var out bytes.Buffer
+		if err := ExtractRange(bytes.NewReader(file), test.start, test.end, &out); err != nil {
+			t.Fatal("unexpected ExtractRange error:", err)
+		}
+
+		d := NewDecoder(&out)
+		d.Conformance = ConformanceStrict
+		d.CopyPackets = true
+		var got []Page
+		for {
+			p, _, err := d.Decode()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal("unexpected Decode error:", err)
+			}
+			got = append(got, p)
+		}
+		if len(got) != test.n+2 {
+			t.Fatalf("%v-%v: expected %d pages, got %d", test.start, test.end, test.n+2, len(got))
+		}
+
+		head, err := ParseOpusHead(got[0].Packets[0])
+		if err != nil || head.PreSkip != test.preSkip {
+			t.Fatalf("%v-%v: expected pre-skip %d, got %d, %v", test.start, test.end, test.preSkip, head.PreSkip, err)
+		}
+		if !bytes.Equal(got[1].Packets[0], tags) {
+			t.Fatalf("%v-%v: expected the tags to be copied", test.start, test.end)
+		}
+		for i, p := range got[2:] {
+			if len(p.Packets) != 1 || p.Packets[0][1] != byte(test.first+i) || p.Granule != int64(i+1)*960 && i < test.n-1 {
+				t.Fatalf("%v-%v: unexpected page %d: %d packets, granule %d", test.start, test.end, i, len(p.Packets), p.Granule)
+			}
+		}
+		if last := got[len(got)-1]; last.Granule != test.granule || last.Type != EOS {
+			t.Fatalf("%v-%v: expected EOS page at %d, got type %d at %d", test.start, test.end, test.granule, last.Type, last.Granule)
+		}
+	}
+
+	if err := ExtractRange(bytes.NewReader(file), time.Hour, 2*time.Hour, io.Discard); err != ErrEmptyRange {
+		t.Fatal("expected ErrEmptyRange past the end, got", err)
+	}
+	if err := ExtractRange(bytes.NewReader(file), time.Second, time.Second, io.Discard); err != ErrEmptyRange {
+		t.Fatal("expected ErrEmptyRange for an empty range, got", err)
+	}
+
+	var theora bytes.Buffer
+	if err := NewEncoder(1, &theora).EncodeBOS(0, [][]byte{theoraIDPacket(3, 2, 1)}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := ExtractRange(bytes.NewReader(theora.Bytes()), 0, time.Second, io.Discard); err != ErrUnsupportedCodec {
+		t.Fatal("expected ErrUnsupportedCodec for Theora, got", err)
+	}
+}
+
+func TestCopyGranuleRange(t *testing.T) {
+	// Stream 1 has a page for each granule position from 10 to 1000,
+	// but for 500, whose packet spans two pages; stream 2 is interleaved with it.
+	var b bytes.Buffer
+	e1, e2 := NewEncoder(1, &b), NewEncoder(2, &b)
+	if err := e1.EncodeBOS(0, [][]byte{[]byte("mycodec")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e2.EncodeBOS(0, [][]byte{[]byte("other")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	for g := int64(10); g <= 1000; g += 10 {
+		pkt := make([]byte, 1000)
+		if g == 500 {
+			pkt = make([]byte, 70000)
+		}
+		pkt[0] = byte(g / 10)
+		var err error
+		if g == 1000 {
+			err = e1.EncodeEOS(g, [][]byte{pkt})
+		} else {
+			err = e1.Encode(g, [][]byte{pkt})
+		}
+		if err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+		if err := e2.Encode(g, [][]byte{[]byte("x")}); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+	}
+
+	// The pages of stream 1, by granule position.
+	var bos []byte
+	pages := make(map[int64][][]byte)
+	d := NewDecoder(bytes.NewReader(b.Bytes()))
+	d.KeepRawPage = true
+	d.CopyPackets = true
+	var held [][]byte
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		if p.Serial != 1 {
+			continue
+		}
+		if p.Type&BOS != 0 {
+			bos = p.Raw
+			continue
+		}
+		held = append(held, p.Raw)
+		if p.Granule != -1 {
+			pages[p.Granule], held = held, nil
+		}
+	}
+
+	for _, test := range []struct{ start, end int64 }{
+		{300, 500},
+		{495, 505},
+		{0, 10},
+		{995, 2000},
+	} {
+		var out bytes.Buffer
+		if err := CopyGranuleRange(bytes.NewReader(b.Bytes()), 1, test.start, test.end, &out); err != nil {
+			t.Fatal("unexpected CopyGranuleRange error:", err)
+		}
+		want := append([]byte(nil), bos...)
+		for g := int64(10); g <= 1000; g += 10 {
+			if g >= test.start && g <= test.end {
+				want = append(want, bytes.Join(pages[g], nil)...)
+			}
+		}
+		if !bytes.Equal(out.Bytes(), want) {
+			t.Fatalf("%d-%d: expected %d bytes of pages, got %d", test.start, test.end, len(want), out.Len())
+		}
+	}
+
+	if err := CopyGranuleRange(bytes.NewReader(b.Bytes()), 1, 301, 309, io.Discard); err != ErrEmptyRange {
+		t.Fatal("expected ErrEmptyRange between pages, got", err)
+	}
+	if err := CopyGranuleRange(bytes.NewReader(b.Bytes()), 3, 0, 100, io.Discard); err != (ErrStreamBoundary{3, "missing BOS page"}) {
+		t.Fatal("expected ErrStreamBoundary for a missing stream, got", err)
+	}
+}
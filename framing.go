@@ -0,0 +1,99 @@
+package ogg
+
+import (
+	"errors"
+	"io"
+)
+
+// The size of the length prefix written before each packet by WriteFramedPackets.
+const framePrefixSize = 4
+
+// ErrFrameTooLarge is the error used by WriteFramedPackets when a packet's length
+// doesn't fit its 4-byte prefix.
+var ErrFrameTooLarge = errors.New("packet too large for a 4-byte length prefix")
+
+// WriteFramedPackets writes each packet to w, prefixed with its length as a
+// 4-byte little-endian integer.
+// This framing is independent of ogg pages; it is meant for handing
+// reassembled packets to another process or over a transport that
+// does not delimit messages itself. ReadFramedPacket reads it back.
+// A packet of 4 GiB or more can't be framed; if there's one, nothing is written,
+// and the error is ErrFrameTooLarge.
+func WriteFramedPackets(w io.Writer, packets [][]byte) error {
+	for _, p := range packets {
+		if uint64(len(p)) > 1<<32-1 {
+			return ErrFrameTooLarge
+		}
+	}
+
+	var prefix [framePrefixSize]byte
+	for _, p := range packets {
+		byteOrder.PutUint32(prefix[:], uint32(len(p)))
+		if _, err := w.Write(prefix[:]); err != nil {
+			return err
+		}
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadFramedPacket reads one packet written by WriteFramedPackets from r.
+// It returns io.EOF if r is exhausted before a packet begins,
+// and io.ErrUnexpectedEOF if r ends partway through one.
+func ReadFramedPacket(r io.Reader) ([]byte, error) {
+	var prefix [framePrefixSize]byte
+	_, err := io.ReadFull(r, prefix[:])
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't trust the prefix enough to allocate it all up front.
+	n := int64(byteOrder.Uint32(prefix[:]))
+	p, err := io.ReadAll(io.LimitReader(r, n))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(p)) != n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return p, nil
+}
+
+// RawPacketReader returns a Reader of the concatenated packets of the given logical stream in r,
+// that is, its elementary stream without the ogg framing,
+// for tools that take a codec's raw output.
+// The packet boundaries are lost in this view; use ReadFramedPacket with WriteFramedPackets to keep them.
+// The Reader returns io.EOF after the stream's EOS packet.
+func RawPacketReader(r io.Reader, serial uint32) io.Reader {
+	return &rawPacketReader{d: NewDecoder(r), serial: serial}
+}
+
+type rawPacketReader struct {
+	d      *Decoder
+	serial uint32
+	data   []byte // the unread part of the current packet
+	eos    bool
+}
+
+func (r *rawPacketReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		if r.eos {
+			return 0, io.EOF
+		}
+		pkt, err := r.d.DecodePacket()
+		if err != nil {
+			return 0, err
+		}
+		if pkt.Serial != r.serial {
+			continue
+		}
+		r.data = pkt.Data
+		r.eos = pkt.EOS
+	}
+
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
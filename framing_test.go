@@ -0,0 +1,109 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"testing"
+	"testing/iotest"
+	"unsafe"
+)
+
+func TestFramedPackets(t *testing.T) {
+	packets := [][]byte{
+		[]byte("hello"),
+		nil,
+		bytes.Repeat([]byte("x"), mps+1),
+	}
+
+	var b bytes.Buffer
+	err := WriteFramedPackets(&b, packets)
+	if err != nil {
+		t.Fatal("unexpected WriteFramedPackets error:", err)
+	}
+
+	for i, expect := range packets {
+		p, err := ReadFramedPacket(&b)
+		if err != nil {
+			t.Fatal("unexpected ReadFramedPacket error:", err)
+		}
+		if !bytes.Equal(p, expect) {
+			t.Fatalf("packet %d is wrong:\n%x\n%x", i, p, expect)
+		}
+	}
+
+	_, err = ReadFramedPacket(&b)
+	if err != io.EOF {
+		t.Fatal("expected EOF, got:", err)
+	}
+}
+
+func TestShortFramedPacket(t *testing.T) {
+	var b bytes.Buffer
+	err := WriteFramedPackets(&b, [][]byte{[]byte("hello")})
+	if err != nil {
+		t.Fatal("unexpected WriteFramedPackets error:", err)
+	}
+
+	_, err = ReadFramedPacket(bytes.NewReader(b.Bytes()[:b.Len()-1]))
+	if err != io.ErrUnexpectedEOF {
+		t.Fatal("expected ErrUnexpectedEOF, got:", err)
+	}
+
+	_, err = ReadFramedPacket(bytes.NewReader(b.Bytes()[:2]))
+	if err != io.ErrUnexpectedEOF {
+		t.Fatal("expected ErrUnexpectedEOF, got:", err)
+	}
+}
+
+func TestFramedPacketTooLarge(t *testing.T) {
+	if strconv.IntSize == 32 {
+		t.Skip("a 4 GiB packet can't be represented")
+	}
+	// a slice claiming 4 GiB, which is rejected before any of it is read
+	var one [1]byte
+	huge := unsafe.Slice(&one[0], 1<<32)
+
+	var b bytes.Buffer
+	err := WriteFramedPackets(&b, [][]byte{[]byte("hello"), huge})
+	if err != ErrFrameTooLarge {
+		t.Fatal("expected ErrFrameTooLarge, got:", err)
+	}
+	if b.Len() != 0 {
+		t.Fatal("expected nothing written, got", b.Len(), "bytes")
+	}
+}
+
+func TestRawPacketReader(t *testing.T) {
+	var b bytes.Buffer
+	a := NewEncoder(1, &b)
+	o := NewEncoder(2, &b)
+	if err := a.EncodeBOS(0, [][]byte{[]byte("head,")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := o.EncodeBOS(0, [][]byte{[]byte("other")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	long := bytes.Repeat([]byte("x"), 2*mps)
+	if err := a.Encode(1, [][]byte{long, []byte(",")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := o.Encode(1, [][]byte{[]byte("other")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := a.EncodeEOS(2, [][]byte{[]byte("end")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+	if err := o.EncodeEOS(2, [][]byte{[]byte("other")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	got, err := io.ReadAll(iotest.OneByteReader(RawPacketReader(&b, 1)))
+	if err != nil {
+		t.Fatal("unexpected ReadAll error:", err)
+	}
+	want := "head," + string(long) + ",end"
+	if string(got) != want {
+		t.Fatalf("expected %d bytes of elementary stream, got %d", len(want), len(got))
+	}
+}
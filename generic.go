@@ -0,0 +1,97 @@
+package ogg
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNoStream is the error used by NewGenericReader when an ogg stream doesn't begin with a BOS page.
+var ErrNoStream = errors.New("no logical stream found")
+
+// A GenericReader reads the packets of a logical stream of any codec, reassembled from its pages,
+// with their granule positions as they are, leaving their meaning to the caller,
+// as for passing the packets of a codec the package doesn't know to an external decoder.
+// It's the base of the readers of specific codecs, such as OpusReader and VorbisReader,
+// which add their codecs' headers and timestamps.
+// If the ogg stream is multiplexed, only its first logical stream is read.
+type GenericReader struct {
+	// Codec is the stream's codec, as identified from its first packet, which may be CodecUnknown.
+	Codec  Codec
+	Serial uint32
+
+	d *Decoder
+	// the first packet, until ReadPacket returns it
+	first *Packet
+	done  bool
+}
+
+// NewGenericReader creates a GenericReader of the first logical stream in r, reading its first packet.
+// The error is ErrNoStream if r doesn't begin with a BOS page.
+func NewGenericReader(r io.Reader) (*GenericReader, error) {
+	g, bos, err := openStream(r, func([]byte) bool { return true })
+	if err == errNoMatch {
+		return nil, ErrNoStream
+	}
+	if err != nil {
+		return nil, err
+	}
+	g.first = &bos
+	return g, nil
+}
+
+// errNoMatch is the error used by openStream when there's no stream to open.
+var errNoMatch = errors.New("no matching stream")
+
+// openStream reads the packets of the BOS pages at the start of r up to the first for which match holds,
+// and returns a GenericReader of its logical stream, and the packet.
+// The error is errNoMatch if there's none.
+func openStream(r io.Reader, match func(bos []byte) bool) (*GenericReader, Packet, error) {
+	d := NewDecoder(r)
+	for {
+		pkt, err := d.DecodePacket()
+		if err == io.EOF {
+			return nil, Packet{}, errNoMatch
+		}
+		if err != nil {
+			return nil, Packet{}, err
+		}
+		if !pkt.BOS {
+			return nil, Packet{}, errNoMatch
+		}
+		if match(pkt.Data) {
+			return &GenericReader{Codec: IdentifyCodec(pkt.Data), Serial: pkt.Serial, d: d, done: pkt.EOS}, pkt, nil
+		}
+	}
+}
+
+// ReadPacket returns the stream's next packet, starting with its first, the header on its BOS page.
+// The packet's Granule is the granule position of the page it ends, as DecodePacket sets it,
+// left to the caller to interpret; the codec's header packets are returned like any others,
+// and may be told apart with ClassifyPacket.
+// Its Data is only valid until the next call.
+// The error is io.EOF after the end of the logical stream.
+func (g *GenericReader) ReadPacket() (Packet, error) {
+	if pkt := g.first; pkt != nil {
+		g.first = nil
+		return *pkt, nil
+	}
+	return g.next()
+}
+
+// next returns the next packet of g's logical stream after its first.
+func (g *GenericReader) next() (Packet, error) {
+	if g.done {
+		return Packet{}, io.EOF
+	}
+	for {
+		pkt, err := g.d.DecodePacket()
+		if err != nil {
+			return Packet{}, err
+		}
+		if pkt.Serial != g.Serial {
+			continue
+		}
+		g.done = pkt.EOS
+		return pkt, nil
+	}
+}
@@ -0,0 +1,66 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestGenericReader(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	other := NewEncoder(2, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("mycodec")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := other.EncodeBOS(0, [][]byte{[]byte("other")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.Encode(7, [][]byte{[]byte("a"), bytes.Repeat([]byte("b"), 70000)}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := other.EncodeEOS(5, [][]byte{[]byte("x")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+	if err := e.EncodeEOS(9, [][]byte{[]byte("c")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	g, err := NewGenericReader(&b)
+	if err != nil {
+		t.Fatal("unexpected NewGenericReader error:", err)
+	}
+	if g.Codec != CodecUnknown || g.Serial != 1 {
+		t.Fatalf("unexpected stream: %v, %d", g.Codec, g.Serial)
+	}
+	want := []struct {
+		size    int
+		granule int64
+	}{{7, 0}, {1, 7}, {70000, 7}, {1, 9}}
+	for i, w := range want {
+		pkt, err := g.ReadPacket()
+		if err != nil {
+			t.Fatal("unexpected ReadPacket error:", err)
+		}
+		if len(pkt.Data) != w.size || pkt.Granule != w.granule || pkt.Serial != 1 {
+			t.Fatalf("packet %d: expected %d bytes at %d, got %d bytes at %d", i, w.size, w.granule, len(pkt.Data), pkt.Granule)
+		}
+		if pkt.BOS != (i == 0) || pkt.EOS != (i == len(want)-1) {
+			t.Fatalf("packet %d: unexpected flags BOS %v, EOS %v", i, pkt.BOS, pkt.EOS)
+		}
+	}
+	if _, err := g.ReadPacket(); err != io.EOF {
+		t.Fatal("expected io.EOF, got", err)
+	}
+
+	if _, err := NewGenericReader(bytes.NewReader(nil)); err != ErrNoStream {
+		t.Fatal("expected ErrNoStream, got", err)
+	}
+	b.Reset()
+	if err := NewEncoder(1, &b).Encode(0, [][]byte{[]byte("data")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if _, err := NewGenericReader(&b); err != ErrNoStream {
+		t.Fatal("expected ErrNoStream, got", err)
+	}
+}
@@ -0,0 +1,38 @@
+package ogg
+
+import (
+	"crypto/sha256"
+	"hash"
+	"io"
+)
+
+// StreamHash returns the SHA-256 digest of the packets of the given logical stream in r.
+// See StreamHashWith.
+func StreamHash(r io.Reader, serial uint32) ([]byte, error) {
+	return StreamHashWith(r, serial, sha256.New())
+}
+
+// StreamHashWith feeds the packets of the given logical stream in r to h in order,
+// and returns the digest. Each packet is preceded by its length as 8 little-endian bytes,
+// so the digest covers the packet boundaries but not how the packets were laid out in pages:
+// streams that differ only in their paging, as by remuxing, have the same digest.
+func StreamHashWith(r io.Reader, serial uint32, h hash.Hash) ([]byte, error) {
+	d := NewDecoder(r)
+	var n [8]byte
+	for {
+		pkt, err := d.DecodePacket()
+		if err == io.EOF {
+			return h.Sum(nil), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if pkt.Serial != serial {
+			continue
+		}
+
+		byteOrder.PutUint64(n[:], uint64(len(pkt.Data)))
+		h.Write(n[:])
+		h.Write(pkt.Data)
+	}
+}
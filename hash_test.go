@@ -0,0 +1,62 @@
+package ogg
+
+import (
+	"bytes"
+	"crypto/md5"
+	"testing"
+)
+
+func TestStreamHash(t *testing.T) {
+	packets := [][]byte{[]byte("head"), make([]byte, 1000), []byte("a"), []byte("b")}
+
+	// the same packets, paged two ways, and multiplexed with another stream
+	var one, two bytes.Buffer
+	e := NewEncoder(1, &one)
+	if err := e.EncodeBOS(0, packets[:1]); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.EncodeEOS(3, packets[1:]); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+	e = NewEncoder(1, &two)
+	o := NewEncoder(2, &two)
+	if err := e.EncodeBOS(0, packets[:1]); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := o.EncodeBOS(0, [][]byte{[]byte("other")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	for i, p := range packets[1:] {
+		if err := e.Encode(int64(i+1), [][]byte{p}); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+	}
+
+	h1, err := StreamHash(bytes.NewReader(one.Bytes()), 1)
+	if err != nil {
+		t.Fatal("unexpected StreamHash error:", err)
+	}
+	h2, err := StreamHash(bytes.NewReader(two.Bytes()), 1)
+	if err != nil {
+		t.Fatal("unexpected StreamHash error:", err)
+	}
+	if len(h1) != 32 || !bytes.Equal(h1, h2) {
+		t.Fatalf("expected equal SHA-256 digests, got %x and %x", h1, h2)
+	}
+
+	h3, err := StreamHash(bytes.NewReader(two.Bytes()), 2)
+	if err != nil {
+		t.Fatal("unexpected StreamHash error:", err)
+	}
+	if bytes.Equal(h1, h3) {
+		t.Fatal("expected distinct streams to have distinct digests")
+	}
+
+	h4, err := StreamHashWith(bytes.NewReader(one.Bytes()), 1, md5.New())
+	if err != nil {
+		t.Fatal("unexpected StreamHashWith error:", err)
+	}
+	if len(h4) != md5.Size {
+		t.Fatal("expected an MD5 digest, got", len(h4), "bytes")
+	}
+}
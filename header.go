@@ -38,6 +38,33 @@ type pageHeader struct {
 	Nsegs         byte    // 26
 }
 
+// parseHeader parses a page header from the first headsz bytes of b.
+func parseHeader(b []byte) pageHeader {
+	var h pageHeader
+	copy(h.OggS[:], b[0:4])
+	h.StreamVersion = b[4]
+	h.HeaderType = b[5]
+	h.Granule = int64(byteOrder.Uint64(b[6:14]))
+	h.Serial = byteOrder.Uint32(b[14:18])
+	h.Page = byteOrder.Uint32(b[18:22])
+	h.Crc = byteOrder.Uint32(b[22:26])
+	h.Nsegs = b[26]
+	return h
+}
+
+// pageSize returns the size of the page starting at b, per its header and segment table.
+// If b doesn't hold them both, ok is false.
+func pageSize(b []byte) (size int, ok bool) {
+	if len(b) < headsz || len(b) < headsz+int(b[26]) {
+		return 0, false
+	}
+	size = headsz + int(b[26])
+	for _, l := range b[headsz:size] {
+		size += int(l)
+	}
+	return size, true
+}
+
 const (
 	// Continuation of packet
 	COP byte = 1 << iota
@@ -116,7 +143,11 @@ var crcTable = [256]uint32{
 
 // "unreflected" crc used by libogg
 func crc32(p []byte) uint32 {
-	c := uint32(0)
+	return crcUpdate(0, p)
+}
+
+// crcUpdate returns the crc c continued over p.
+func crcUpdate(c uint32, p []byte) uint32 {
 	for _, n := range p {
 		c = crcTable[byte(c>>24)^n] ^ (c << 8)
 	}
@@ -0,0 +1,55 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"testing"
+)
+
+func TestBuildIndex(t *testing.T) {
+	var b bytes.Buffer
+	b.WriteString("junk")
+	a, v := NewEncoder(1, &b), NewEncoder(2, &b)
+	for i := int64(0); i < 20; i++ {
+		// long packets, continued on pages without granule positions
+		if err := a.EncodePackets([]Packet{{Data: make([]byte, int(i)*10000), Granule: i * 1000}}); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+		if err := v.Encode(i, [][]byte{[]byte("v")}); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+	}
+	stream := b.Bytes()
+
+	rs := bytes.NewReader(stream)
+	if _, err := rs.Seek(2, io.SeekStart); err != nil {
+		t.Fatal("unexpected Seek error:", err)
+	}
+	index, err := BuildIndex(rs, 1)
+	if err != nil {
+		t.Fatal("unexpected BuildIndex error:", err)
+	}
+	if pos, _ := rs.Seek(0, io.SeekCurrent); pos != 2 {
+		t.Fatal("expected rs to be returned to 2, got", pos)
+	}
+	if len(index) != 20 {
+		t.Fatal("expected 20 entries, got", len(index))
+	}
+
+	for i, entry := range index {
+		if entry.Granule != int64(i)*1000 {
+			t.Fatalf("entry %d: expected granule %d, got %d", i, i*1000, entry.Granule)
+		}
+		p, _, err := NewDecoder(bytes.NewReader(stream[entry.Offset:])).Decode()
+		if err != nil || p.Serial != 1 || p.Granule != entry.Granule {
+			t.Fatalf("entry %d: expected a page of stream 1 at %d, got %d at %d, %v", i, entry.Offset, p.Serial, p.Granule, err)
+		}
+	}
+
+	// the page containing granule 4500 follows the one ending at 4000
+	i := sort.Search(len(index), func(i int) bool { return index[i].Granule >= 4500 }) - 1
+	if index[i].Granule != 4000 {
+		t.Fatal("expected to find the page ending at 4000, got", index[i].Granule)
+	}
+}
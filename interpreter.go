@@ -0,0 +1,159 @@
+package ogg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sync"
+	"time"
+)
+
+// A GranuleInterpreter converts the granule positions of a logical stream to times.
+// It's created by the factory registered for the stream's codec, from the stream's first packet.
+type GranuleInterpreter interface {
+	// RateHz returns the number of granules per second, rounded to the nearest integer
+	// for codecs whose rate isn't whole, or whose positions don't simply count.
+	RateHz() int
+	// GranuleToDuration returns the presentation time at the given granule position.
+	GranuleToDuration(granule int64) time.Duration
+}
+
+// A codecFactory is a registered GranuleInterpreter factory.
+type codecFactory struct {
+	magic   []byte
+	factory func(bosPacket []byte) (GranuleInterpreter, error)
+}
+
+var (
+	codecFactoriesMu sync.RWMutex
+	codecFactories   = []codecFactory{
+		{[]byte("OpusHead"), newSampleInterpreter},
+		{[]byte("\x01vorbis"), newSampleInterpreter},
+		{[]byte("\x80theora"), newTheoraInterpreter},
+		{[]byte("Speex   "), newSampleInterpreter},
+		{[]byte("\x7fFLAC"), newSampleInterpreter},
+	}
+)
+
+// RegisterCodec registers a factory of GranuleInterpreters for the logical streams
+// whose first packet begins with magic, for NewGranuleInterpreter and Decoder.Timestamps.
+// A codec registered later takes precedence, so RegisterCodec can replace a built-in one:
+// Opus, Vorbis, Theora, Speex, and FLAC are registered already.
+// RegisterCodec is safe to call concurrently, but is usually called from an init function.
+func RegisterCodec(magic []byte, factory func(bosPacket []byte) (GranuleInterpreter, error)) {
+	codecFactoriesMu.Lock()
+	defer codecFactoriesMu.Unlock()
+	codecFactories = append(codecFactories, codecFactory{append([]byte(nil), magic...), factory})
+}
+
+// NewGranuleInterpreter returns a GranuleInterpreter for the logical stream whose first packet is bosPacket,
+// from the factory registered for its codec.
+// The error is ErrUnsupportedCodec if no codec's magic matches, or else the factory's error.
+func NewGranuleInterpreter(bosPacket []byte) (GranuleInterpreter, error) {
+	codecFactoriesMu.RLock()
+	var factory func([]byte) (GranuleInterpreter, error)
+	for i := len(codecFactories) - 1; i >= 0; i-- {
+		if bytes.HasPrefix(bosPacket, codecFactories[i].magic) {
+			factory = codecFactories[i].factory
+			break
+		}
+	}
+	codecFactoriesMu.RUnlock()
+
+	if factory == nil {
+		return nil, ErrUnsupportedCodec
+	}
+	return factory(bosPacket)
+}
+
+// A sampleInterpreter interprets the granule positions of codecs that count samples,
+// from the granule position at which presentation starts.
+type sampleInterpreter struct {
+	rate, start int64
+}
+
+func newSampleInterpreter(bos []byte) (GranuleInterpreter, error) {
+	rate, start, ok := granuleRate(bos)
+	if !ok {
+		// for the error
+		_, err := GranuleRate(bos)
+		return nil, err
+	}
+	return sampleInterpreter{rate, start}, nil
+}
+
+func (s sampleInterpreter) RateHz() int {
+	return int(s.rate)
+}
+
+func (s sampleInterpreter) GranuleToDuration(granule int64) time.Duration {
+	return granuleDuration(granule-s.start, s.rate)
+}
+
+// A theoraInterpreter interprets Theora granule positions,
+// whose upper bits are the frame number of the last keyframe, and lower bits the frames since.
+type theoraInterpreter struct {
+	num, den int64 // the frame rate, as a fraction
+	shift    uint  // the number of lower bits
+	// 1 before version 3.2.1, whose positions number frames from 0 rather than 1,
+	// so that the frames displayed by the end of a position's frame are iframe+pframe+offset
+	offset int64
+}
+
+func newTheoraInterpreter(bos []byte) (GranuleInterpreter, error) {
+	shift, err := TheoraKeyframeShift(bos)
+	if err != nil {
+		return nil, err
+	}
+	t := theoraInterpreter{
+		num:   int64(binary.BigEndian.Uint32(bos[22:])),
+		den:   int64(binary.BigEndian.Uint32(bos[26:])),
+		shift: shift,
+	}
+	if v := int(bos[7])<<16 | int(bos[8])<<8 | int(bos[9]); v < 0x030201 {
+		t.offset = 1
+	}
+	return t, nil
+}
+
+func (t theoraInterpreter) RateHz() int {
+	return int((t.num + t.den/2) / t.den)
+}
+
+// GranuleToDuration splits the granule position unsigned, so it's correct over the whole 64 bits,
+// though positions beyond time.Duration's range of about 292 years give its maximum.
+func (t theoraInterpreter) GranuleToDuration(granule int64) time.Duration {
+	keyframe, delta := SplitTheoraGranule(uint64(granule), t.shift)
+	frames := keyframe + delta + uint64(t.offset)
+	if frames > math.MaxInt64/uint64(t.den) || int64(frames)*t.den/t.num > math.MaxInt64/int64(time.Second) {
+		return math.MaxInt64
+	}
+	return granuleDuration(int64(frames)*t.den, t.num)
+}
+
+// TheoraKeyframeShift returns the keyframe granule shift, KFGSHIFT, of the Theora stream
+// whose first packet is bosPacket: the number of lower bits of its granule positions
+// that count the frames since the last keyframe.
+// The error is ErrBadCodecHeader if bosPacket is too short to hold it, or GranuleRate's.
+func TheoraKeyframeShift(bosPacket []byte) (uint, error) {
+	if IdentifyCodec(bosPacket) != CodecTheora {
+		return 0, ErrUnsupportedCodec
+	}
+	if _, err := GranuleRate(bosPacket); err != nil {
+		return 0, err
+	}
+	// the keyframe shift is 5 bits, following the 6-bit quality after the 24-bit bitrate
+	if len(bosPacket) < 42 {
+		return 0, ErrBadCodecHeader
+	}
+	return uint(bosPacket[40]&3)<<3 | uint(bosPacket[41]>>5), nil
+}
+
+// SplitTheoraGranule splits a Theora granule position, as returned by Page.GranuleUint64,
+// into the frame number of the last keyframe, in its upper bits, and the frames since, in its lower shift bits,
+// where shift is the stream's TheoraKeyframeShift.
+// The split is unsigned, so positions whose keyframe numbers reach the top bit,
+// which would be negative as an int64, split correctly.
+func SplitTheoraGranule(granule uint64, shift uint) (keyframe, delta uint64) {
+	return granule >> shift, granule & (1<<shift - 1)
+}
@@ -0,0 +1,155 @@
+package ogg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// theoraIDPacket returns a Theora identification header of the given version,
+// at 30 frames per second with a keyframe shift of 6.
+func theoraIDPacket(major, minor, rev byte) []byte {
+	theora := make([]byte, 42)
+	copy(theora, "\x80theora")
+	theora[7], theora[8], theora[9] = major, minor, rev
+	binary.BigEndian.PutUint32(theora[22:], 30)
+	binary.BigEndian.PutUint32(theora[26:], 1)
+	theora[41] = 6 << 5
+	return theora
+}
+
+func TestNewGranuleInterpreter(t *testing.T) {
+	tests := []struct {
+		bos     []byte
+		granule int64
+		rate    int
+		want    time.Duration
+		err     error
+	}{
+		{opusHeadPacket(2, 312), 48312, 48000, time.Second, nil},
+		{vorbisIDPacket(44100, 8, 11), 22050, 44100, 500 * time.Millisecond, nil},
+		// the 5th frame after the keyframe at frame 10
+		{theoraIDPacket(3, 2, 1), 10<<6 + 5, 30, 500 * time.Millisecond, nil},
+		{theoraIDPacket(3, 2, 0), 10<<6 + 5, 30, 16 * time.Second / 30, nil},
+		{theoraIDPacket(3, 2, 1)[:41], 0, 0, 0, ErrBadCodecHeader},
+		{[]byte("OpusHead"), 0, 0, 0, ErrBadOpusHead},
+		{[]byte("mystery"), 0, 0, 0, ErrUnsupportedCodec},
+	}
+	for i, test := range tests {
+		gi, err := NewGranuleInterpreter(test.bos)
+		if err != test.err {
+			t.Fatalf("%d: expected error %v, got %v", i, test.err, err)
+		}
+		if err != nil {
+			continue
+		}
+		if rate := gi.RateHz(); rate != test.rate {
+			t.Fatalf("%d: expected rate %d, got %d", i, test.rate, rate)
+		}
+		if d := gi.GranuleToDuration(test.granule); d != test.want {
+			t.Fatalf("%d: expected %v at %d, got %v", i, test.want, test.granule, d)
+		}
+	}
+}
+
+func TestSplitTheoraGranule(t *testing.T) {
+	bos := theoraIDPacket(3, 2, 1)
+	shift, err := TheoraKeyframeShift(bos)
+	if err != nil || shift != 6 {
+		t.Fatalf("expected shift 6, got %d, %v", shift, err)
+	}
+	if _, err := TheoraKeyframeShift(opusHeadPacket(2, 0)); err != ErrUnsupportedCodec {
+		t.Fatal("expected ErrUnsupportedCodec for Opus, got", err)
+	}
+
+	tests := []struct {
+		keyframe, delta uint64
+	}{
+		// either side of the split
+		{1, 63},
+		{2, 0},
+		// a keyframe number reaching the top bit, negative as an int64
+		{1<<57 | 5, 63},
+	}
+	for _, test := range tests {
+		p := Page{Granule: int64(test.keyframe<<shift | test.delta)}
+		keyframe, delta := SplitTheoraGranule(p.GranuleUint64(), shift)
+		if keyframe != test.keyframe || delta != test.delta {
+			t.Fatalf("expected keyframe %d and delta %d, got %d and %d", test.keyframe, test.delta, keyframe, delta)
+		}
+	}
+
+	gi, err := NewGranuleInterpreter(bos)
+	if err != nil {
+		t.Fatal("unexpected NewGranuleInterpreter error:", err)
+	}
+	// a long video's frame count, then one beyond time.Duration
+	frames := uint64(1<<30 + 63)
+	if d := gi.GranuleToDuration(int64(1<<30<<shift | 63)); d != time.Duration(frames)*time.Second/30 {
+		t.Fatal("expected", time.Duration(frames)*time.Second/30, "got", d)
+	}
+	if d := gi.GranuleToDuration(int64((1<<57 | 5) << shift)); d != math.MaxInt64 {
+		t.Fatal("expected the maximum duration, got", d)
+	}
+}
+
+// A frameInterpreter counts granules as frames of a fixed duration.
+type frameInterpreter time.Duration
+
+func (f frameInterpreter) RateHz() int {
+	return int(time.Second / time.Duration(f))
+}
+
+func (f frameInterpreter) GranuleToDuration(granule int64) time.Duration {
+	return time.Duration(granule) * time.Duration(f)
+}
+
+func TestRegisterCodec(t *testing.T) {
+	saved := codecFactories
+	defer func() { codecFactories = saved }()
+
+	errBadFrames := errors.New("bad frames header")
+	RegisterCodec([]byte("FRAMES"), func(bos []byte) (GranuleInterpreter, error) {
+		if len(bos) < 7 {
+			return nil, errBadFrames
+		}
+		return frameInterpreter(time.Duration(bos[6]) * time.Millisecond), nil
+	})
+	// replace the built-in Vorbis interpreter
+	RegisterCodec([]byte("\x01vorbis"), func(bos []byte) (GranuleInterpreter, error) {
+		return frameInterpreter(time.Millisecond), nil
+	})
+
+	if _, err := NewGranuleInterpreter([]byte("FRAMES")); err != errBadFrames {
+		t.Fatal("expected the factory's error, got", err)
+	}
+
+	var b bytes.Buffer
+	frames := NewEncoder(1, &b)
+	vorbis := NewEncoder(2, &b)
+	for i, err := range []error{
+		frames.EncodeBOS(0, [][]byte{[]byte("FRAMES\x28")}),
+		vorbis.EncodeBOS(0, [][]byte{vorbisIDPacket(44100, 8, 11)}),
+		frames.EncodeEOS(25, [][]byte{[]byte("frame")}),
+		vorbis.EncodeEOS(2000, [][]byte{[]byte("audio")}),
+	} {
+		if err != nil {
+			t.Fatalf("%d: unexpected encoding error: %v", i, err)
+		}
+	}
+
+	d := NewDecoder(bytes.NewReader(b.Bytes()))
+	d.Timestamps = true
+	for i, want := range []time.Duration{0, 0, time.Second, 2 * time.Second} {
+		p, _, err := d.Decode()
+		if err != nil {
+			t.Fatalf("%d: unexpected Decode error: %v", i, err)
+		}
+		if p.Timestamp != want {
+			t.Fatalf("%d: expected timestamp %v, got %v", i, want, p.Timestamp)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package ogg
+
+import (
+	"sync"
+	"time"
+)
+
+// A LatencyEncoder buffers packets for an Encoder, so that several can share a page,
+// while bounding how long any packet waits to be written.
+// Buffered packets are written as a page once maxLatency has passed since
+// the first of them was buffered, once they fill a page, or on Flush or Close.
+//
+// Pages written when the latency expires are written from a timer goroutine,
+// so the LatencyEncoder's methods are safe to call concurrently, and
+// the Encoder must not be used directly while the LatencyEncoder is in use.
+// Write any header pages with the Encoder before wrapping it.
+// An error from writing on the timer goroutine is returned by the next method call,
+// and every one thereafter.
+type LatencyEncoder struct {
+	mu         sync.Mutex
+	e          *Encoder
+	maxLatency time.Duration
+	timer      *time.Timer
+	// incremented with each flush, so a stale timer can tell it's stale
+	gen      int
+	packets  [][]byte
+	segments int
+	granule  int64
+	err      error
+}
+
+// NewLatencyEncoder creates a LatencyEncoder writing pages with e.
+func NewLatencyEncoder(e *Encoder, maxLatency time.Duration) *LatencyEncoder {
+	return &LatencyEncoder{e: e, maxLatency: maxLatency}
+}
+
+// Encode buffers a data packet, whose granule position is granule.
+// The packet is copied, so the caller may reuse it.
+func (l *LatencyEncoder) Encode(granule int64, packet []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+
+	segs := len(packet)/mss + 1
+	if len(l.packets) > 0 && l.segments+segs > mss {
+		if err := l.flush(0); err != nil {
+			return err
+		}
+	}
+
+	if len(l.packets) == 0 {
+		gen := l.gen
+		l.timer = time.AfterFunc(l.maxLatency, func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.gen == gen && l.err == nil {
+				l.flush(0)
+			}
+		})
+	}
+
+	l.packets = append(l.packets, append([]byte(nil), packet...))
+	l.segments += segs
+	l.granule = granule
+	return nil
+}
+
+// Flush writes any buffered packets as a page immediately.
+func (l *LatencyEncoder) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	if len(l.packets) == 0 {
+		return nil
+	}
+	return l.flush(0)
+}
+
+// Close writes any buffered packets as the EOS page of the stream,
+// using granule as its granule position. If no packets are buffered,
+// the EOS page holds one empty packet.
+// The LatencyEncoder must not be used afterward.
+func (l *LatencyEncoder) Close(granule int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	l.granule = granule
+	return l.flush(EOS)
+}
+
+// flush writes the buffered packets as a page of the given kind.
+// l.mu must be held.
+func (l *LatencyEncoder) flush(kind byte) error {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.gen++
+
+	var err error
+	if kind == EOS {
+		err = l.e.EncodeEOS(l.granule, l.packets)
+	} else {
+		err = l.e.Encode(l.granule, l.packets)
+	}
+	l.packets = l.packets[:0]
+	l.segments = 0
+	l.err = err
+	return err
+}
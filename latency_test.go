@@ -0,0 +1,103 @@
+package ogg
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pageWriter records each Write, which for an Encoder is a page, and signals it.
+type pageWriter struct {
+	mu    sync.Mutex
+	pages [][]byte
+	wrote chan struct{}
+}
+
+func (w *pageWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.pages = append(w.pages, append([]byte(nil), p...))
+	w.mu.Unlock()
+	w.wrote <- struct{}{}
+	return len(p), nil
+}
+
+func (w *pageWriter) page(t *testing.T, i int) Page {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	p, _, err := NewDecoder(bytes.NewReader(w.pages[i])).Decode()
+	if err != nil {
+		t.Fatal("unexpected Decode error:", err)
+	}
+	return p
+}
+
+func TestLatencyEncoder(t *testing.T) {
+	w := &pageWriter{wrote: make(chan struct{}, 10)}
+	l := NewLatencyEncoder(NewEncoder(1, w), 10*time.Millisecond)
+
+	if err := l.Encode(1, []byte("a")); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := l.Encode(2, []byte("b")); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+
+	select {
+	case <-w.wrote:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the latency bound did not flush the page")
+	}
+	p := w.page(t, 0)
+	if p.Granule != 2 || len(p.Packets) != 2 || string(p.Packets[1]) != "b" {
+		t.Fatalf("unexpected page: %+v", p)
+	}
+
+	// An explicit flush writes right away, and the timer it preempts must not write again.
+	if err := l.Encode(3, []byte("c")); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := l.Flush(); err != nil {
+		t.Fatal("unexpected Flush error:", err)
+	}
+	<-w.wrote
+	if err := l.Close(4); err != nil {
+		t.Fatal("unexpected Close error:", err)
+	}
+	<-w.wrote
+
+	time.Sleep(30 * time.Millisecond)
+	w.mu.Lock()
+	n := len(w.pages)
+	w.mu.Unlock()
+	if n != 3 {
+		t.Fatalf("expected 3 pages, got %d", n)
+	}
+	if p := w.page(t, 1); p.Granule != 3 || string(p.Packets[0]) != "c" {
+		t.Fatalf("unexpected page: %+v", p)
+	}
+	if p := w.page(t, 2); p.Type != EOS || p.Granule != 4 {
+		t.Fatalf("unexpected page: %+v", p)
+	}
+}
+
+func TestLatencyEncoderFullPage(t *testing.T) {
+	w := &pageWriter{wrote: make(chan struct{}, 10)}
+	l := NewLatencyEncoder(NewEncoder(1, w), time.Hour)
+
+	pkt := bytes.Repeat([]byte("x"), 300) // 2 segments each
+	for i := 0; i < 128; i++ {
+		if err := l.Encode(int64(i), pkt); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+	}
+
+	select {
+	case <-w.wrote:
+	default:
+		t.Fatal("expected a full page to be written")
+	}
+	if p := w.page(t, 0); len(p.Packets) != 127 || p.Granule != 126 {
+		t.Fatalf("unexpected page: %d packets, granule %d", len(p.Packets), p.Granule)
+	}
+}
@@ -0,0 +1,72 @@
+package ogg
+
+import "time"
+
+// A LazyPage is a Page as returned by Decoder.DecodeLazy,
+// whose packets are sliced from its payload only when asked for.
+// Its fields are those of Page, but for Packets.
+type LazyPage struct {
+	Type       byte
+	Serial     uint32
+	Granule    int64
+	Sequence   uint32
+	Unfinished bool
+	Resynced   bool
+	Size       int
+	Duplicate  bool
+	Timestamp  time.Duration
+	Raw        []byte
+
+	// the lengths of the packets, and the payload holding them
+	lens    []int
+	payload []byte
+}
+
+// NumPackets returns the number of packets on the page,
+// including a continued first packet and an unfinished last one, as in Page.Packets.
+func (p LazyPage) NumPackets() int {
+	return len(p.lens)
+}
+
+// Packet returns the page's packet i, the slice Page.Packets[i] would be.
+// It panics if i is out of range, like indexing Packets.
+func (p LazyPage) Packet(i int) []byte {
+	s := 0
+	for _, l := range p.lens[:i] {
+		s += l
+	}
+	return p.payload[s : s+p.lens[i]]
+}
+
+// PacketAt is like Packet, but returns ErrPacketIndex rather than panicking if i is out of range.
+// Only the lengths of the packets before i are summed to find it, and no other packet is sliced.
+// The packet is in the Decoder's buffer, valid until its next call, unless Decoder.CopyPackets is set.
+func (p LazyPage) PacketAt(i int) ([]byte, error) {
+	if i < 0 || i >= len(p.lens) {
+		return nil, ErrPacketIndex
+	}
+	return p.Packet(i), nil
+}
+
+// page returns the Page p is a lazy form of, slicing all its packets.
+func (p LazyPage) page() Page {
+	packets := make([][]byte, len(p.lens))
+	s := 0
+	for i, l := range p.lens {
+		packets[i] = p.payload[s : s+l]
+		s += l
+	}
+	return Page{
+		Type:       p.Type,
+		Serial:     p.Serial,
+		Granule:    p.Granule,
+		Sequence:   p.Sequence,
+		Packets:    packets,
+		Unfinished: p.Unfinished,
+		Resynced:   p.Resynced,
+		Size:       p.Size,
+		Duplicate:  p.Duplicate,
+		Timestamp:  p.Timestamp,
+		Raw:        p.Raw,
+	}
+}
@@ -0,0 +1,109 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeLazy(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("header")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.Encode(3, [][]byte{[]byte("one"), {}, bytes.Repeat([]byte{'x'}, 600)}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := e.EncodeEOS(4, [][]byte{[]byte("two")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	d := NewDecoder(bytes.NewReader(b.Bytes()))
+	d.CopyPackets = true
+	lazy := NewDecoder(bytes.NewReader(b.Bytes()))
+	lazy.CopyPackets = true
+	for {
+		want, wn, werr := d.Decode()
+		p, n, err := lazy.DecodeLazy()
+		if err != werr || n != wn {
+			t.Fatalf("expected %d, %v, got %d, %v", wn, werr, n, err)
+		}
+		if err == io.EOF {
+			break
+		}
+		if p.NumPackets() != len(want.Packets) {
+			t.Fatalf("expected %d packets, got %d", len(want.Packets), p.NumPackets())
+		}
+		for i := range want.Packets {
+			if !bytes.Equal(p.Packet(i), want.Packets[i]) {
+				t.Fatalf("packet %d: expected %q, got %q", i, want.Packets[i], p.Packet(i))
+			}
+		}
+		if !reflect.DeepEqual(p.page(), want) {
+			t.Fatalf("expected page %+v, got %+v", want, p.page())
+		}
+	}
+
+	// Once a stream is tracked, decoding its pages lazily allocates nothing.
+	b.Reset()
+	e = NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("header")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	for i := 0; i < 200; i++ {
+		if err := e.Encode(int64(i), [][]byte{[]byte("one"), []byte("two")}); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+	}
+	d = NewDecoder(bytes.NewReader(b.Bytes()))
+	if _, _, err := d.DecodeLazy(); err != nil {
+		t.Fatal("unexpected DecodeLazy error:", err)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		p, _, err := d.DecodeLazy()
+		if err != nil {
+			t.Fatal("unexpected DecodeLazy error:", err)
+		}
+		p.Packet(p.NumPackets() - 1)
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations, got %v", allocs)
+	}
+}
+
+func TestPacketAt(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.Encode(3, [][]byte{[]byte("one"), {}, bytes.Repeat([]byte{'x'}, 600)}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+
+	p, _, err := NewDecoder(bytes.NewReader(b.Bytes())).Decode()
+	if err != nil {
+		t.Fatal("unexpected Decode error:", err)
+	}
+	lp, _, err := NewDecoder(bytes.NewReader(b.Bytes())).DecodeLazy()
+	if err != nil {
+		t.Fatal("unexpected DecodeLazy error:", err)
+	}
+	for i, want := range p.Packets {
+		pkt, err := p.PacketAt(i)
+		if err != nil || !bytes.Equal(pkt, want) {
+			t.Fatalf("packet %d: expected %q, got %q, %v", i, want, pkt, err)
+		}
+		pkt, err = lp.PacketAt(i)
+		if err != nil || !bytes.Equal(pkt, want) {
+			t.Fatalf("lazy packet %d: expected %q, got %q, %v", i, want, pkt, err)
+		}
+	}
+	for _, i := range []int{-1, 3} {
+		if _, err := p.PacketAt(i); err != ErrPacketIndex {
+			t.Fatalf("packet %d: expected ErrPacketIndex, got %v", i, err)
+		}
+		if _, err := lp.PacketAt(i); err != ErrPacketIndex {
+			t.Fatalf("lazy packet %d: expected ErrPacketIndex, got %v", i, err)
+		}
+	}
+}
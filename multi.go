@@ -0,0 +1,87 @@
+package ogg
+
+import (
+	"io"
+	"strconv"
+)
+
+// ErrWriterFailed is the error of one of a MultiEncoder's Writers, identified by its index among them.
+type ErrWriterFailed struct {
+	Index int
+	Err   error
+}
+
+func (e ErrWriterFailed) Error() string {
+	return "writer " + strconv.Itoa(e.Index) + ": " + e.Err.Error()
+}
+
+// A MultiEncoder is an Encoder that writes its pages to several Writers, as for saving a stream
+// while streaming it. Unlike with io.MultiWriter, a Writer that fails doesn't affect the others:
+// each page is written to each Writer whole, in a single Write, so every Writer that hasn't failed
+// has received whole pages, up to and including the last one written.
+// The Writers are written to in turn, so a slow one holds up the others.
+type MultiEncoder struct {
+	*Encoder
+
+	// DropFailed makes the MultiEncoder drop a Writer that fails and carry on with the others,
+	// returning an error only once they've all failed.
+	// Otherwise, which is the default, a failure stops the MultiEncoder:
+	// the page is still written to the other Writers, so that they end on a page boundary,
+	// but the failure is returned, as an ErrWriterFailed, and every later call returns it
+	// without writing anything.
+	DropFailed bool
+
+	ws   []io.Writer
+	errs []error
+	err  error
+}
+
+// NewMultiEncoder creates a MultiEncoder of the logical stream with the given serial number,
+// writing to ws.
+func NewMultiEncoder(serial uint32, ws ...io.Writer) *MultiEncoder {
+	m := &MultiEncoder{ws: ws, errs: make([]error, len(ws))}
+	m.Encoder = NewEncoder(serial, (*multiWriter)(m))
+	return m
+}
+
+// Errs returns the errors of the Writers that have failed, by their index, or nil for those that haven't.
+func (m *MultiEncoder) Errs() []error {
+	return append([]error(nil), m.errs...)
+}
+
+// A multiWriter is the Writer of a MultiEncoder's Encoder.
+type multiWriter MultiEncoder
+
+func (mw *multiWriter) Write(p []byte) (int, error) {
+	m := (*MultiEncoder)(mw)
+	if m.err != nil {
+		return 0, m.err
+	}
+
+	var first error
+	live := 0
+	for i, w := range m.ws {
+		if m.errs[i] != nil {
+			continue
+		}
+		n, err := w.Write(p)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			m.errs[i] = err
+			if first == nil {
+				first = ErrWriterFailed{i, err}
+			}
+			continue
+		}
+		live++
+	}
+
+	// Unless DropFailed, any failure stops m, as does the failure of the last Writer left.
+	if first != nil && (!m.DropFailed || live == 0) {
+		m.err = first
+		return 0, first
+	}
+	return len(p), nil
+}
@@ -0,0 +1,94 @@
+package ogg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// A failingWriter fails once it has been written to n times, writing half of that Write.
+type failingWriter struct {
+	bytes.Buffer
+	n int
+}
+
+var errFailingWriter = errors.New("failing writer failed")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		w.Buffer.Write(p[:len(p)/2])
+		return len(p) / 2, errFailingWriter
+	}
+	w.n--
+	return w.Buffer.Write(p)
+}
+
+func TestMultiEncoder(t *testing.T) {
+	for _, drop := range []bool{false, true} {
+		var a, c bytes.Buffer
+		b := &failingWriter{n: 2}
+		m := NewMultiEncoder(1, &a, b, &c)
+		m.DropFailed = drop
+
+		var errs []error
+		for i := 0; i < 5; i++ {
+			var err error
+			if i == 0 {
+				err = m.EncodeBOS(0, [][]byte{[]byte("head")})
+			} else if i < 4 {
+				err = m.Encode(int64(i), [][]byte{[]byte("data")})
+			} else {
+				err = m.EncodeEOS(int64(i), [][]byte{[]byte("end")})
+			}
+			errs = append(errs, err)
+		}
+
+		want := ErrWriterFailed{1, errFailingWriter}
+		pages := 5
+		if drop {
+			for i, err := range errs {
+				if err != nil {
+					t.Fatalf("dropping: unexpected error encoding page %d: %v", i, err)
+				}
+			}
+		} else {
+			pages = 3
+			for i, err := range errs {
+				if i < 2 && err != nil || i >= 2 && err != want {
+					t.Fatalf("page %d: expected error %v, got %v", i, i >= 2, err)
+				}
+			}
+		}
+		if got := m.Errs(); len(got) != 3 || got[0] != nil || got[1] != errFailingWriter || got[2] != nil {
+			t.Fatal("expected only writer 1 to have failed, got", got)
+		}
+
+		// The others got whole pages, up to the failure if it stopped the encoder.
+		for _, w := range []*bytes.Buffer{&a, &c} {
+			d := NewDecoder(w)
+			d.Conformance = ConformanceStrict
+			n := 0
+			for {
+				_, _, err := d.Decode()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal("unexpected Decode error:", err)
+				}
+				n++
+			}
+			if n != pages {
+				t.Fatalf("dropping %v: expected %d pages, got %d", drop, pages, n)
+			}
+		}
+	}
+
+	// Dropping every writer is a failure.
+	m := NewMultiEncoder(1, &failingWriter{})
+	m.DropFailed = true
+	if err := m.Encode(0, nil); err != (ErrWriterFailed{0, errFailingWriter}) {
+		t.Fatal("expected the last writer's failure, got", err)
+	}
+}
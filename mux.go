@@ -0,0 +1,159 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+// A MuxEncoder writes several logical streams, grouped, to one ogg stream.
+// Each stream's BOS page is written by AddStream, before any of the streams' other pages,
+// as RFC 3533 requires of grouped streams.
+type MuxEncoder struct {
+	// Interleave makes the MuxEncoder write pages in order of their end times,
+	// according to each stream's GranuleInterpreter, rather than in the order they're encoded,
+	// so that players needn't buffer one stream far ahead of another.
+	// Pages are buffered until every stream that hasn't ended has one buffered,
+	// and then the earliest is written, so the buffering is only as deep as the streams
+	// are encoded out of step.
+	// Interleave must be set before the first call to AddStream.
+	Interleave bool
+
+	w       io.Writer
+	streams map[uint32]*muxStream
+	// the streams, in the order they were added, which breaks ties between end times
+	order []*muxStream
+	data  bool
+}
+
+// A muxStream is a logical stream of a MuxEncoder.
+type muxStream struct {
+	e   *Encoder
+	buf bytes.Buffer
+	gi  GranuleInterpreter
+	// the end time of the last page encoded, which a page without a granule position keeps
+	end time.Duration
+	// the pages encoded but not yet written, with their end times
+	queue []muxPage
+	eos   bool
+}
+
+// A muxPage is the output of encoding a page, which may take more than one page if its packets are large.
+type muxPage struct {
+	data []byte
+	end  time.Duration
+}
+
+// NewMuxEncoder creates a MuxEncoder writing to w.
+func NewMuxEncoder(w io.Writer) *MuxEncoder {
+	return &MuxEncoder{w: w, streams: make(map[uint32]*muxStream)}
+}
+
+// AddStream starts a logical stream with the given serial number,
+// writing its BOS page, which holds bosPacket.
+// Its granule positions are interpreted by the GranuleInterpreter registered for its codec,
+// or by gi if it isn't nil, which lets Interleave order streams of unregistered codecs.
+// The error is ErrInterleave if any stream's other pages have been encoded,
+// ErrStreamBoundary if the serial number is already in use,
+// or, with Interleave set, NewGranuleInterpreter's if gi is nil.
+func (m *MuxEncoder) AddStream(serial uint32, bosPacket []byte, gi GranuleInterpreter) error {
+	if m.data {
+		return ErrInterleave{serial}
+	}
+	if m.streams[serial] != nil {
+		return ErrStreamBoundary{serial, "repeated BOS page"}
+	}
+	if gi == nil && m.Interleave {
+		var err error
+		if gi, err = NewGranuleInterpreter(bosPacket); err != nil {
+			return err
+		}
+	}
+
+	s := &muxStream{e: NewEncoder(serial, m.w), gi: gi}
+	if err := s.e.EncodeBOS(0, [][]byte{bosPacket}); err != nil {
+		return err
+	}
+	s.e.w = &s.buf
+	m.streams[serial] = s
+	m.order = append(m.order, s)
+	return nil
+}
+
+// Encode encodes the packets as a page of the stream with the given serial number,
+// as Encoder.Encode does, and writes it, unless Interleave has it buffered.
+// The error is ErrStreamBoundary if the stream hasn't been added, or has ended.
+func (m *MuxEncoder) Encode(serial uint32, granule int64, packets [][]byte) error {
+	return m.encode(serial, granule, packets, false)
+}
+
+// EncodeEOS is like Encode, but ends the stream with an EOS page.
+func (m *MuxEncoder) EncodeEOS(serial uint32, granule int64, packets [][]byte) error {
+	return m.encode(serial, granule, packets, true)
+}
+
+func (m *MuxEncoder) encode(serial uint32, granule int64, packets [][]byte, eos bool) error {
+	s := m.streams[serial]
+	if s == nil {
+		return ErrStreamBoundary{serial, "missing BOS page"}
+	}
+	if s.eos {
+		return ErrStreamBoundary{serial, "page after EOS page"}
+	}
+	m.data = true
+
+	var err error
+	if eos {
+		err = s.e.EncodeEOS(granule, packets)
+	} else {
+		err = s.e.Encode(granule, packets)
+	}
+	if err != nil {
+		return err
+	}
+	s.eos = eos
+
+	if !m.Interleave {
+		_, err := s.buf.WriteTo(m.w)
+		return err
+	}
+	if granule != -1 {
+		s.end = s.gi.GranuleToDuration(granule)
+	}
+	s.queue = append(s.queue, muxPage{append([]byte(nil), s.buf.Bytes()...), s.end})
+	s.buf.Reset()
+	return m.drain(false)
+}
+
+// drain writes the earliest buffered pages, for as long as every stream that hasn't ended has one,
+// or until none are left if all is set.
+func (m *MuxEncoder) drain(all bool) error {
+	for {
+		var next *muxStream
+		for _, s := range m.order {
+			if len(s.queue) == 0 {
+				if s.eos || all {
+					continue
+				}
+				// s may yet encode an earlier page
+				return nil
+			}
+			if next == nil || s.queue[0].end < next.queue[0].end {
+				next = s
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		if _, err := m.w.Write(next.queue[0].data); err != nil {
+			return err
+		}
+		next.queue = next.queue[1:]
+	}
+}
+
+// Flush writes any pages Interleave has buffered, in order of their end times.
+// Call it once every stream has been encoded.
+func (m *MuxEncoder) Flush() error {
+	return m.drain(true)
+}
@@ -0,0 +1,113 @@
+package ogg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func TestMuxEncoder(t *testing.T) {
+	// 10 frames per second
+	theora := theoraIDPacket(3, 2, 1)
+	binary.BigEndian.PutUint32(theora[22:], 10)
+	vorbis := vorbisIDPacket(1000, 8, 11)
+
+	mux := func(interleave bool) []string {
+		var b bytes.Buffer
+		m := NewMuxEncoder(&b)
+		m.Interleave = interleave
+		if err := m.AddStream(1, theora, nil); err != nil {
+			t.Fatal("unexpected AddStream error:", err)
+		}
+		if err := m.AddStream(2, vorbis, nil); err != nil {
+			t.Fatal("unexpected AddStream error:", err)
+		}
+
+		// a second of audio in pages of 250 ms, then of video in pages of a frame,
+		// the last of each on an EOS page
+		for i := int64(1); i <= 4; i++ {
+			encode := m.Encode
+			if i == 4 {
+				encode = m.EncodeEOS
+			}
+			if err := encode(2, i*250, [][]byte{[]byte("audio")}); err != nil {
+				t.Fatal("unexpected Encode error:", err)
+			}
+		}
+		for i := int64(1); i <= 10; i++ {
+			encode := m.Encode
+			if i == 10 {
+				encode = m.EncodeEOS
+			}
+			if err := encode(1, i, [][]byte{[]byte("video")}); err != nil {
+				t.Fatal("unexpected Encode error:", err)
+			}
+		}
+		if err := m.Flush(); err != nil {
+			t.Fatal("unexpected Flush error:", err)
+		}
+
+		var order []string
+		d := NewDecoder(bytes.NewReader(b.Bytes()))
+		d.Conformance = ConformanceStrict
+		for {
+			p, _, err := d.Decode()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal("unexpected Decode error:", err)
+			}
+			order = append(order, string(p.Packets[0][:1]))
+		}
+		if !d.CleanEOF() {
+			t.Fatal("expected every stream to end")
+		}
+		return order
+	}
+
+	tests := []struct {
+		interleave bool
+		want       string
+	}{
+		{false, "\x80\x01aaaavvvvvvvvvv"},
+		// by end time, with the video, added first, first on ties at 500 and 1000 ms
+		{true, "\x80\x01vvavvvavvavvva"},
+	}
+	for _, test := range tests {
+		got := ""
+		for _, s := range mux(test.interleave) {
+			got += s
+		}
+		if got != test.want {
+			t.Fatalf("interleave %v: expected pages %q, got %q", test.interleave, test.want, got)
+		}
+	}
+}
+
+func TestMuxEncoderErrors(t *testing.T) {
+	m := NewMuxEncoder(io.Discard)
+	m.Interleave = true
+	if err := m.AddStream(1, []byte("mystery"), nil); err != ErrUnsupportedCodec {
+		t.Fatal("expected ErrUnsupportedCodec, got", err)
+	}
+	if err := m.AddStream(1, []byte("mystery"), frameInterpreter(1)); err != nil {
+		t.Fatal("unexpected AddStream error:", err)
+	}
+	if err := m.AddStream(1, []byte("mystery"), frameInterpreter(1)); err != (ErrStreamBoundary{1, "repeated BOS page"}) {
+		t.Fatal("expected a repeated BOS error, got", err)
+	}
+	if err := m.Encode(2, 0, nil); err != (ErrStreamBoundary{2, "missing BOS page"}) {
+		t.Fatal("expected a missing BOS error, got", err)
+	}
+	if err := m.EncodeEOS(1, 0, nil); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+	if err := m.Encode(1, 0, nil); err != (ErrStreamBoundary{1, "page after EOS page"}) {
+		t.Fatal("expected a page after EOS error, got", err)
+	}
+	if err := m.AddStream(3, []byte("mystery"), frameInterpreter(1)); err != (ErrInterleave{3}) {
+		t.Fatal("expected ErrInterleave, got", err)
+	}
+}
@@ -0,0 +1,439 @@
+package ogg
+
+import (
+	"errors"
+)
+
+// The number of 48 kHz samples in one frame, by TOC config, per RFC 6716 section 3.1.
+var opusFrameSizes = [32]int{
+	// SILK-only NB, MB, WB: 10, 20, 40, 60 ms
+	480, 960, 1920, 2880,
+	480, 960, 1920, 2880,
+	480, 960, 1920, 2880,
+	// Hybrid SWB, FB: 10, 20 ms
+	480, 960,
+	480, 960,
+	// CELT-only NB, WB, SWB, FB: 2.5, 5, 10, 20 ms
+	120, 240, 480, 960,
+	120, 240, 480, 960,
+	120, 240, 480, 960,
+	120, 240, 480, 960,
+}
+
+// The largest frame allowed by RFC 6716.
+const maxOpusFrame = 1275
+
+// Errors describing malformed Opus packets, per the requirements of RFC 6716 section 3.4.
+var (
+	ErrOpusEmpty         = errors.New("empty opus packet")
+	ErrOpusFrameTooLarge = errors.New("opus frame exceeds 1275 bytes")
+	ErrOpusUnequalFrames = errors.New("opus code 1 packet has an odd payload size")
+	ErrOpusFrameLength   = errors.New("opus frame lengths exceed the packet")
+	ErrOpusFrameCount    = errors.New("opus code 3 frame count is not between 1 and 48")
+	ErrOpusPadding       = errors.New("opus padding exceeds the packet")
+	ErrOpusCBRSize       = errors.New("opus code 3 CBR payload is not a multiple of the frame count")
+	ErrOpusDuration      = errors.New("opus packet exceeds 120 ms")
+)
+
+// opusConfig returns the config number in an Opus TOC byte.
+func opusConfig(toc byte) byte {
+	return toc >> 3
+}
+
+// OpusIsStereo reports whether an Opus packet is coded in stereo, according to the 's' bit of its TOC byte.
+// This describes the coding of the packet only. The number of channels to output
+// is given by the stream's OpusHead, which for multichannel streams maps
+// the channels of several Opus streams onto its output channels.
+func OpusIsStereo(pkt []byte) (bool, error) {
+	if len(pkt) == 0 {
+		return false, ErrOpusEmpty
+	}
+	return pkt[0]&0x04 != 0, nil
+}
+
+// opusFrameCount returns the number of frames in pkt according to its TOC,
+// without checking that the rest of the packet is consistent with it.
+//
+// Codes 1 and 2 both carry two frames: code 1 frames are equal in compressed size,
+// while code 2 frames have independent (VBR) sizes. Either way, each frame
+// has the duration given by the config, so the count is all a duration needs.
+func opusFrameCount(pkt []byte) (int, error) {
+	if len(pkt) == 0 {
+		return 0, ErrOpusEmpty
+	}
+
+	switch pkt[0] & 0x03 {
+	case 0:
+		return 1, nil
+	case 1, 2:
+		return 2, nil
+	}
+
+	if len(pkt) < 2 {
+		return 0, errors.New("invalid opus packet: frame count code 3 but packet is too short")
+	}
+	n := int(pkt[1] & 0x3f)
+	if n < 1 {
+		return 0, errors.New("invalid opus packet: frame count code 3 but frame count is less than 1")
+	}
+	return n, nil
+}
+
+// opusSamples returns the number of 48 kHz samples in pkt.
+func opusSamples(pkt []byte) (int, error) {
+	n, err := opusFrameCount(pkt)
+	if err != nil {
+		return 0, err
+	}
+	return opusFrameSizes[opusConfig(pkt[0])] * n, nil
+}
+
+// OpusPacketSamples returns the number of 48 kHz samples in an Opus packet,
+// from the frame size and frame count given by its TOC byte, whatever the packet's coded rate.
+// Unlike Decoder.GetPacketDuration, it's exact, which granule positions, counting 48 kHz samples, need.
+// Like it, OpusPacketSamples doesn't check the rest of the packet; see ValidateOpusPacket.
+func OpusPacketSamples(pkt []byte) (int, error) {
+	return opusSamples(pkt)
+}
+
+// OpusAdvanceGranule returns the granule position reached from start by the Opus packets,
+// the sum of their OpusPacketSamples, as for planning where pages or segments will end before writing them.
+// The error is that of ValidateOpusPacket for the first malformed packet.
+func OpusAdvanceGranule(start int64, packets [][]byte) (int64, error) {
+	granule := start
+	for _, pkt := range packets {
+		if err := ValidateOpusPacket(pkt); err != nil {
+			return start, err
+		}
+		n, _ := opusSamples(pkt)
+		granule += int64(n)
+	}
+	return granule, nil
+}
+
+// opusFrameLen reads a frame length coded in one or two bytes from b,
+// returning the length and the number of bytes used to code it.
+func opusFrameLen(b []byte) (int, int, error) {
+	if len(b) < 1 {
+		return 0, 0, ErrOpusFrameLength
+	}
+	if b[0] < 252 {
+		return int(b[0]), 1, nil
+	}
+	if len(b) < 2 {
+		return 0, 0, ErrOpusFrameLength
+	}
+	return int(b[0]) + 4*int(b[1]), 2, nil
+}
+
+// SplitOpusFrames splits an Opus packet into its compressed frames,
+// following the frame packing of RFC 6716 section 3.2:
+//
+//	code 0: one frame
+//	code 1: two frames of equal compressed size
+//	code 2: two frames, the first with an explicit size (VBR)
+//	code 3: 1 to 48 frames, either CBR or VBR, with optional padding
+//
+// The frames alias pkt. Padding is not included in any frame.
+func SplitOpusFrames(pkt []byte) ([][]byte, error) {
+	if len(pkt) == 0 {
+		return nil, ErrOpusEmpty
+	}
+
+	data := pkt[1:]
+	switch pkt[0] & 0x03 {
+	case 0:
+		if len(data) > maxOpusFrame {
+			return nil, ErrOpusFrameTooLarge
+		}
+		return [][]byte{data}, nil
+
+	case 1:
+		if len(data)%2 != 0 {
+			return nil, ErrOpusUnequalFrames
+		}
+		n := len(data) / 2
+		if n > maxOpusFrame {
+			return nil, ErrOpusFrameTooLarge
+		}
+		return [][]byte{data[:n], data[n:]}, nil
+
+	case 2:
+		n, used, err := opusFrameLen(data)
+		if err != nil {
+			return nil, err
+		}
+		data = data[used:]
+		if n > len(data) {
+			return nil, ErrOpusFrameLength
+		}
+		if n > maxOpusFrame || len(data)-n > maxOpusFrame {
+			return nil, ErrOpusFrameTooLarge
+		}
+		return [][]byte{data[:n], data[n:]}, nil
+	}
+
+	count, err := opusFrameCount(pkt)
+	if err != nil {
+		return nil, ErrOpusFrameCount
+	}
+	vbr := pkt[1]&0x80 != 0
+	padded := pkt[1]&0x40 != 0
+	data = pkt[2:]
+
+	padding := 0
+	for padded {
+		if len(data) < 1 {
+			return nil, ErrOpusPadding
+		}
+		p := int(data[0])
+		data = data[1:]
+		if p == 255 {
+			padding += 254
+		} else {
+			padding += p
+			padded = false
+		}
+	}
+	if padding > len(data) {
+		return nil, ErrOpusPadding
+	}
+
+	lens := make([]int, count)
+	if vbr {
+		last := len(data) - padding
+		for i := 0; i < count-1; i++ {
+			n, used, err := opusFrameLen(data)
+			if err != nil {
+				return nil, err
+			}
+			lens[i] = n
+			data = data[used:]
+			last -= n + used
+		}
+		lens[count-1] = last
+		if last < 0 {
+			return nil, ErrOpusFrameLength
+		}
+	} else {
+		total := len(data) - padding
+		if total%count != 0 {
+			return nil, ErrOpusCBRSize
+		}
+		for i := range lens {
+			lens[i] = total / count
+		}
+	}
+
+	frames := make([][]byte, count)
+	for i, n := range lens {
+		if n > maxOpusFrame {
+			return nil, ErrOpusFrameTooLarge
+		}
+		frames[i] = data[:n]
+		data = data[n:]
+	}
+	return frames, nil
+}
+
+// ErrOpusStreamCount is the error used by ParseOpusMultistream for stream counts no OpusHead allows.
+var ErrOpusStreamCount = errors.New("invalid opus stream counts")
+
+// ParseOpusMultistream splits a packet of a multichannel Opus stream into the packets of its Opus streams,
+// of which there are streamCount, the first coupledCount of them coupled, as given by the stream's OpusHead.
+// Each stream's packet but the last uses the self-delimiting framing of RFC 6716 appendix B,
+// which codes one more frame length, so that the next packet's start can be found;
+// the packets are returned in the usual, undelimited framing, like that of a single-stream packet,
+// so SplitOpusFrames and the other functions of single packets apply to them.
+// The last packet aliases pkt, and the others are copies, without their extra lengths.
+// The error is ErrOpusStreamCount if the counts are invalid, or one of the errors describing
+// malformed Opus packets for a stream's packet, including ErrOpusFrameLength
+// if pkt holds fewer packets than there are streams.
+func ParseOpusMultistream(pkt []byte, streamCount, coupledCount int) ([][]byte, error) {
+	if streamCount < 1 || streamCount > 255 || coupledCount < 0 || coupledCount > streamCount {
+		return nil, ErrOpusStreamCount
+	}
+	packets := make([][]byte, streamCount)
+	for i := 0; i < streamCount-1; i++ {
+		p, n, err := opusSelfDelimited(pkt)
+		if err != nil {
+			return nil, err
+		}
+		packets[i] = p
+		pkt = pkt[n:]
+	}
+	if len(pkt) == 0 {
+		return nil, ErrOpusEmpty
+	}
+	packets[streamCount-1] = pkt
+	return packets, nil
+}
+
+// opusSelfDelimited reads a packet in the self-delimiting framing from the start of b,
+// returning it in the undelimited framing, and the number of bytes it took in b.
+func opusSelfDelimited(b []byte) (pkt []byte, n int, err error) {
+	if len(b) == 0 {
+		return nil, 0, ErrOpusFrameLength
+	}
+
+	// at is the offset of the extra frame length, which is that of count frames,
+	// and other the size of the other frames and the padding
+	at, count := 1, 1
+	var other int
+	switch b[0] & 0x03 {
+	case 1:
+		count = 2
+	case 2:
+		first, used, err := opusFrameLen(b[1:])
+		if err != nil {
+			return nil, 0, err
+		}
+		at += used
+		other = first
+	case 3:
+		if len(b) < 2 {
+			return nil, 0, ErrOpusFrameCount
+		}
+		count = int(b[1] & 0x3f)
+		if count < 1 {
+			return nil, 0, ErrOpusFrameCount
+		}
+		vbr, padded := b[1]&0x80 != 0, b[1]&0x40 != 0
+		at = 2
+		for padded {
+			if at >= len(b) {
+				return nil, 0, ErrOpusPadding
+			}
+			if b[at] == 255 {
+				other += 254
+			} else {
+				other += int(b[at])
+				padded = false
+			}
+			at++
+		}
+		if vbr {
+			for i := 0; i < count-1; i++ {
+				l, used, err := opusFrameLen(b[at:])
+				if err != nil {
+					return nil, 0, err
+				}
+				other += l
+				at += used
+			}
+			count = 1
+		}
+	}
+
+	l, used, err := opusFrameLen(b[at:])
+	if err != nil {
+		return nil, 0, err
+	}
+	if l > maxOpusFrame {
+		return nil, 0, ErrOpusFrameTooLarge
+	}
+	n = at + used + count*l + other
+	if n > len(b) {
+		return nil, 0, ErrOpusFrameLength
+	}
+	pkt = append(make([]byte, 0, n-used), b[:at]...)
+	return append(pkt, b[at+used:n]...), n, nil
+}
+
+// ValidateOpusPacket checks that pkt is a well-formed Opus packet,
+// meeting the requirements of RFC 6716 section 3.4:
+// its frames are each at most 1275 bytes, their lengths and padding are consistent with its size,
+// and it holds 1 to 48 frames, lasting at most 120 ms.
+// It returns the error describing the first violation found.
+func ValidateOpusPacket(pkt []byte) error {
+	frames, err := SplitOpusFrames(pkt)
+	if err != nil {
+		return err
+	}
+	if len(frames) > 48 {
+		return ErrOpusFrameCount
+	}
+	if opusFrameSizes[opusConfig(pkt[0])]*len(frames) > 5760 {
+		return ErrOpusDuration
+	}
+	return nil
+}
+
+// Errors returned by CombineOpusFrames.
+var (
+	ErrOpusConfigMismatch = errors.New("opus packets have different TOC configurations")
+	ErrOpusTooManyFrames  = errors.New("opus packet would exceed 48 frames")
+	ErrOpusTooLong        = errors.New("opus packet would exceed 120 ms")
+)
+
+// CombineOpusFrames repacketizes Opus packets into one, the inverse of SplitOpusFrames,
+// to save the overhead of many small packets.
+// The packets, usually each of a single frame, must share their TOC config and stereo flag,
+// and together hold at most 48 frames and 120 ms, as RFC 6716 requires.
+// The frames are packed with code 0 or 1 when they allow it, and otherwise with code 2 or 3,
+// CBR if all frames are the same size and VBR if not.
+func CombineOpusFrames(packets [][]byte) ([]byte, error) {
+	if len(packets) == 0 {
+		return nil, errors.New("no opus packets")
+	}
+
+	var frames [][]byte
+	toc := byte(0)
+	for i, pkt := range packets {
+		f, err := SplitOpusFrames(pkt)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			toc = pkt[0] &^ 0x03
+		} else if pkt[0]&^0x03 != toc {
+			return nil, ErrOpusConfigMismatch
+		}
+		frames = append(frames, f...)
+	}
+
+	if len(frames) > 48 {
+		return nil, ErrOpusTooManyFrames
+	}
+	if opusFrameSizes[opusConfig(toc)]*len(frames) > 5760 {
+		return nil, ErrOpusTooLong
+	}
+
+	cbr := true
+	size := 0
+	for _, f := range frames {
+		cbr = cbr && len(f) == len(frames[0])
+		size += len(f) + 2
+	}
+	out := make([]byte, 0, 2+size)
+
+	switch {
+	case len(frames) == 1:
+		out = append(out, toc)
+	case len(frames) == 2 && cbr:
+		out = append(out, toc|1)
+	case len(frames) == 2:
+		out = append(out, toc|2)
+		out = appendOpusFrameLen(out, len(frames[0]))
+	case cbr:
+		out = append(out, toc|3, byte(len(frames)))
+	default:
+		out = append(out, toc|3, 0x80|byte(len(frames)))
+		for _, f := range frames[:len(frames)-1] {
+			out = appendOpusFrameLen(out, len(f))
+		}
+	}
+	for _, f := range frames {
+		out = append(out, f...)
+	}
+	return out, nil
+}
+
+// appendOpusFrameLen appends a frame length, coded in one or two bytes, to b.
+func appendOpusFrameLen(b []byte, n int) []byte {
+	if n < 252 {
+		return append(b, byte(n))
+	}
+	first := 252 + n&0x03
+	return append(b, byte(first), byte((n-first)/4))
+}
@@ -0,0 +1,303 @@
+package ogg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitOpusFrames(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		want   [][]byte
+	}{
+		{
+			name:   "code 0",
+			packet: []byte{0x08, 'a', 'b', 'c'},
+			want:   [][]byte{[]byte("abc")},
+		},
+		{
+			name:   "code 1, equal halves",
+			packet: []byte{0x09, 'a', 'b', 'c', 'd'},
+			want:   [][]byte{[]byte("ab"), []byte("cd")},
+		},
+		{
+			name:   "code 2, explicit first length",
+			packet: []byte{0x0a, 1, 'a', 'b', 'c', 'd'},
+			want:   [][]byte{[]byte("a"), []byte("bcd")},
+		},
+		{
+			name:   "code 2, empty first frame",
+			packet: []byte{0x0a, 0, 'a', 'b'},
+			want:   [][]byte{[]byte(""), []byte("ab")},
+		},
+		{
+			name:   "code 3 CBR",
+			packet: []byte{0x0b, 0x03, 'a', 'b', 'c', 'd', 'e', 'f'},
+			want:   [][]byte{[]byte("ab"), []byte("cd"), []byte("ef")},
+		},
+		{
+			name:   "code 3 VBR with padding",
+			packet: []byte{0x0b, 0xc3, 2, 1, 2, 'a', 'b', 'c', 'd', 'e', 'f', 0, 0},
+			want:   [][]byte{[]byte("a"), []byte("bc"), []byte("def")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames, err := SplitOpusFrames(tt.packet)
+			if err != nil {
+				t.Fatal("unexpected SplitOpusFrames error:", err)
+			}
+			if len(frames) != len(tt.want) {
+				t.Fatalf("got %d frames, want %d", len(frames), len(tt.want))
+			}
+			for i := range frames {
+				if !bytes.Equal(frames[i], tt.want[i]) {
+					t.Fatalf("frame %d = %q, want %q", i, frames[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSplitOpusFramesLongLength(t *testing.T) {
+	// A code 2 first frame of 300 bytes takes two length bytes: 252 + 4*12.
+	pkt := append([]byte{0x0a, 252, 12}, bytes.Repeat([]byte("a"), 300)...)
+	pkt = append(pkt, "bb"...)
+
+	frames, err := SplitOpusFrames(pkt)
+	if err != nil {
+		t.Fatal("unexpected SplitOpusFrames error:", err)
+	}
+	if len(frames) != 2 || len(frames[0]) != 300 || !bytes.Equal(frames[1], []byte("bb")) {
+		t.Fatalf("unexpected frame layout: %d frames", len(frames))
+	}
+}
+
+func TestSplitOpusFramesInvalid(t *testing.T) {
+	packets := map[string][]byte{
+		"empty":              {},
+		"code 1 odd size":    {0x09, 'a', 'b', 'c'},
+		"code 2 overlong":    {0x0a, 5, 'a'},
+		"code 3 no count":    {0x0b},
+		"code 3 zero frames": {0x0b, 0x00},
+		"code 3 CBR uneven":  {0x0b, 0x02, 'a', 'b', 'c'},
+	}
+
+	for name, pkt := range packets {
+		if _, err := SplitOpusFrames(pkt); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestOpusIsStereo(t *testing.T) {
+	stereo, err := OpusIsStereo([]byte{0xfc})
+	if err != nil || !stereo {
+		t.Fatalf("expected stereo, got %v, %v", stereo, err)
+	}
+	stereo, err = OpusIsStereo([]byte{0xf8})
+	if err != nil || stereo {
+		t.Fatalf("expected mono, got %v, %v", stereo, err)
+	}
+	_, err = OpusIsStereo(nil)
+	if err == nil {
+		t.Fatal("expected an error for an empty packet")
+	}
+}
+
+func TestCombineOpusFrames(t *testing.T) {
+	frame := func(n int, b byte) []byte {
+		return append([]byte{0x08}, bytes.Repeat([]byte{b}, n)...)
+	}
+	tests := []struct {
+		packets [][]byte
+		code    byte
+	}{
+		{[][]byte{frame(10, 1)}, 0},
+		{[][]byte{frame(10, 1), frame(10, 2)}, 1},
+		{[][]byte{frame(10, 1), frame(300, 2)}, 2},
+		{[][]byte{frame(10, 1), frame(10, 2), frame(10, 3)}, 3},
+		{[][]byte{frame(700, 1), frame(10, 2), frame(1275, 3)}, 3},
+	}
+	for i, test := range tests {
+		pkt, err := CombineOpusFrames(test.packets)
+		if err != nil {
+			t.Fatalf("%d: unexpected CombineOpusFrames error: %v", i, err)
+		}
+		if pkt[0] != 0x08|test.code {
+			t.Fatalf("%d: expected code %d, got TOC %x", i, test.code, pkt[0])
+		}
+		frames, err := SplitOpusFrames(pkt)
+		if err != nil {
+			t.Fatalf("%d: unexpected SplitOpusFrames error: %v", i, err)
+		}
+		if len(frames) != len(test.packets) {
+			t.Fatalf("%d: expected %d frames, got %d", i, len(test.packets), len(frames))
+		}
+		for j, f := range frames {
+			if !bytes.Equal(f, test.packets[j][1:]) {
+				t.Fatalf("%d: frame %d did not round-trip", i, j)
+			}
+		}
+	}
+
+	if _, err := CombineOpusFrames([][]byte{frame(1, 1), {0x0c, 1}}); err != ErrOpusConfigMismatch {
+		t.Fatal("expected ErrOpusConfigMismatch, got", err)
+	}
+	// 60 ms frames: two make 120 ms, three too many
+	long := []byte{0x18, 1}
+	if _, err := CombineOpusFrames([][]byte{long, long}); err != nil {
+		t.Fatal("unexpected CombineOpusFrames error:", err)
+	}
+	if _, err := CombineOpusFrames([][]byte{long, long, long}); err != ErrOpusTooLong {
+		t.Fatal("expected ErrOpusTooLong, got", err)
+	}
+	var many [][]byte
+	for i := 0; i < 49; i++ {
+		many = append(many, []byte{0x80, 1})
+	}
+	if _, err := CombineOpusFrames(many); err != ErrOpusTooManyFrames {
+		t.Fatal("expected ErrOpusTooManyFrames, got", err)
+	}
+}
+
+func TestValidateOpusPacket(t *testing.T) {
+	cbr := func(toc, count byte) []byte {
+		return append([]byte{toc, count}, bytes.Repeat([]byte{'a'}, int(count))...)
+	}
+
+	tests := []struct {
+		name string
+		pkt  []byte
+		err  error
+	}{
+		{"code 0", []byte{0x00, 'a'}, nil},
+		{"code 3 48 frames", cbr(0x83, 48), nil},
+		{"code 3 VBR padded", []byte{0x03, 0xc2, 1, 1, 'a', 'b', 0}, nil},
+		{"empty", []byte{}, ErrOpusEmpty},
+		{"code 0 oversized", append([]byte{0x00}, make([]byte, 1276)...), ErrOpusFrameTooLarge},
+		{"code 1 odd size", []byte{0x09, 'a', 'b', 'c'}, ErrOpusUnequalFrames},
+		{"code 2 overlong", []byte{0x0a, 5, 'a'}, ErrOpusFrameLength},
+		{"code 2 missing length", []byte{0x0a}, ErrOpusFrameLength},
+		{"code 3 no count", []byte{0x0b}, ErrOpusFrameCount},
+		{"code 3 zero frames", []byte{0x0b, 0x00}, ErrOpusFrameCount},
+		{"code 3 49 frames", cbr(0x83, 49), ErrOpusFrameCount},
+		{"code 3 180 ms", cbr(0x1b, 3), ErrOpusDuration},
+		{"code 3 CBR uneven", []byte{0x0b, 0x02, 'a', 'b', 'c'}, ErrOpusCBRSize},
+		{"code 3 VBR overlong", []byte{0x0b, 0x82, 5, 'a'}, ErrOpusFrameLength},
+		{"code 3 padding overlong", []byte{0x0b, 0x41, 10, 'a'}, ErrOpusPadding},
+		{"code 3 padding missing", []byte{0x0b, 0x41}, ErrOpusPadding},
+	}
+	for _, test := range tests {
+		if err := ValidateOpusPacket(test.pkt); err != test.err {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestOpusPacketSamples(t *testing.T) {
+	tests := []struct {
+		name    string
+		pkt     []byte
+		samples int
+	}{
+		{"CELT 2.5 ms", []byte{16 << 3}, 120},
+		{"CELT 5 ms", []byte{17 << 3}, 240},
+		{"hybrid 10 ms", []byte{12 << 3}, 480},
+		{"CELT 20 ms", []byte{31 << 3}, 960},
+		{"SILK 40 ms", []byte{2 << 3}, 1920},
+		{"SILK 60 ms", []byte{3 << 3}, 2880},
+		{"code 1 20 ms", []byte{19<<3 | 1, 'a', 'b'}, 1920},
+		{"code 2 60 ms", []byte{11<<3 | 2, 1, 'a', 'b'}, 5760},
+		{"code 3 2.5 ms x 48", []byte{28<<3 | 3, 48}, 5760},
+		{"code 3 stereo 10 ms x 3", []byte{18<<3 | 4 | 3, 0x83}, 1440},
+	}
+	for _, test := range tests {
+		n, err := OpusPacketSamples(test.pkt)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if n != test.samples {
+			t.Fatalf("%s: expected %d samples, got %d", test.name, test.samples, n)
+		}
+	}
+
+	for _, pkt := range [][]byte{{}, {0x03}, {0x03, 0x00}} {
+		if _, err := OpusPacketSamples(pkt); err == nil {
+			t.Fatalf("expected an error for %x", pkt)
+		}
+	}
+}
+
+func TestOpusAdvanceGranule(t *testing.T) {
+	tests := []struct {
+		name    string
+		start   int64
+		packets [][]byte
+		want    int64
+		err     error
+	}{
+		{"none", 312, nil, 312, nil},
+		{"code 0 20 ms", 0, [][]byte{{31 << 3, 'a'}, {31 << 3, 'b'}}, 1920, nil},
+		{"code 1 and code 2", 312, [][]byte{{19<<3 | 1, 'a', 'b'}, {3<<3 | 2, 1, 'a', 'b'}}, 312 + 1920 + 5760, nil},
+		{"code 3 CBR", 48000, [][]byte{{16<<3 | 3, 4, 'a', 'b', 'c', 'd'}}, 48000 + 480, nil},
+		{"code 3 VBR", 0, [][]byte{{18<<3 | 3, 0x83, 1, 1, 'a', 'b', 'c'}}, 1440, nil},
+		{"malformed", 312, [][]byte{{31 << 3, 'a'}, {0x0b, 0x02, 'a', 'b', 'c'}}, 312, ErrOpusCBRSize},
+		{"empty", 0, [][]byte{{}}, 0, ErrOpusEmpty},
+	}
+	for _, test := range tests {
+		granule, err := OpusAdvanceGranule(test.start, test.packets)
+		if granule != test.want || err != test.err {
+			t.Fatalf("%s: expected %d, %v, got %d, %v", test.name, test.want, test.err, granule, err)
+		}
+	}
+}
+
+func TestParseOpusMultistream(t *testing.T) {
+	// Two streams: a self-delimited code 0 packet of a 3-byte frame, then a code 1 packet.
+	pkt := []byte{0x08, 3, 'a', 'b', 'c', 0x09, 'x', 'y'}
+	packets, err := ParseOpusMultistream(pkt, 2, 1)
+	if err != nil {
+		t.Fatal("unexpected ParseOpusMultistream error:", err)
+	}
+	if len(packets) != 2 || !bytes.Equal(packets[0], []byte{0x08, 'a', 'b', 'c'}) || !bytes.Equal(packets[1], []byte{0x09, 'x', 'y'}) {
+		t.Fatalf("unexpected packets %q", packets)
+	}
+
+	// Each framing code, self-delimited, followed by a last stream of one frame.
+	for _, test := range []struct {
+		delimited, want []byte
+	}{
+		// code 1: the extra length is that of each frame
+		{[]byte{0x09, 2, 'a', 'b', 'c', 'd'}, []byte{0x09, 'a', 'b', 'c', 'd'}},
+		// code 2: the first frame's length, then the extra length of the second
+		{[]byte{0x0a, 1, 2, 'a', 'b', 'c'}, []byte{0x0a, 1, 'a', 'b', 'c'}},
+		// code 3 CBR, with a byte of padding
+		{[]byte{0x0b, 0x43, 1, 1, 'a', 'b', 'c', 0}, []byte{0x0b, 0x43, 1, 'a', 'b', 'c', 0}},
+		// code 3 VBR: two lengths, then the extra length of the third frame
+		{[]byte{0x0b, 0x83, 1, 2, 1, 'a', 'b', 'b', 'c'}, []byte{0x0b, 0x83, 1, 2, 'a', 'b', 'b', 'c'}},
+	} {
+		packets, err := ParseOpusMultistream(append(append([]byte(nil), test.delimited...), 0x08, 'z'), 2, 0)
+		if err != nil {
+			t.Fatalf("%x: unexpected ParseOpusMultistream error: %v", test.delimited, err)
+		}
+		if !bytes.Equal(packets[0], test.want) || !bytes.Equal(packets[1], []byte{0x08, 'z'}) {
+			t.Fatalf("%x: expected %x, got %x", test.delimited, test.want, packets)
+		}
+		if _, err := SplitOpusFrames(packets[0]); err != nil {
+			t.Fatalf("%x: unexpected SplitOpusFrames error: %v", test.delimited, err)
+		}
+	}
+
+	if _, err := ParseOpusMultistream(pkt, 3, 1); err != ErrOpusFrameLength {
+		t.Fatal("expected ErrOpusFrameLength for a missing stream, got", err)
+	}
+	if _, err := ParseOpusMultistream(pkt[:4], 2, 1); err != ErrOpusFrameLength {
+		t.Fatal("expected ErrOpusFrameLength for a short frame, got", err)
+	}
+	if _, err := ParseOpusMultistream(pkt, 2, 3); err != ErrOpusStreamCount {
+		t.Fatal("expected ErrOpusStreamCount, got", err)
+	}
+}
@@ -0,0 +1,372 @@
+package ogg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// OpusHead is the identification header of an Ogg Opus stream, as defined in RFC 7845 section 5.1.
+type OpusHead struct {
+	Version byte
+	// Channels is the number of output channels.
+	Channels byte
+	// PreSkip is the number of 48 kHz samples to discard from the start of the decoded output.
+	PreSkip uint16
+	// InputSampleRate is the sample rate of the original input, for information only.
+	InputSampleRate uint32
+	// OutputGain is the gain to apply to the decoded output, in Q7.8 dB;
+	// see OutputGainDB and GainFactor.
+	OutputGain    int16
+	MappingFamily byte
+	// StreamCount and CoupledCount are the number of Opus streams in each packet,
+	// and how many of those are stereo. For mapping family 0, they are implied
+	// by the channel count.
+	StreamCount  byte
+	CoupledCount byte
+	// ChannelMapping maps each output channel to a decoded channel.
+	// It is nil for mapping family 0.
+	ChannelMapping []byte
+}
+
+var (
+	opusHeadMagic = []byte("OpusHead")
+	opusTagsMagic = []byte("OpusTags")
+)
+
+// ErrBadOpusHead is the error used when an OpusHead packet is malformed.
+var ErrBadOpusHead = errors.New("malformed OpusHead")
+
+// ErrBadOpusTags is the error used when a packet doesn't start with the OpusTags magic.
+var ErrBadOpusTags = errors.New("malformed OpusTags")
+
+// ParseOpusHead parses the identification header packet of an Ogg Opus stream.
+func ParseOpusHead(pkt []byte) (OpusHead, error) {
+	if len(pkt) < 19 || !bytes.HasPrefix(pkt, opusHeadMagic) {
+		return OpusHead{}, ErrBadOpusHead
+	}
+
+	h := OpusHead{
+		Version:         pkt[8],
+		Channels:        pkt[9],
+		PreSkip:         byteOrder.Uint16(pkt[10:]),
+		InputSampleRate: byteOrder.Uint32(pkt[12:]),
+		OutputGain:      int16(byteOrder.Uint16(pkt[16:])),
+		MappingFamily:   pkt[18],
+	}
+
+	// Only the major version, in the upper 4 bits, breaks compatibility.
+	if h.Version>>4 != 0 || h.Channels == 0 {
+		return OpusHead{}, ErrBadOpusHead
+	}
+
+	if h.MappingFamily == 0 {
+		if h.Channels > 2 {
+			return OpusHead{}, ErrBadOpusHead
+		}
+		h.StreamCount = 1
+		h.CoupledCount = h.Channels - 1
+		return h, nil
+	}
+
+	if len(pkt) < 21+int(h.Channels) {
+		return OpusHead{}, ErrBadOpusHead
+	}
+	h.StreamCount = pkt[19]
+	h.CoupledCount = pkt[20]
+	if h.StreamCount == 0 || h.CoupledCount > h.StreamCount {
+		return OpusHead{}, ErrBadOpusHead
+	}
+	h.ChannelMapping = append([]byte(nil), pkt[21:21+int(h.Channels)]...)
+	return h, nil
+}
+
+// OutputGainDB returns h's OutputGain in dB, converted from its Q7.8 fixed point.
+func (h OpusHead) OutputGainDB() float64 {
+	return float64(h.OutputGain) / 256
+}
+
+// GainFactor returns the linear factor by which players must scale the decoded output
+// to apply h's OutputGain: 10^(g/20) for a gain of g dB.
+func (h OpusHead) GainFactor() float64 {
+	return math.Pow(10, h.OutputGainDB()/20)
+}
+
+// appendOpusHead appends the identification header packet for h to b, the inverse of ParseOpusHead.
+// For mapping family 0, the stream counts and channel mapping are implied, so they aren't written.
+func appendOpusHead(b []byte, h OpusHead) []byte {
+	b = append(b, opusHeadMagic...)
+	b = append(b, h.Version, h.Channels)
+	b = byteOrder.AppendUint16(b, h.PreSkip)
+	b = byteOrder.AppendUint32(b, h.InputSampleRate)
+	b = byteOrder.AppendUint16(b, uint16(h.OutputGain))
+	b = append(b, h.MappingFamily)
+	if h.MappingFamily != 0 {
+		b = append(b, h.StreamCount, h.CoupledCount)
+		b = append(b, h.ChannelMapping...)
+	}
+	return b
+}
+
+// ParseOpusTags parses the comment header packet of an Ogg Opus stream.
+func ParseOpusTags(pkt []byte) (vendor string, tags map[string][]string, err error) {
+	if !bytes.HasPrefix(pkt, opusTagsMagic) {
+		return "", nil, ErrBadOpusTags
+	}
+	return ParseComments(pkt[len(opusTagsMagic):])
+}
+
+// ErrNoOpusStream is the error used when an ogg stream has no Opus logical stream.
+var ErrNoOpusStream = errors.New("no opus stream found")
+
+// An OpusReader reads the audio packets of an Ogg Opus stream,
+// taking care of its headers, pages, and timestamps.
+// If the ogg stream is multiplexed, only its first Opus logical stream is read.
+type OpusReader struct {
+	Head   OpusHead
+	Vendor string
+	Tags   map[string][]string
+
+	g *GenericReader
+	// the header packets as read
+	headPacket, tagsPacket []byte
+	// 48 kHz samples in the packets read so far,
+	// and the last granule position seen
+	samples int64
+	granule int64
+}
+
+// NewOpusReader creates an OpusReader, reading the OpusHead and OpusTags headers from r.
+func NewOpusReader(r io.Reader) (*OpusReader, error) {
+	g, pkt, err := openStream(r, func(bos []byte) bool { return IdentifyCodec(bos) == CodecOpus })
+	if err == errNoMatch {
+		return nil, ErrNoOpusStream
+	}
+	if err != nil {
+		return nil, err
+	}
+	o := &OpusReader{g: g}
+	o.Head, err = ParseOpusHead(pkt.Data)
+	if err != nil {
+		return nil, err
+	}
+	o.headPacket = append([]byte(nil), pkt.Data...)
+
+	pkt, err = g.next()
+	if err == io.EOF {
+		return nil, ErrBadOpusTags
+	}
+	if err != nil {
+		return nil, err
+	}
+	o.Vendor, o.Tags, err = ParseOpusTags(pkt.Data)
+	if err != nil {
+		return nil, err
+	}
+	o.tagsPacket = append([]byte(nil), pkt.Data...)
+
+	return o, nil
+}
+
+// ReadOpusTags reads the OpusTags header of the first Opus logical stream in r,
+// reassembling it across however many pages it spans, as with large embedded pictures,
+// and reads no further, so it's the cheap way to get a file's metadata.
+// The errors are those of NewOpusReader.
+func ReadOpusTags(r io.Reader) (vendor string, tags map[string][]string, err error) {
+	o, err := NewOpusReader(r)
+	if err != nil {
+		return "", nil, err
+	}
+	return o.Vendor, o.Tags, nil
+}
+
+// ReadPacket returns the next audio packet and the presentation time of its first sample.
+// Timestamps account for the stream's pre-skip, so the packets preceding
+// the start of playback have negative timestamps.
+// The error is io.EOF after the end of the logical stream.
+func (o *OpusReader) ReadPacket() (data []byte, timestamp time.Duration, err error) {
+	pkt, err := o.g.next()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	n, err := opusSamples(pkt.Data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if pkt.Granule != -1 {
+		o.granule = pkt.Granule
+	}
+
+	timestamp = samplesToDuration(o.samples - int64(o.Head.PreSkip))
+	o.samples += int64(n)
+	return pkt.Data, timestamp, nil
+}
+
+// EndTrim returns the number of 48 kHz samples to discard from the end of
+// the decoded output: the amount by which the samples in all the stream's
+// packets exceed the final granule position, as described in RFC 7845 section 4.5.
+// Together with the pre-skip, it allows gapless playback.
+// It is only known once ReadPacket has returned the stream's last packet; until then it is 0.
+func (o *OpusReader) EndTrim() int {
+	if !o.g.done || o.samples <= o.granule {
+		return 0
+	}
+	return int(o.samples - o.granule)
+}
+
+// GaplessInfo returns the pre-skip and end trim of the first Opus logical stream in rs,
+// the numbers of 48 kHz samples a player discards from the start and end of the decoded output
+// for gapless playback, as with OpusReader.EndTrim.
+// The end trim is the amount by which the samples of all the stream's packets exceed
+// its final granule position, found with LastGranule, so it's known even for a stream
+// cut short without its EOS page.
+// Every packet is read to count its samples; rs is returned to its original position afterwards.
+// The error is ErrNoOpusStream if rs has no Opus stream.
+func GaplessInfo(rs io.ReadSeeker) (preSkip, endTrim int, err error) {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		if _, serr := rs.Seek(start, io.SeekStart); err == nil {
+			err = serr
+		}
+	}()
+
+	o, err := NewOpusReader(rs)
+	if err != nil {
+		return 0, 0, err
+	}
+	for {
+		_, _, err := o.ReadPacket()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	granule, err := LastGranule(rs, o.g.Serial)
+	if err != nil {
+		return 0, 0, err
+	}
+	if o.samples > granule {
+		endTrim = int(o.samples - granule)
+	}
+	return int(o.Head.PreSkip), endTrim, nil
+}
+
+// ErrGranuleMismatch is the error used by VerifyOpusGranules when a granule position
+// disagrees with the durations of the packets preceding it.
+type ErrGranuleMismatch struct {
+	// Packet is the index of the audio packet carrying the granule position.
+	Packet int
+	// Granule is the granule position found.
+	Granule int64
+	// Samples is the number of 48 kHz samples in the packets up to and including Packet.
+	Samples int64
+	// Final is set if the granule position is the stream's last.
+	Final bool
+}
+
+func (e ErrGranuleMismatch) Error() string {
+	s := "granule position " + strconv.FormatInt(e.Granule, 10) + " after audio packet " + strconv.Itoa(e.Packet)
+	if e.Final {
+		return "final " + s + " is not within the last page of the " + strconv.FormatInt(e.Samples, 10) + " samples preceding it"
+	}
+	return s + " does not match the " + strconv.FormatInt(e.Samples, 10) + " samples preceding it"
+}
+
+// VerifyOpusGranules decodes the Opus stream in r, checking that each granule position
+// equals the total duration, in 48 kHz samples, of the audio packets up to it.
+// The final granule position may be less, to trim samples from the end of the last page,
+// but not less than the stream's pre-skip.
+// A mismatch is reported as an ErrGranuleMismatch.
+// This catches muxer bugs that produce files players reject or seek in wrongly.
+// The stream is assumed to start at granule position 0, as encoders conventionally do.
+func VerifyOpusGranules(r io.Reader) error {
+	o, err := NewOpusReader(r)
+	if err != nil {
+		return err
+	}
+
+	// samples counts the samples up to the last packet,
+	// and page those since the last granule position
+	var samples, page int64
+	for i := 0; ; i++ {
+		pkt, err := o.g.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		n, err := opusSamples(pkt.Data)
+		if err != nil {
+			return err
+		}
+		samples += int64(n)
+		page += int64(n)
+		if pkt.Granule == -1 {
+			continue
+		}
+
+		granule := pkt.Granule
+		if pkt.EOS {
+			if granule > samples || granule < samples-page || granule < int64(o.Head.PreSkip) {
+				return ErrGranuleMismatch{i, granule, samples, true}
+			}
+			return nil
+		}
+		if granule != samples {
+			return ErrGranuleMismatch{i, granule, samples, false}
+		}
+		page = 0
+	}
+	return nil
+}
+
+// samplesToDuration converts a count of 48 kHz samples to a time.Duration.
+func samplesToDuration(n int64) time.Duration {
+	return time.Duration(n) * time.Second / 48000
+}
+
+// Errors returned by DecodeOpusPacket when a page doesn't hold exactly one whole packet.
+var (
+	ErrMultiplePackets = errors.New("page holds more than one packet")
+	ErrContinuedPacket = errors.New("packet is continued across pages")
+)
+
+// DecodeOpusPacket decodes the next page, assuming it holds exactly one whole packet,
+// as the pages of simple Opus streams do, and returns the packet and the page's granule position.
+// This suits code that depends on that layout, by failing early on streams that don't follow it:
+// the error is ErrMultiplePackets for a page of several packets,
+// or ErrContinuedPacket for a page continuing a packet, or leaving one unfinished,
+// and after either, DecodeOpusPacket may be called again to continue with the next page.
+// Otherwise the error is Decode's.
+//
+// The header packets, OpusHead and OpusTags, are returned like any other,
+// as are the packets of every logical stream of a multiplexed stream, so it suits single-stream files.
+// As with Decode, the packet is in d's buffer unless d.CopyPackets is set.
+func (d *Decoder) DecodeOpusPacket() (pkt []byte, granule int64, err error) {
+	p, _, err := d.DecodeLazy()
+	if err != nil {
+		return nil, 0, err
+	}
+	if p.Type&COP != 0 || p.Unfinished {
+		return nil, p.Granule, ErrContinuedPacket
+	}
+	if p.NumPackets() > 1 {
+		return nil, p.Granule, ErrMultiplePackets
+	}
+	return p.Packet(0), p.Granule, nil
+}
@@ -0,0 +1,379 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func opusHeadPacket(channels byte, preSkip uint16) []byte {
+	h := append([]byte(nil), opusHeadMagic...)
+	h = append(h, 1, channels, 0, 0, 0x80, 0xbb, 0, 0, 0, 0, 0)
+	byteOrder.PutUint16(h[10:], preSkip)
+	return h
+}
+
+func opusTagsPacket(vendor string, comments ...string) []byte {
+	return append(append([]byte(nil), opusTagsMagic...), commentHeader(vendor, comments...)...)
+}
+
+func TestParseOpusHead(t *testing.T) {
+	h, err := ParseOpusHead(opusHeadPacket(2, 312))
+	if err != nil {
+		t.Fatal("unexpected ParseOpusHead error:", err)
+	}
+	if h.Channels != 2 || h.PreSkip != 312 || h.InputSampleRate != 48000 {
+		t.Fatalf("unexpected header: %+v", h)
+	}
+	if h.StreamCount != 1 || h.CoupledCount != 1 || h.ChannelMapping != nil {
+		t.Fatalf("unexpected implied mapping: %+v", h)
+	}
+
+	surround := opusHeadPacket(3, 0)
+	surround[18] = 1
+	surround = append(surround, 2, 1, 0, 2, 1)
+	h, err = ParseOpusHead(surround)
+	if err != nil {
+		t.Fatal("unexpected ParseOpusHead error:", err)
+	}
+	if h.StreamCount != 2 || h.CoupledCount != 1 || !bytes.Equal(h.ChannelMapping, []byte{0, 2, 1}) {
+		t.Fatalf("unexpected mapping: %+v", h)
+	}
+
+	_, err = ParseOpusHead(surround[:22])
+	if err != ErrBadOpusHead {
+		t.Fatal("expected ErrBadOpusHead, got:", err)
+	}
+	_, err = ParseOpusHead([]byte("OpusTags"))
+	if err != ErrBadOpusHead {
+		t.Fatal("expected ErrBadOpusHead, got:", err)
+	}
+}
+
+func TestOpusHeadGain(t *testing.T) {
+	pkt := opusHeadPacket(2, 0)
+	// -6 dB and a half, in Q7.8
+	byteOrder.PutUint16(pkt[16:], uint16(0xf980))
+	h, err := ParseOpusHead(pkt)
+	if err != nil {
+		t.Fatal("unexpected ParseOpusHead error:", err)
+	}
+	if h.OutputGain != -1664 || h.OutputGainDB() != -6.5 {
+		t.Fatalf("expected a gain of -6.5 dB, got %d, %v", h.OutputGain, h.OutputGainDB())
+	}
+	// 10^(-6.5/20)
+	if f := h.GainFactor(); f < 0.473151 || f > 0.473152 {
+		t.Fatal("expected a factor of 0.4731513, got", f)
+	}
+
+	if f := (OpusHead{}).GainFactor(); f != 1 {
+		t.Fatal("expected a factor of 1 for no gain, got", f)
+	}
+}
+
+// opusFile encodes an Ogg Opus stream with the given audio packets,
+// each on its own page.
+func opusFile(t *testing.T, preSkip uint16, tags []byte, packets ...[]byte) []byte {
+	var b bytes.Buffer
+	e := NewEncoder(7, &b)
+
+	if err := e.EncodeBOS(0, [][]byte{opusHeadPacket(2, preSkip)}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.Encode(0, [][]byte{tags}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+
+	var granule int64
+	for i, p := range packets {
+		n, err := opusSamples(p)
+		if err != nil {
+			t.Fatal("unexpected opusSamples error:", err)
+		}
+		granule += int64(n)
+		if i == len(packets)-1 {
+			err = e.EncodeEOS(granule, [][]byte{p})
+		} else {
+			err = e.Encode(granule, [][]byte{p})
+		}
+		if err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+	}
+	return b.Bytes()
+}
+
+func TestOpusReader(t *testing.T) {
+	// A big tags packet spans pages.
+	art := "METADATA_BLOCK_PICTURE=" + string(bytes.Repeat([]byte("A"), maxPageSize))
+	tags := opusTagsPacket("enc", "TITLE=t", art)
+
+	packets := [][]byte{
+		{0xf8, 1},    // 20 ms
+		{0xf9, 2, 2}, // 2x20 ms
+		{0xf8, 3},    // 20 ms
+	}
+	r, err := NewOpusReader(bytes.NewReader(opusFile(t, 480, tags, packets...)))
+	if err != nil {
+		t.Fatal("unexpected NewOpusReader error:", err)
+	}
+
+	if r.Head.PreSkip != 480 || r.Vendor != "enc" || r.Tags["TITLE"][0] != "t" {
+		t.Fatalf("unexpected headers: %+v %q %q", r.Head, r.Vendor, r.Tags["TITLE"])
+	}
+
+	expect := []time.Duration{-10 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond}
+	for i, ts := range expect {
+		data, got, err := r.ReadPacket()
+		if err != nil {
+			t.Fatal("unexpected ReadPacket error:", err)
+		}
+		if !bytes.Equal(data, packets[i]) {
+			t.Fatalf("packet %d = %x, expected %x", i, data, packets[i])
+		}
+		if got != ts {
+			t.Fatalf("packet %d timestamp = %v, expected %v", i, got, ts)
+		}
+	}
+
+	_, _, err = r.ReadPacket()
+	if err != io.EOF {
+		t.Fatal("expected EOF, got:", err)
+	}
+}
+
+func TestOpusReaderNotOpus(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("\x01vorbis")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.Encode(0, [][]byte{[]byte("data")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+
+	_, err := NewOpusReader(&b)
+	if err != ErrNoOpusStream {
+		t.Fatal("expected ErrNoOpusStream, got:", err)
+	}
+}
+
+func TestOpusReaderEndTrim(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(7, &b)
+	if err := e.EncodeBOS(0, [][]byte{opusHeadPacket(2, 312)}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.Encode(0, [][]byte{opusTagsPacket("enc")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := e.Encode(1920, [][]byte{{0xf8}, {0xf8}}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	// The last two 20 ms packets hold 1920 samples, but only 1000 are meant to be played.
+	if err := e.EncodeEOS(2920, [][]byte{{0xf8}, {0xf8}}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	r, err := NewOpusReader(&b)
+	if err != nil {
+		t.Fatal("unexpected NewOpusReader error:", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, _, err := r.ReadPacket(); err != nil {
+			t.Fatal("unexpected ReadPacket error:", err)
+		}
+		if r.EndTrim() != 0 {
+			t.Fatal("expected no end trim before the last packet, got", r.EndTrim())
+		}
+	}
+	if _, _, err := r.ReadPacket(); err != nil {
+		t.Fatal("unexpected ReadPacket error:", err)
+	}
+
+	if r.EndTrim() != 920 {
+		t.Fatal("expected end trim of 920, got", r.EndTrim())
+	}
+}
+
+func TestGaplessInfo(t *testing.T) {
+	// As an encoder would write 9000 samples: after the 312-sample pre-skip,
+	// the ten 20 ms packets hold 288 samples of padding.
+	var b bytes.Buffer
+	e := NewEncoder(7, &b)
+	if err := e.EncodeBOS(0, [][]byte{opusHeadPacket(2, 312)}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.Encode(0, [][]byte{opusTagsPacket("enc")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	for i := 1; i <= 10; i++ {
+		var err error
+		if i < 10 {
+			err = e.Encode(int64(i)*960, [][]byte{{0x08}})
+		} else {
+			err = e.EncodeEOS(9312, [][]byte{{0x08}})
+		}
+		if err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+	}
+
+	for _, stream := range [][]byte{b.Bytes(), b.Bytes()[:b.Len()-1]} {
+		rs := bytes.NewReader(stream)
+		preSkip, endTrim, err := GaplessInfo(rs)
+		if err != nil {
+			t.Fatal("unexpected GaplessInfo error:", err)
+		}
+		// cut short, the stream's last page is lost, and with it the trim
+		want := 288
+		if len(stream) < b.Len() {
+			want = 0
+		}
+		if preSkip != 312 || endTrim != want {
+			t.Fatalf("expected pre-skip 312 and end trim %d, got %d and %d", want, preSkip, endTrim)
+		}
+		if pos, _ := rs.Seek(0, io.SeekCurrent); pos != 0 {
+			t.Fatal("expected rs to be returned to 0, got", pos)
+		}
+	}
+
+	var vorbis bytes.Buffer
+	if err := NewEncoder(1, &vorbis).EncodeBOS(0, [][]byte{[]byte("\x01vorbis")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if _, _, err := GaplessInfo(bytes.NewReader(vorbis.Bytes())); err != ErrNoOpusStream {
+		t.Fatal("expected ErrNoOpusStream, got", err)
+	}
+}
+
+func TestVerifyOpusGranules(t *testing.T) {
+	tags := opusTagsPacket("test")
+	f := opusFile(t, 312, tags, []byte{0x08}, []byte{0x08}, []byte{0x08})
+	if err := VerifyOpusGranules(bytes.NewReader(f)); err != nil {
+		t.Fatal("unexpected VerifyOpusGranules error:", err)
+	}
+
+	var b bytes.Buffer
+	e := NewEncoder(7, &b)
+	if err := e.EncodeBOS(0, [][]byte{opusHeadPacket(2, 312)}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.Encode(0, [][]byte{tags}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := e.Encode(960, [][]byte{{0x08}}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	// trimming 100 samples from the end is fine
+	if err := e.EncodeEOS(1820, [][]byte{{0x08}}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+	if err := VerifyOpusGranules(&b); err != nil {
+		t.Fatal("unexpected VerifyOpusGranules error:", err)
+	}
+
+	tests := []struct {
+		granules []int64
+		want     ErrGranuleMismatch
+	}{
+		{[]int64{900, 1920}, ErrGranuleMismatch{0, 900, 960, false}},
+		{[]int64{960, 2000}, ErrGranuleMismatch{1, 2000, 1920, true}},
+		{[]int64{960, 900}, ErrGranuleMismatch{1, 900, 1920, true}},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		e := NewEncoder(7, &b)
+		if err := e.EncodeBOS(0, [][]byte{opusHeadPacket(2, 312)}); err != nil {
+			t.Fatal("unexpected EncodeBOS error:", err)
+		}
+		if err := e.Encode(0, [][]byte{tags}); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+		if err := e.Encode(test.granules[0], [][]byte{{0x08}}); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+		if err := e.EncodeEOS(test.granules[1], [][]byte{{0x08}}); err != nil {
+			t.Fatal("unexpected EncodeEOS error:", err)
+		}
+
+		err := VerifyOpusGranules(&b)
+		if err != test.want {
+			t.Fatalf("expected %v, got %v", test.want, err)
+		}
+	}
+}
+
+func TestDecodeOpusPacket(t *testing.T) {
+	data := opusFile(t, 312, opusTagsPacket("test"), []byte{0x08, 'a'}, []byte{0x08, 'b'})
+	var b bytes.Buffer
+	b.Write(data[:len(data)-headsz-1-2])
+	// the last page, and then pages of two packets and of a packet continued
+	e := NewEncoder(7, &b)
+	e.SetSequence(3)
+	for i, err := range []error{
+		e.Encode(1920+960, [][]byte{{0x08, 'b'}, {0x08, 'c'}}),
+		e.EncodeEOS(1920+960*3, [][]byte{bytes.Repeat([]byte{0x08}, 255*255)}),
+	} {
+		if err != nil {
+			t.Fatalf("%d: unexpected encoding error: %v", i, err)
+		}
+	}
+
+	d := NewDecoder(bytes.NewReader(b.Bytes()))
+	tests := []struct {
+		pkt     string
+		granule int64
+		err     error
+	}{
+		{string(opusHeadPacket(2, 312)), 0, nil},
+		{string(opusTagsPacket("test")), 0, nil},
+		{"\x08a", 960, nil},
+		{"", 1920 + 960, ErrMultiplePackets},
+		{"", -1, ErrContinuedPacket},
+		{"", 1920 + 960*3, ErrContinuedPacket},
+		{"", 0, io.EOF},
+	}
+	for i, test := range tests {
+		pkt, granule, err := d.DecodeOpusPacket()
+		if string(pkt) != test.pkt || granule != test.granule || err != test.err {
+			t.Fatalf("%d: expected %q, %d, %v, got %q, %d, %v", i, test.pkt, test.granule, test.err, pkt, granule, err)
+		}
+	}
+}
+
+func TestReadOpusTags(t *testing.T) {
+	art := "METADATA_BLOCK_PICTURE=" + string(bytes.Repeat([]byte("A"), 2*maxPageSize))
+	data := opusFile(t, 312, opusTagsPacket("enc", "TITLE=t", art), []byte{0x08, 'a'})
+	tagsEnd := len(data) - headsz - 1 - 2
+
+	// what follows the tags isn't read
+	r := &countingReader{r: bytes.NewReader(data)}
+	vendor, tags, err := ReadOpusTags(r)
+	if err != nil {
+		t.Fatal("unexpected ReadOpusTags error:", err)
+	}
+	if vendor != "enc" || tags["TITLE"][0] != "t" || len(tags["METADATA_BLOCK_PICTURE"][0]) != 2*maxPageSize {
+		t.Fatalf("unexpected tags %q %v", vendor, tags["TITLE"])
+	}
+	if r.n != tagsEnd {
+		t.Fatalf("expected to read %d bytes, read %d", tagsEnd, r.n)
+	}
+
+	if _, _, err := ReadOpusTags(bytes.NewReader(data[:tagsEnd-1])); err != io.ErrUnexpectedEOF {
+		t.Fatal("expected ErrUnexpectedEOF for truncated tags, got", err)
+	}
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
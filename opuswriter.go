@@ -0,0 +1,89 @@
+package ogg
+
+import (
+	"crypto/rand"
+	"io"
+)
+
+// opusWriterVendor is the vendor string OpusWriter writes in the OpusTags header.
+const opusWriterVendor = "github.com/SaurusXI/ogg"
+
+// opusPageSamples is the most audio, in 48 kHz samples, that an OpusWriter puts on a page:
+// a second, which bounds the granularity of seeking without wasting much on page overhead.
+const opusPageSamples = 48000
+
+// An OpusWriter writes an Ogg Opus stream from Opus packets,
+// taking care of its headers, pages, and granule positions.
+// It's the counterpart of OpusReader.
+type OpusWriter struct {
+	e *Encoder
+	// the packets of the page being filled, their segments and samples,
+	// and the samples of all the packets written so far
+	packets  [][]byte
+	segments int
+	samples  int
+	granule  int64
+}
+
+// NewOpusFileWriter creates an OpusWriter writing to w, with a random serial number,
+// and writes the stream's OpusHead and OpusTags headers, each on its own page.
+// The OpusTags vendor string identifies this package, and its comments are tags,
+// in order of their names.
+// The error is ErrBadOpusHead if head is invalid, or any error writing w.
+func NewOpusFileWriter(w io.Writer, head OpusHead, tags map[string][]string) (*OpusWriter, error) {
+	headPacket := appendOpusHead(nil, head)
+	if _, err := ParseOpusHead(headPacket); err != nil {
+		return nil, err
+	}
+	if head.MappingFamily != 0 && len(head.ChannelMapping) != int(head.Channels) {
+		return nil, ErrBadOpusHead
+	}
+
+	var serial [4]byte
+	if _, err := rand.Read(serial[:]); err != nil {
+		return nil, err
+	}
+	o := &OpusWriter{e: NewEncoder(byteOrder.Uint32(serial[:]), w)}
+	if err := o.e.EncodeBOS(0, [][]byte{headPacket}); err != nil {
+		return nil, err
+	}
+	tagsPacket := appendComments(append([]byte(nil), opusTagsMagic...), opusWriterVendor, tags)
+	if err := o.e.Encode(0, [][]byte{tagsPacket}); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// WritePacket adds an audio packet to the stream, after checking it with ValidateOpusPacket.
+// Packets are buffered until they fill a page, or a second of audio,
+// and the granule position of each page is the number of 48 kHz samples up to its end.
+// The packet is copied, so the caller may reuse it.
+func (o *OpusWriter) WritePacket(pkt []byte) error {
+	if err := ValidateOpusPacket(pkt); err != nil {
+		return err
+	}
+	samples, _ := opusSamples(pkt)
+	segs := len(pkt)/mss + 1
+
+	// Keep at least one packet buffered, for Close to write on the EOS page.
+	if len(o.packets) > 0 && (o.segments+segs > mss || o.samples+samples > opusPageSamples) {
+		if err := o.e.Encode(o.granule, o.packets); err != nil {
+			return err
+		}
+		o.packets, o.segments, o.samples = o.packets[:0], 0, 0
+	}
+
+	o.packets = append(o.packets, append([]byte(nil), pkt...))
+	o.segments += segs
+	o.samples += samples
+	o.granule += int64(samples)
+	return nil
+}
+
+// Close writes the buffered packets as the stream's EOS page,
+// whose granule position is the number of 48 kHz samples in the stream.
+// If no packet was written, the EOS page holds one empty packet.
+// The OpusWriter must not be used afterward. Close doesn't close the underlying Writer.
+func (o *OpusWriter) Close() error {
+	return o.e.EncodeEOS(o.granule, o.packets)
+}
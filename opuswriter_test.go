@@ -0,0 +1,99 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOpusWriter(t *testing.T) {
+	head := OpusHead{Version: 1, Channels: 2, PreSkip: 312, InputSampleRate: 44100}
+	tags := map[string][]string{"TITLE": {"test"}, "ARTIST": {"a", "b"}}
+
+	var b bytes.Buffer
+	o, err := NewOpusFileWriter(&b, head, tags)
+	if err != nil {
+		t.Fatal("unexpected NewOpusFileWriter error:", err)
+	}
+	// 2.4 s of 20 ms packets
+	for i := 0; i < 120; i++ {
+		if err := o.WritePacket([]byte{31 << 3, byte(i)}); err != nil {
+			t.Fatalf("%d: unexpected WritePacket error: %v", i, err)
+		}
+	}
+	if err := o.WritePacket([]byte{0x0b, 0x00}); err != ErrOpusFrameCount {
+		t.Fatal("expected ErrOpusFrameCount for a malformed packet, got", err)
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal("unexpected Close error:", err)
+	}
+
+	if err := VerifyOpusGranules(bytes.NewReader(b.Bytes())); err != nil {
+		t.Fatal("unexpected VerifyOpusGranules error:", err)
+	}
+
+	d := NewDecoder(bytes.NewReader(b.Bytes()))
+	d.Conformance = ConformancePedantic
+	var granules []int64
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		granules = append(granules, p.Granule)
+	}
+	if want := []int64{0, 0, 48000, 96000, 115200}; !reflect.DeepEqual(granules, want) {
+		t.Fatalf("expected granule positions %v, got %v", want, granules)
+	}
+	if !d.CleanEOF() {
+		t.Fatal("expected the stream to end with an EOS page")
+	}
+
+	r, err := NewOpusReader(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal("unexpected NewOpusReader error:", err)
+	}
+	head.StreamCount, head.CoupledCount = 1, 1
+	if !reflect.DeepEqual(r.Head, head) {
+		t.Fatalf("expected head %+v, got %+v", head, r.Head)
+	}
+	if r.Vendor != opusWriterVendor || !reflect.DeepEqual(r.Tags, tags) {
+		t.Fatalf("expected tags %v, got %q %v", tags, r.Vendor, r.Tags)
+	}
+	for i := 0; ; i++ {
+		data, ts, err := r.ReadPacket()
+		if err == io.EOF {
+			if i != 120 {
+				t.Fatalf("expected 120 packets, got %d", i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected ReadPacket error:", err)
+		}
+		if data[1] != byte(i) {
+			t.Fatalf("packet %d: got packet %d", i, data[1])
+		}
+		if want := time.Duration(i)*20*time.Millisecond - 6500*time.Microsecond; ts != want {
+			t.Fatalf("packet %d: expected timestamp %v, got %v", i, want, ts)
+		}
+	}
+}
+
+func TestOpusWriterBadHead(t *testing.T) {
+	for _, head := range []OpusHead{
+		{Version: 1},
+		{Version: 1, Channels: 3},
+		{Version: 0x10, Channels: 1},
+		{Version: 1, Channels: 3, MappingFamily: 1, StreamCount: 2, CoupledCount: 1, ChannelMapping: []byte{0, 1}},
+	} {
+		if _, err := NewOpusFileWriter(io.Discard, head, nil); err != ErrBadOpusHead {
+			t.Fatalf("%+v: expected ErrBadOpusHead, got %v", head, err)
+		}
+	}
+}
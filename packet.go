@@ -0,0 +1,207 @@
+package ogg
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrPacketTooLarge is returned by DecodePacket when a packet exceeds the Decoder's MaxPacketBytes.
+var ErrPacketTooLarge = errors.New("packet exceeds the maximum size")
+
+// ErrTooManyContinuations is returned by DecodePacket when a packet is continued
+// on more pages than the Decoder's MaxContinuationPages.
+var ErrTooManyContinuations = errors.New("packet continues on too many pages")
+
+// A Packet is a complete packet of a logical stream,
+// reassembled from however many pages it spans.
+type Packet struct {
+	// Data is the packet's contents.
+	Data []byte
+	// Serial is the serial number of the packet's logical stream.
+	Serial uint32
+	// Granule is the granule position of the page on which the packet ends,
+	// if it is the last packet to end on that page. Otherwise it is -1.
+	Granule int64
+	// BOS is set for packets from a beginning-of-stream page.
+	BOS bool
+	// EOS is set for the last packet of a logical stream.
+	EOS bool
+	// Partial is set for a packet cut short by the end of the stream.
+	// See Decoder.EmitPartialOnEOF.
+	Partial bool
+	// SourceOffset is the offset in the Decoder's Reader at which the packet's data begins,
+	// as counted by Decoder.Offset.
+	SourceOffset int64
+}
+
+// DecodePacket reads pages from d's Reader as needed to return the next complete packet.
+// Packets continued across pages are joined back together.
+// Each logical stream's packets are reassembled separately, so the continued packets
+// of multiplexed streams may interleave, and skipping one stream's pages with SkipPage
+// doesn't disturb the reassembly of the others.
+// A continuation whose beginning was never seen, such as at the start of
+// a stream that was joined in progress, is dropped.
+// The error may be io.EOF if that's what the Reader returned.
+//
+// If the stream ends while packets are still awaiting their continuations,
+// they're dropped by default, since most codecs can't decode them.
+// If d.EmitPartialOnEOF is set, they're instead returned with Partial set
+// and a granule position of -1, in order of their serial numbers, and the end of the stream
+// is reported by the call following the last.
+//
+// Unlike the Packets of a Page, the returned Packet's Data is not owned by the Decoder.
+//
+// DecodePacket buffers the rest of each page's packets for subsequent calls,
+// so calls to Decode between calls to DecodePacket will skip them.
+//
+// If a packet exceeds d.MaxPacketBytes or d.MaxContinuationPages, DecodePacket drops it
+// and returns ErrPacketTooLarge or ErrTooManyContinuations,
+// after which it may be called again to continue with the following packets.
+func (d *Decoder) DecodePacket() (Packet, error) {
+	for len(d.pending) == 0 {
+		p, _, err := d.Decode()
+		if pkt, ok := d.release(err); ok && d.EmitPartialOnEOF {
+			return pkt, nil
+		}
+		if err != nil {
+			return Packet{}, err
+		}
+		if err := d.reassemble(p); err != nil {
+			return Packet{}, err
+		}
+	}
+
+	pkt := d.pending[0]
+	d.pending = d.pending[1:]
+	return pkt, nil
+}
+
+// A heldPacket is the beginning of a packet that DecodePacket is holding for its continuation.
+type heldPacket struct {
+	data   []byte
+	offset int64
+	// the number of pages it has been continued on
+	pages int
+}
+
+// release lets go of a packet held for its continuation that err, if it reports the end of the stream,
+// leaves unfinished, returning it as a Partial packet:
+// that of the logical stream an ErrTruncatedFinalPacket names,
+// or at the end of d's Reader, that of the lowest serial number.
+func (d *Decoder) release(err error) (Packet, bool) {
+	var serial uint32
+	ok := false
+	if e, truncated := err.(ErrTruncatedFinalPacket); truncated {
+		serial, ok = e.Serial, d.held[e.Serial] != nil
+	} else if err == io.EOF || err == io.ErrUnexpectedEOF {
+		for s := range d.held {
+			if !ok || s < serial {
+				serial, ok = s, true
+			}
+		}
+	}
+	if !ok {
+		return Packet{}, false
+	}
+
+	h := d.held[serial]
+	delete(d.held, serial)
+	return Packet{
+		Data:         h.data,
+		Serial:       serial,
+		Granule:      -1,
+		Partial:      true,
+		SourceOffset: h.offset,
+	}, true
+}
+
+// reassemble queues the packets completed by p, and holds on to any
+// packet it leaves unfinished.
+// If that exceeds d's limits, the held packet is dropped and the error returned,
+// though p's other packets are still queued.
+func (d *Decoder) reassemble(p Page) error {
+	var err error
+	d.pending = d.pending[:0]
+	n := len(p.Packets)
+	end := n
+	if d.unfinished {
+		end = n - 1
+	}
+
+	// p's payload is the last thing d read.
+	offset := d.offset
+	for _, pkt := range p.Packets {
+		offset -= int64(len(pkt))
+	}
+
+	// A packet held for p's stream is either continued by p, or its rest was lost.
+	h := d.held[p.Serial]
+	delete(d.held, p.Serial)
+
+	start := 0
+	if p.Type&COP != 0 {
+		start = 1
+		if h != nil {
+			h.pages++
+			if err = d.holdLimit(len(h.data)+len(p.Packets[0]), h.pages); err == nil {
+				// append grows h.data geometrically, so reassembly is linear in the packet's size
+				h.data = append(h.data, p.Packets[0]...)
+				if end < 1 {
+					d.held[p.Serial] = h
+					return nil
+				}
+				d.complete(p, h.data, h.offset, 0, end)
+			}
+		}
+		offset += int64(len(p.Packets[0]))
+	}
+
+	for i := start; i < end; i++ {
+		data := append([]byte(nil), p.Packets[i]...)
+		d.complete(p, data, offset, i, end)
+		offset += int64(len(data))
+	}
+
+	if end < n && end >= start {
+		if herr := d.holdLimit(len(p.Packets[end]), 0); herr != nil {
+			if err == nil {
+				err = herr
+			}
+		} else {
+			if d.held == nil {
+				d.held = make(map[uint32]*heldPacket)
+			}
+			d.held[p.Serial] = &heldPacket{data: append([]byte(nil), p.Packets[end]...), offset: offset}
+		}
+	}
+	return err
+}
+
+// holdLimit returns the error for holding a packet of size bytes, continued on the given number of pages,
+// if that exceeds d's limits.
+func (d *Decoder) holdLimit(size, pages int) error {
+	if d.MaxContinuationPages > 0 && pages > d.MaxContinuationPages {
+		return ErrTooManyContinuations
+	}
+	if d.MaxPacketBytes > 0 && size > d.MaxPacketBytes {
+		return ErrPacketTooLarge
+	}
+	return nil
+}
+
+// complete queues data, which begins at offset, as the packet at index i of p,
+// of which end packets are completed on p.
+func (d *Decoder) complete(p Page, data []byte, offset int64, i, end int) {
+	pkt := Packet{
+		Data:         data,
+		Serial:       p.Serial,
+		Granule:      -1,
+		BOS:          p.Type&BOS != 0,
+		SourceOffset: offset,
+	}
+	if i == end-1 {
+		pkt.Granule = p.Granule
+		pkt.EOS = p.Type&EOS != 0
+	}
+	d.pending = append(d.pending, pkt)
+}
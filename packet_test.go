@@ -0,0 +1,338 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"testing"
+)
+
+func TestDecodePacket(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+
+	long := bytes.Repeat([]byte("x"), maxPageSize*2)
+	err := e.EncodeBOS(0, [][]byte{[]byte("head")})
+	if err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	err = e.Encode(5, [][]byte{[]byte("a"), long, []byte("b")})
+	if err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	err = e.EncodeEOS(9, [][]byte{[]byte("c")})
+	if err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	expect := []Packet{
+		{Data: []byte("head"), Serial: 1, Granule: 0, BOS: true},
+		{Data: []byte("a"), Serial: 1, Granule: 5},
+		{Data: long, Serial: 1, Granule: -1},
+		{Data: []byte("b"), Serial: 1, Granule: 5},
+		{Data: []byte("c"), Serial: 1, Granule: 9, EOS: true},
+	}
+
+	d := NewDecoder(&b)
+	for i, x := range expect {
+		p, err := d.DecodePacket()
+		if err != nil {
+			t.Fatal("unexpected DecodePacket error:", err)
+		}
+		if !bytes.Equal(p.Data, x.Data) {
+			t.Fatalf("packet %d has the wrong data (%d bytes vs. %d)", i, len(p.Data), len(x.Data))
+		}
+		if p.Serial != x.Serial || p.Granule != x.Granule || p.BOS != x.BOS || p.EOS != x.EOS {
+			t.Fatalf("packet %d = %+v, expected %+v", i, p, x)
+		}
+	}
+
+	_, err = d.DecodePacket()
+	if err != io.EOF {
+		t.Fatal("expected EOF, got:", err)
+	}
+}
+
+func TestDecodePacketLostStart(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+
+	err := e.Encode(5, [][]byte{bytes.Repeat([]byte("x"), mps+10), []byte("a")})
+	if err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+
+	// Skip the first page, as if joining the stream late.
+	d := NewDecoder(&b)
+	if _, _, err := d.Decode(); err != nil {
+		t.Fatal("unexpected Decode error:", err)
+	}
+
+	p, err := d.DecodePacket()
+	if err != nil {
+		t.Fatal("unexpected DecodePacket error:", err)
+	}
+	if !bytes.Equal(p.Data, []byte("a")) {
+		t.Fatalf("expected the continued fragment to be dropped, got %d bytes", len(p.Data))
+	}
+}
+
+func truncatedStream(t *testing.T) []byte {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+
+	err := e.Encode(5, [][]byte{[]byte("a"), bytes.Repeat([]byte("x"), mps)})
+	if err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+
+	// Cut the stream after the first page, which ends mid-packet.
+	d := NewDecoder(bytes.NewReader(b.Bytes()))
+	_, n, err := d.Decode()
+	if err != nil {
+		t.Fatal("unexpected Decode error:", err)
+	}
+	return b.Bytes()[:n]
+}
+
+func TestDecodePacketPartialOnEOF(t *testing.T) {
+	stream := truncatedStream(t)
+
+	d := NewDecoder(bytes.NewReader(stream))
+	p, err := d.DecodePacket()
+	if err != nil || string(p.Data) != "a" {
+		t.Fatalf("unexpected first packet %q, error: %v", p.Data, err)
+	}
+	_, err = d.DecodePacket()
+	if err != io.EOF {
+		t.Fatal("expected the partial packet to be dropped and EOF, got:", err)
+	}
+
+	d = NewDecoder(bytes.NewReader(stream))
+	d.EmitPartialOnEOF = true
+	if _, err = d.DecodePacket(); err != nil {
+		t.Fatal("unexpected DecodePacket error:", err)
+	}
+	p, err = d.DecodePacket()
+	if err != nil {
+		t.Fatal("unexpected DecodePacket error:", err)
+	}
+	if !p.Partial || p.Granule != -1 || len(p.Data) != mps-mss {
+		t.Fatalf("unexpected partial packet: %d bytes, %+v", len(p.Data), p.Partial)
+	}
+	_, err = d.DecodePacket()
+	if err != io.EOF {
+		t.Fatal("expected EOF, got:", err)
+	}
+}
+
+func TestPacketSourceOffset(t *testing.T) {
+	var b bytes.Buffer
+	b.WriteString("junk")
+	e := NewEncoder(1, &b)
+
+	err := e.Encode(5, [][]byte{[]byte("first"), []byte("second"), bytes.Repeat([]byte("x"), mps)})
+	if err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	err = e.Encode(6, [][]byte{[]byte("last")})
+	if err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	stream := b.Bytes()
+
+	d := NewDecoder(&b)
+	for _, expect := range []string{"first", "second", "xxx", "last"} {
+		p, err := d.DecodePacket()
+		if err != nil {
+			t.Fatal("unexpected DecodePacket error:", err)
+		}
+		off := p.SourceOffset
+		if !bytes.HasPrefix(stream[off:], []byte(expect)) {
+			t.Fatalf("packet %q has offset %d, which holds %q", p.Data[:3], off, stream[off:off+3])
+		}
+	}
+
+	if d.Offset() != int64(len(stream)) {
+		t.Fatalf("Offset() = %d, expected %d", d.Offset(), len(stream))
+	}
+}
+
+func TestDecodePacketLimits(t *testing.T) {
+	// one packet fragmented over a page per segment, followed by a small one
+	const pages = 1000
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	frag := bytes.Repeat([]byte("x"), mss)
+	if err := e.EncodePage(Page{Granule: -1, Packets: [][]byte{frag}, Unfinished: true}); err != nil {
+		t.Fatal("unexpected EncodePage error:", err)
+	}
+	for i := 1; i < pages; i++ {
+		if err := e.EncodePage(Page{Type: COP, Granule: -1, Packets: [][]byte{frag}, Unfinished: true}); err != nil {
+			t.Fatal("unexpected EncodePage error:", err)
+		}
+	}
+	if err := e.EncodePage(Page{Type: COP, Granule: 1, Packets: [][]byte{[]byte("end"), []byte("next")}}); err != nil {
+		t.Fatal("unexpected EncodePage error:", err)
+	}
+
+	tests := []struct {
+		bytes, pages int
+		err          error
+	}{
+		{0, 0, nil},
+		{pages*mss + 3, pages, nil},
+		{0, pages - 1, ErrTooManyContinuations},
+		{10 * mss, 0, ErrPacketTooLarge},
+		{100, 0, ErrPacketTooLarge},
+	}
+	for i, test := range tests {
+		d := NewDecoder(bytes.NewReader(b.Bytes()))
+		d.MaxPacketBytes = test.bytes
+		d.MaxContinuationPages = test.pages
+
+		var sizes []int
+		var errs []error
+		for {
+			pkt, err := d.DecodePacket()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			sizes = append(sizes, len(pkt.Data))
+		}
+
+		if test.err == nil {
+			if len(errs) != 0 || len(sizes) != 3 || sizes[1] != pages*mss+3 {
+				t.Fatalf("%d: unexpected packets %v and errors %v", i, sizes, errs)
+			}
+			continue
+		}
+		// the long packet is dropped, and decoding continues after it
+		if len(errs) != 1 || errs[0] != test.err || len(sizes) != 2 || sizes[0] != 4 || sizes[1] != 4 {
+			t.Fatalf("%d: unexpected packets %v and errors %v", i, sizes, errs)
+		}
+	}
+}
+
+func TestDecodePacketInterleaved(t *testing.T) {
+	var b bytes.Buffer
+	a, v := NewEncoder(1, &b), NewEncoder(2, &b)
+	along := bytes.Repeat([]byte{'A'}, mss+10)
+	vlong := bytes.Repeat([]byte{'V'}, 2*mss+10)
+	for i, err := range []error{
+		a.EncodeBOS(0, [][]byte{[]byte("a0")}),
+		v.EncodeBOS(0, [][]byte{[]byte("v0")}),
+		// both streams' long packets continue across the other's pages
+		a.EncodePage(Page{Serial: 1, Granule: 1, Packets: [][]byte{[]byte("a1"), along[:mss]}, Unfinished: true}),
+		v.EncodePage(Page{Serial: 2, Granule: 1, Packets: [][]byte{[]byte("v1"), vlong[:mss]}, Unfinished: true}),
+		a.EncodePage(Page{Type: COP | EOS, Serial: 1, Granule: 2, Packets: [][]byte{along[mss:], []byte("a2")}}),
+		v.EncodePage(Page{Type: COP, Serial: 2, Granule: -1, Packets: [][]byte{vlong[mss : 2*mss]}, Unfinished: true}),
+		v.EncodePage(Page{Type: COP | EOS, Serial: 2, Granule: 2, Packets: [][]byte{vlong[2*mss:], []byte("v2")}}),
+	} {
+		if err != nil {
+			t.Fatalf("%d: unexpected encoding error: %v", i, err)
+		}
+	}
+	stream := b.Bytes()
+	expected := map[uint32][]string{
+		1: {"a0", "a1", string(along), "a2"},
+		2: {"v0", "v1", string(vlong), "v2"},
+	}
+
+	check := func(name string, got map[uint32][]string, serials ...uint32) {
+		for _, serial := range serials {
+			want := expected[serial]
+			if len(got[serial]) != len(want) {
+				t.Fatalf("%s: expected %d packets of stream %d, got %d", name, len(want), serial, len(got[serial]))
+			}
+			for i := range want {
+				if got[serial][i] != want[i] {
+					t.Fatalf("%s: packet %d of stream %d differs", name, i, serial)
+				}
+			}
+		}
+		if len(got) != len(serials) {
+			t.Fatalf("%s: expected packets of %d streams, got %d", name, len(serials), len(got))
+		}
+	}
+
+	got := make(map[uint32][]string)
+	d := NewDecoder(bytes.NewReader(stream))
+	for {
+		pkt, err := d.DecodePacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected DecodePacket error:", err)
+		}
+		got[pkt.Serial] = append(got[pkt.Serial], string(pkt.Data))
+	}
+	check("both", got, 1, 2)
+
+	// Route each stream to its own processing, skipping the other's pages.
+	for _, keep := range []uint32{1, 2} {
+		got := make(map[uint32][]string)
+		d := NewDecoder(bytes.NewReader(stream))
+		for {
+			p, _, err := d.Peek()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal("unexpected Peek error:", err)
+			}
+			if p.Serial != keep {
+				if _, _, err := d.SkipPage(); err != nil {
+					t.Fatal("unexpected SkipPage error:", err)
+				}
+				continue
+			}
+			// DecodePacket reads the peeked page, then returns its packets in turn.
+			for {
+				pkt, err := d.DecodePacket()
+				if err != nil {
+					t.Fatal("unexpected DecodePacket error:", err)
+				}
+				got[pkt.Serial] = append(got[pkt.Serial], string(pkt.Data))
+				if len(d.pending) == 0 {
+					break
+				}
+			}
+		}
+		check("only stream "+strconv.Itoa(int(keep)), got, keep)
+	}
+
+	// Cut short after both long packets begin, both are partial.
+	d = NewDecoder(bytes.NewReader(stream))
+	for i := 0; i < 4; i++ {
+		if _, _, err := d.Decode(); err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+	}
+	d = NewDecoder(bytes.NewReader(stream[:d.Offset()]))
+	d.EmitPartialOnEOF = true
+	var partial []uint32
+	for {
+		pkt, err := d.DecodePacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected DecodePacket error:", err)
+		}
+		if pkt.Partial {
+			partial = append(partial, pkt.Serial)
+		}
+	}
+	if len(partial) != 2 || partial[0] != 1 || partial[1] != 2 {
+		t.Fatal("expected partial packets of streams 1 and 2, got", partial)
+	}
+}
@@ -0,0 +1,75 @@
+package ogg
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+)
+
+// PictureTag is the name of the comment that embeds pictures, such as cover art,
+// in the comment headers of Vorbis and Opus.
+const PictureTag = "METADATA_BLOCK_PICTURE"
+
+// ErrBadPicture is the error used when a picture block's lengths are inconsistent with its size.
+var ErrBadPicture = errors.New("malformed picture block")
+
+// A Picture is a picture embedded in a stream's comments, as a FLAC picture block.
+type Picture struct {
+	// Type is the picture type of ID3v2 APIC frames, such as 3 for the front cover.
+	Type uint32
+	// MIME is the MIME type of Data, or "-->" if Data is instead the URL of the picture.
+	MIME        string
+	Description string
+	// Width and Height are in pixels, Depth is in bits per pixel,
+	// and Colors is the number of colors of an indexed picture, or 0.
+	Width, Height, Depth, Colors uint32
+	// Data is the picture file itself.
+	Data []byte
+}
+
+// ParsePicture parses the value of a PictureTag comment,
+// a base64-encoded FLAC picture block.
+// The error is a base64.CorruptInputError if the value isn't valid base64,
+// or ErrBadPicture if the block is malformed.
+func ParsePicture(tagValue string) (Picture, error) {
+	b, err := base64.StdEncoding.DecodeString(tagValue)
+	if err != nil {
+		return Picture{}, err
+	}
+
+	// The block's fields are big-endian, unlike those of the comments around it.
+	ok := true
+	u32 := func() uint32 {
+		if len(b) < 4 {
+			ok = false
+			return 0
+		}
+		n := binary.BigEndian.Uint32(b)
+		b = b[4:]
+		return n
+	}
+	field := func() []byte {
+		n := u32()
+		if !ok || uint64(n) > uint64(len(b)) {
+			ok = false
+			return nil
+		}
+		f := b[:n:n]
+		b = b[n:]
+		return f
+	}
+
+	var p Picture
+	p.Type = u32()
+	p.MIME = string(field())
+	p.Description = string(field())
+	p.Width = u32()
+	p.Height = u32()
+	p.Depth = u32()
+	p.Colors = u32()
+	p.Data = field()
+	if !ok {
+		return Picture{}, ErrBadPicture
+	}
+	return p, nil
+}
@@ -0,0 +1,62 @@
+package ogg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+)
+
+func pictureBlock(typ uint32, mime, desc string, w, h, depth, colors uint32, data []byte) []byte {
+	var b []byte
+	u32 := func(n uint32) {
+		b = binary.BigEndian.AppendUint32(b, n)
+	}
+	u32(typ)
+	u32(uint32(len(mime)))
+	b = append(b, mime...)
+	u32(uint32(len(desc)))
+	b = append(b, desc...)
+	u32(w)
+	u32(h)
+	u32(depth)
+	u32(colors)
+	u32(uint32(len(data)))
+	return append(b, data...)
+}
+
+func TestParsePicture(t *testing.T) {
+	data := []byte("\x89PNG\r\n\x1a\nimage")
+	block := pictureBlock(3, "image/png", "Cover", 600, 400, 24, 0, data)
+
+	_, comments, err := ParseComments(commentHeader("enc", PictureTag+"="+base64.StdEncoding.EncodeToString(block)))
+	if err != nil {
+		t.Fatal("unexpected ParseComments error:", err)
+	}
+	p, err := ParsePicture(comments[PictureTag][0])
+	if err != nil {
+		t.Fatal("unexpected ParsePicture error:", err)
+	}
+	if p.Type != 3 || p.MIME != "image/png" || p.Description != "Cover" ||
+		p.Width != 600 || p.Height != 400 || p.Depth != 24 || p.Colors != 0 || !bytes.Equal(p.Data, data) {
+		t.Fatalf("unexpected picture: %+v", p)
+	}
+
+	bad := map[string][]byte{
+		"empty":          {},
+		"truncated":      block[:len(block)-1],
+		"long MIME":      append(append(block[:4:4], 0xff, 0, 0, 0), block[8:]...),
+		"missing fields": block[:4+4+len("image/png")+4+len("Cover")+8],
+	}
+	for name, b := range bad {
+		if _, err := ParsePicture(base64.StdEncoding.EncodeToString(b)); err != ErrBadPicture {
+			t.Errorf("%s: expected ErrBadPicture, got %v", name, err)
+		}
+	}
+
+	if _, err := ParsePicture("not*base64"); err == nil {
+		t.Error("expected an error for invalid base64")
+	} else if _, ok := err.(base64.CorruptInputError); !ok {
+		t.Error("expected a base64.CorruptInputError, got", err)
+	}
+}
@@ -0,0 +1,122 @@
+package ogg
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A StreamProfile describes the structure of a physical stream, as found by ProfileStream.
+type StreamProfile struct {
+	// Version is the stream structure version of the first page.
+	Version byte
+	// Streams are the logical streams, in the order of their BOS pages.
+	Streams []StreamInfo
+	// Links is the number of links in the chain, and Chained is set if there's more than one.
+	Links   int
+	Chained bool
+	// Multiplexed is set if any link groups more than one logical stream.
+	Multiplexed bool
+	// Classic is set if every link is a lone Vorbis stream, the layout of the original Ogg Vorbis files,
+	// as opposed to the RFC 3533 container more generally, which old players may not handle.
+	Classic bool
+	// Pages is the number of pages read, including corrupt ones.
+	Pages int
+	// Nonconformances are the errors of the pages that are corrupt or fail the pedantic checks, in order.
+	Nonconformances []error
+}
+
+// ProfileStream reads the whole of rs to describe its structure,
+// checking each page against ConformancePedantic and its CRC,
+// after which rs is returned to its original position.
+// Pages that are corrupt or fail a check are recorded in the profile's Nonconformances,
+// as is a truncated final page.
+// The error is ErrNoPages if rs holds no pages, or any error reading rs.
+func ProfileStream(rs io.ReadSeeker) (StreamProfile, error) {
+	var prof StreamProfile
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return prof, err
+	}
+
+	d := NewDecoder(rs)
+	d.Conformance = ConformancePedantic
+	d.KeepRawPage = true
+	bos, data := 0, false
+	prof.Classic = true
+	for {
+		p, _, err := d.decode(false)
+		if err == io.EOF {
+			break
+		}
+		if err == io.ErrUnexpectedEOF {
+			// a truncated final page, or trailing junk
+			prof.Nonconformances = append(prof.Nonconformances, err)
+			break
+		}
+		if err != nil && !corrupt(err) {
+			return prof, err
+		}
+		prof.Pages++
+		if err != nil {
+			prof.Nonconformances = append(prof.Nonconformances, err)
+			continue
+		}
+
+		h := parseHeader(p.Raw)
+		if prof.Pages == 1 {
+			prof.Version = h.StreamVersion
+		}
+		if err := d.track(&h, len(p.Packets)); err != nil {
+			prof.Nonconformances = append(prof.Nonconformances, err)
+		}
+
+		if p.Type&BOS == 0 {
+			data = true
+			continue
+		}
+		if data || prof.Links == 0 {
+			prof.Links++
+			bos, data = 0, false
+		}
+		bos++
+
+		var c Codec
+		if len(p.Packets) > 0 {
+			c = IdentifyCodec(p.Packets[0])
+		}
+		prof.Streams = append(prof.Streams, StreamInfo{p.Serial, c})
+		prof.Multiplexed = prof.Multiplexed || bos > 1
+		prof.Classic = prof.Classic && bos == 1 && c == CodecVorbis
+	}
+
+	prof.Nonconformances = append(prof.Nonconformances, d.truncated()...)
+
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return prof, err
+	}
+	if prof.Pages == 0 {
+		return prof, ErrNoPages
+	}
+	prof.Chained = prof.Links > 1
+	prof.Classic = prof.Classic && prof.Links > 0
+	return prof, nil
+}
+
+// String formats p as a report, a line for each property.
+func (p StreamProfile) String() string {
+	var b strings.Builder
+	b.WriteString("version: " + strconv.Itoa(int(p.Version)) + "\n")
+	b.WriteString("pages: " + strconv.Itoa(p.Pages) + "\n")
+	b.WriteString("links: " + strconv.Itoa(p.Links) + "\n")
+	for _, s := range p.Streams {
+		b.WriteString("stream " + strconv.FormatUint(uint64(s.Serial), 10) + ": " + s.Codec.String() + "\n")
+	}
+	b.WriteString("chained: " + strconv.FormatBool(p.Chained) + "\n")
+	b.WriteString("multiplexed: " + strconv.FormatBool(p.Multiplexed) + "\n")
+	b.WriteString("classic: " + strconv.FormatBool(p.Classic) + "\n")
+	for _, err := range p.Nonconformances {
+		b.WriteString("nonconformance: " + err.Error() + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestProfileStream(t *testing.T) {
+	vorbis := func(serial uint32) []byte {
+		var b bytes.Buffer
+		e := NewEncoder(serial, &b)
+		if err := e.EncodeBOS(0, [][]byte{vorbisIDPacket(44100, 8, 11)}); err != nil {
+			t.Fatal("unexpected EncodeBOS error:", err)
+		}
+		if err := e.EncodeEOS(100, [][]byte{[]byte("audio")}); err != nil {
+			t.Fatal("unexpected EncodeEOS error:", err)
+		}
+		return b.Bytes()
+	}
+	opus := opusFile(t, 312, opusTagsPacket("test"), []byte{0x08})
+
+	var muxed bytes.Buffer
+	e1 := NewEncoder(1, &muxed)
+	e2 := NewEncoder(2, &muxed)
+	for i, err := range []error{
+		e1.EncodeBOS(0, [][]byte{[]byte("\x80theora")}),
+		e2.EncodeBOS(0, [][]byte{vorbisIDPacket(48000, 8, 11)}),
+		e1.EncodeEOS(1, nil),
+		e2.EncodeEOS(1, nil),
+	} {
+		if err != nil {
+			t.Fatalf("%d: unexpected encoding error: %v", i, err)
+		}
+	}
+
+	chained := append(vorbis(1), vorbis(2)...)
+	corrupted := append([]byte(nil), chained...)
+	corrupted[len(corrupted)-1] ^= 1
+	gap := append(vorbis(1), opus...)
+	// drop the OpusTags page, leaving a sequence gap
+	tagsPage := len(vorbis(1)) + headsz + 1 + len(opusHeadPacket(2, 312))
+	gap = append(gap[:tagsPage:tagsPage], gap[tagsPage+headsz+1+len(opusTagsPacket("test")):]...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want StreamProfile
+		errs int
+	}{
+		{"classic", vorbis(1), StreamProfile{
+			Streams: []StreamInfo{{1, CodecVorbis}}, Links: 1, Classic: true, Pages: 2,
+		}, 0},
+		{"chained", chained, StreamProfile{
+			Streams: []StreamInfo{{1, CodecVorbis}, {2, CodecVorbis}}, Links: 2, Chained: true, Classic: true, Pages: 4,
+		}, 0},
+		{"opus", opus, StreamProfile{
+			Streams: []StreamInfo{{7, CodecOpus}}, Links: 1, Pages: 3,
+		}, 0},
+		{"multiplexed", muxed.Bytes(), StreamProfile{
+			Streams: []StreamInfo{{1, CodecTheora}, {2, CodecVorbis}}, Links: 1, Multiplexed: true, Pages: 4,
+		}, 0},
+		{"corrupt", corrupted, StreamProfile{
+			Streams: []StreamInfo{{1, CodecVorbis}, {2, CodecVorbis}}, Links: 2, Chained: true, Classic: true, Pages: 4,
+		}, 1},
+		{"sequence gap", gap, StreamProfile{
+			Streams: []StreamInfo{{1, CodecVorbis}, {7, CodecOpus}}, Links: 2, Chained: true, Pages: 4,
+		}, 1},
+	}
+	for _, test := range tests {
+		r := bytes.NewReader(test.data)
+		prof, err := ProfileStream(r)
+		if err != nil {
+			t.Fatalf("%s: unexpected ProfileStream error: %v", test.name, err)
+		}
+		if len(prof.Nonconformances) != test.errs {
+			t.Fatalf("%s: expected %d nonconformances, got %v", test.name, test.errs, prof.Nonconformances)
+		}
+		prof.Nonconformances = nil
+		if prof.String() != test.want.String() {
+			t.Fatalf("%s: expected profile\n%s\ngot\n%s", test.name, test.want, prof)
+		}
+		if pos, _ := r.Seek(0, io.SeekCurrent); pos != 0 {
+			t.Fatalf("%s: left the reader at %d", test.name, pos)
+		}
+	}
+
+	if _, err := ProfileStream(strings.NewReader("")); err != ErrNoPages {
+		t.Fatal("expected ErrNoPages, got", err)
+	}
+}
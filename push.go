@@ -0,0 +1,79 @@
+package ogg
+
+import (
+	"bytes"
+)
+
+// A PushDecoder decodes an ogg stream that's pushed to it with Write as it arrives,
+// rather than pulled from a Reader, for use with non-blocking I/O.
+// Pages are decoded as soon as they're complete, and collected by Pages.
+type PushDecoder struct {
+	d        *Decoder
+	r        bytes.Reader
+	buf      []byte
+	pages    []Page
+	resynced bool
+}
+
+// NewPushDecoder creates a PushDecoder.
+func NewPushDecoder() *PushDecoder {
+	pd := &PushDecoder{d: NewDecoder(nil)}
+	pd.d.CopyPackets = true
+	return pd
+}
+
+// Write buffers p, then decodes every page that's complete.
+// Having too little data for a page isn't an error; Write just waits for more.
+// If a page is corrupt, it's skipped, and Write returns the error Decode would,
+// after decoding the rest of p, so writing may continue.
+func (pd *PushDecoder) Write(p []byte) (int, error) {
+	pd.buf = append(pd.buf, p...)
+	rest, err := pd.decode(pd.buf)
+	pd.buf = append(pd.buf[:0], rest...)
+	return len(p), err
+}
+
+// decode decodes the complete pages in b, returning what remains and the first error.
+func (pd *PushDecoder) decode(b []byte) (rest []byte, err error) {
+	for {
+		i := bytes.Index(b, oggs)
+		if i < 0 {
+			keep := partialCapture(b)
+			if len(b) > keep {
+				pd.resynced = true
+			}
+			return b[len(b)-keep:], err
+		}
+		if i > 0 {
+			pd.resynced = true
+			b = b[i:]
+		}
+
+		size, ok := pageSize(b)
+		if !ok || len(b) < size {
+			return b, err
+		}
+
+		pd.r.Reset(b[:size])
+		pd.d.setReader(&pd.r)
+		p, n, perr := pd.d.Decode()
+		b = b[n:]
+		if perr != nil {
+			if err == nil {
+				err = perr
+			}
+			continue
+		}
+		p.Resynced = pd.resynced
+		pd.resynced = false
+		pd.pages = append(pd.pages, p)
+	}
+}
+
+// Pages returns the pages decoded since the last call to Pages.
+// Their packets are in memory of their own, so they may be retained.
+func (pd *PushDecoder) Pages() []Page {
+	pages := pd.pages
+	pd.pages = nil
+	return pages
+}
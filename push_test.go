@@ -0,0 +1,67 @@
+package ogg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPushDecoder(t *testing.T) {
+	var b bytes.Buffer
+	b.WriteString("junk")
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.Encode(1, [][]byte{[]byte("hello"), make([]byte, 1000)}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := e.EncodeEOS(2, [][]byte{[]byte("world")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	pd := NewPushDecoder()
+	var pages []Page
+	for _, c := range b.Bytes() {
+		n, err := pd.Write([]byte{c})
+		if n != 1 || err != nil {
+			t.Fatal("unexpected Write result:", n, err)
+		}
+		pages = append(pages, pd.Pages()...)
+	}
+
+	if len(pages) != 3 {
+		t.Fatal("expected 3 pages, got", len(pages))
+	}
+	if !pages[0].Resynced || pages[1].Resynced {
+		t.Fatal("expected only the first page to be resynced")
+	}
+	if string(pages[0].Packets[0]) != "head" || string(pages[1].Packets[0]) != "hello" ||
+		len(pages[1].Packets[1]) != 1000 || string(pages[2].Packets[0]) != "world" {
+		t.Fatal("unexpected packets")
+	}
+	if pages[2].Type != EOS || pages[2].Granule != 2 {
+		t.Fatalf("unexpected last page: %+v", pages[2])
+	}
+}
+
+func TestPushDecoderCorrupt(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.Encode(1, [][]byte{[]byte("bad")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := e.Encode(2, [][]byte{[]byte("good")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	b.Bytes()[headsz+1] = 'B'
+
+	pd := NewPushDecoder()
+	_, err := pd.Write(b.Bytes())
+	if _, ok := err.(ErrBadCrc); !ok {
+		t.Fatal("expected ErrBadCrc, got", err)
+	}
+	pages := pd.Pages()
+	if len(pages) != 1 || string(pages[0].Packets[0]) != "good" {
+		t.Fatal("expected the page after the corrupt one")
+	}
+}
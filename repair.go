@@ -0,0 +1,260 @@
+package ogg
+
+import (
+	"io"
+)
+
+// RepairGranules copies the ogg stream in r to w, replacing the granule positions
+// that can't be right with plausible ones, and recomputing the CRCs of the pages it changes.
+// Granule positions that are consistent with their neighbors are left untouched,
+// as are the pages' other fields and packets.
+//
+// Within each logical stream, the granule positions that are kept are the longest run,
+// in page order, that never decreases, the earliest of equally long runs.
+// For Opus, a position is also replaced if it's ahead of the previous kept one by more than
+// the duration of the packets between them, which catches spikes a decreasing run can't;
+// it may be behind, since the last page may trim the end of the stream.
+// A replaced position is then recomputed, for Opus, from the previous kept position
+// and the durations of the packets since. For other codecs, whose durations depend on state
+// RepairGranules doesn't decode, it's interpolated between the kept positions around it,
+// in proportion to the packets completed between them, or extrapolated from the average
+// granules per packet so far if no kept position follows; so it's only approximate,
+// and exact only for codecs whose packets are all the same duration.
+// Pages on which no packet ends are given the position -1, as the ogg format requires.
+//
+// RepairGranules holds the whole stream in memory, and writes nothing if r can't be decoded to its end.
+func RepairGranules(r io.Reader, w io.Writer) error {
+	d := NewDecoder(r)
+	d.KeepRawPage = true
+	d.CopyPackets = true
+
+	var pages []Page
+	var streams [][]*repairPage
+	var infos []*repairPage
+	current := make(map[uint32]int)
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		i, ok := current[p.Serial]
+		if !ok || p.Type&BOS != 0 {
+			i = len(streams)
+			current[p.Serial] = i
+			streams = append(streams, nil)
+		}
+		info := &repairPage{page: len(pages), granule: p.Granule, packets: len(p.Packets), dur: -1}
+		if p.Unfinished {
+			info.packets--
+		}
+		pages = append(pages, p)
+		streams[i] = append(streams[i], info)
+		infos = append(infos, info)
+	}
+
+	for _, s := range streams {
+		if first := pages[s[0].page]; first.Type&BOS != 0 && IdentifyCodec(first.Packets[0]) == CodecOpus {
+			opusPageDurations(pages, s)
+		}
+		repairStream(s)
+	}
+
+	for i, p := range pages {
+		if g := infos[i].granule; g != p.Granule {
+			byteOrder.PutUint64(p.Raw[6:14], uint64(g))
+			byteOrder.PutUint32(p.Raw[22:26], 0)
+			byteOrder.PutUint32(p.Raw[22:26], crc32(p.Raw))
+		}
+		if _, err := w.Write(p.Raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A repairPage is what RepairGranules knows about a page.
+type repairPage struct {
+	page    int   // the index of the page
+	granule int64 // its granule position, as repaired
+	packets int   // the number of packets ending on it
+	dur     int64 // the duration of those packets, in granules, or -1 if unknown
+	audio   bool  // whether any of those packets is other than a header
+}
+
+// opusPageDurations sets the durations of the pages of an Opus stream,
+// from the TOC bytes of the packets ending on each.
+// The first two packets, the OpusHead and OpusTags headers, have no duration.
+func opusPageDurations(pages []Page, s []*repairPage) {
+	var start []byte // the beginning of a packet continued on the next page
+	n := 0           // packets ended so far
+	for _, info := range s {
+		p := pages[info.page]
+		info.dur = 0
+		for i, pkt := range p.Packets {
+			if i == 0 && p.Type&COP != 0 {
+				if start == nil {
+					// a continuation of a packet never begun
+					info.dur = -1
+					break
+				}
+				pkt = start
+			}
+			if i == len(p.Packets)-1 && p.Unfinished {
+				start = pkt
+				break
+			}
+			start = nil
+			if n++; n <= 2 {
+				continue
+			}
+			samples, err := opusSamples(pkt)
+			if err != nil {
+				info.dur = -1
+				break
+			}
+			info.dur += int64(samples)
+			info.audio = true
+		}
+		if info.dur < 0 {
+			return
+		}
+	}
+}
+
+// repairStream repairs the granule positions of the pages of a logical stream.
+func repairStream(s []*repairPage) {
+	// Keep the longest non-decreasing run of positions.
+	var idx []int
+	for i, info := range s {
+		if info.granule >= 0 && info.packets > 0 {
+			idx = append(idx, i)
+		}
+	}
+	keep := make([]bool, len(s))
+	for _, i := range longestNonDecreasing(s, idx) {
+		keep[i] = true
+	}
+
+	// For known durations, drop positions that run ahead of them.
+	prev := -1
+	for i, info := range s {
+		if !keep[i] {
+			continue
+		}
+		if prev >= 0 && s[prev].audio {
+			if dur, ok := durationBetween(s, prev, i); ok && info.granule > s[prev].granule+dur {
+				keep[i] = false
+				continue
+			}
+		}
+		prev = i
+	}
+
+	// Recompute the rest, from the kept positions around them.
+	prev = -1
+	for i, info := range s {
+		if keep[i] {
+			prev = i
+			continue
+		}
+		if info.packets == 0 {
+			info.granule = -1
+			continue
+		}
+
+		base := int64(0)
+		if prev >= 0 {
+			base = s[prev].granule
+		}
+		if dur, ok := durationBetween(s, prev, i); ok {
+			info.granule = base + dur
+			continue
+		}
+
+		next := -1
+		for j := i + 1; j < len(s); j++ {
+			if keep[j] {
+				next = j
+				break
+			}
+		}
+		if next >= 0 {
+			info.granule = base + scale(s[next].granule-base, packetsBetween(s, prev, i), packetsBetween(s, prev, next))
+		} else if before := packetsBetween(s, -1, prev); before > 0 {
+			info.granule = base + scale(base, packetsBetween(s, prev, i), before)
+		} else {
+			info.granule = base
+		}
+	}
+}
+
+// longestNonDecreasing returns the longest subsequence of the indices idx into s
+// whose granule positions never decrease.
+// Of equally long runs, it prefers those of earlier pages, trusting the stream until it goes wrong.
+func longestNonDecreasing(s []*repairPage, idx []int) []int {
+	// Find the longest non-increasing run backward, which breaks ties that way.
+	// tails[k] is the index into idx ending the best run of length k+1 found so far.
+	var tails []int
+	prev := make([]int, len(idx))
+	for j := len(idx) - 1; j >= 0; j-- {
+		g := s[idx[j]].granule
+		lo, hi := 0, len(tails)
+		for lo < hi {
+			mid := (lo + hi) / 2
+			if s[idx[tails[mid]]].granule >= g {
+				lo = mid + 1
+			} else {
+				hi = mid
+			}
+		}
+		prev[j] = -1
+		if lo > 0 {
+			prev[j] = tails[lo-1]
+		}
+		if lo == len(tails) {
+			tails = append(tails, j)
+		} else {
+			tails[lo] = j
+		}
+	}
+
+	run := make([]int, 0, len(tails))
+	if len(tails) > 0 {
+		for j := tails[len(tails)-1]; j >= 0; j = prev[j] {
+			run = append(run, idx[j])
+		}
+	}
+	return run
+}
+
+// durationBetween returns the duration of the pages of s after from, or from the start if from is -1,
+// up to and including to, if it's known.
+func durationBetween(s []*repairPage, from, to int) (int64, bool) {
+	var dur int64
+	for i := from + 1; i <= to; i++ {
+		if s[i].dur < 0 {
+			return 0, false
+		}
+		dur += s[i].dur
+	}
+	return dur, true
+}
+
+// packetsBetween returns the number of packets ending on the pages of s after from,
+// or from the start if from is -1, up to and including to.
+func packetsBetween(s []*repairPage, from, to int) int64 {
+	var n int64
+	for i := from + 1; i <= to; i++ {
+		n += int64(s[i].packets)
+	}
+	return n
+}
+
+// scale returns x*num/den without overflowing for large x.
+func scale(x, num, den int64) int64 {
+	return x/den*num + x%den*num/den
+}
@@ -0,0 +1,98 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// setGranule sets the granule position of the page at index i of the stream b.
+func setGranule(t *testing.T, b []byte, i int, granule int64) {
+	t.Helper()
+	off := 0
+	for ; i > 0; i-- {
+		size, ok := pageSize(b[off:])
+		if !ok {
+			t.Fatal("no page at offset", off)
+		}
+		off += size
+	}
+	byteOrder.PutUint64(b[off+6:], uint64(granule))
+	fixCrc(b[off:])
+}
+
+func granules(t *testing.T, b []byte) []int64 {
+	t.Helper()
+	var g []int64
+	d := NewDecoder(bytes.NewReader(b))
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			return g
+		}
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		g = append(g, p.Granule)
+	}
+}
+
+func TestRepairGranules(t *testing.T) {
+	var packets [][]byte
+	for i := 0; i < 8; i++ {
+		packets = append(packets, []byte{0x08, byte(i)})
+	}
+	opus := opusFile(t, 312, opusTagsPacket("test"), packets...)
+
+	var mystery bytes.Buffer
+	e := NewEncoder(3, &mystery)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("mystery")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	for i := int64(1); i <= 6; i++ {
+		var err error
+		if i == 3 {
+			// two packets on this page
+			err = e.Encode(i*100+100, [][]byte{[]byte("a"), []byte("b")})
+		} else if i > 3 {
+			err = e.Encode(i*100+100, [][]byte{[]byte("a")})
+		} else {
+			err = e.Encode(i*100, [][]byte{[]byte("a")})
+		}
+		if err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		corrupt map[int]int64
+	}{
+		{"opus intact", opus, nil},
+		{"opus decreasing", opus, map[int]int64{4: 5}},
+		{"opus spike", opus, map[int]int64{5: 1 << 40}},
+		{"opus spike at end", opus, map[int]int64{9: 1 << 40}},
+		{"opus negative", opus, map[int]int64{3: -5, 6: 0}},
+		{"interpolated", mystery.Bytes(), map[int]int64{2: 7000, 3: 9000}},
+		{"interpolated decreasing", mystery.Bytes(), map[int]int64{3: 150}},
+	}
+	for _, test := range tests {
+		data := append([]byte(nil), test.data...)
+		for i, g := range test.corrupt {
+			setGranule(t, data, i, g)
+		}
+
+		var out bytes.Buffer
+		if err := RepairGranules(bytes.NewReader(data), &out); err != nil {
+			t.Fatalf("%s: unexpected RepairGranules error: %v", test.name, err)
+		}
+		if !bytes.Equal(out.Bytes(), test.data) {
+			t.Fatalf("%s: expected granules %v, got %v", test.name, granules(t, test.data), granules(t, out.Bytes()))
+		}
+	}
+
+	if err := RepairGranules(bytes.NewReader(opus[:len(opus)-1]), io.Discard); err != io.ErrUnexpectedEOF {
+		t.Fatal("expected ErrUnexpectedEOF, got", err)
+	}
+}
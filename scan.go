@@ -0,0 +1,30 @@
+package ogg
+
+import "io"
+
+// ScanPacketLens reads the pages of r, calling fn with the serial number, granule position,
+// and lengths of the packets of each, without reading their payloads into memory,
+// for structural scans like counting packets or building an index.
+// As with a Page's Packets, the lengths include those of the pieces of packets
+// continued from the previous page or on the next.
+// The lens slice is reused for each page, so fn must copy it to retain it.
+//
+// The pages' CRCs aren't checked, since their payloads are skipped,
+// nor are the pages checked for conformance.
+// ScanPacketLens stops at the first error, other than io.EOF at the end of r, or the first fn returns.
+func ScanPacketLens(r io.Reader, fn func(serial uint32, granule int64, lens []int) error) error {
+	d := NewDecoder(r)
+	for {
+		p, _, err := d.SkipPage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// SkipPage leaves the lengths it read from the segment table
+		if err := fn(p.Serial, p.Granule, d.peekLens); err != nil {
+			return err
+		}
+	}
+}
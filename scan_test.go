@@ -0,0 +1,83 @@
+package ogg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestScanPacketLens(t *testing.T) {
+	var b bytes.Buffer
+	rnd := rand.New(rand.NewSource(1))
+	encoders := []*Encoder{NewEncoder(1, &b), NewEncoder(2, &b)}
+	for i := 0; i < 100; i++ {
+		var packets [][]byte
+		for j := rnd.Intn(4); j >= 0; j-- {
+			packets = append(packets, make([]byte, rnd.Intn(3*mss)))
+		}
+		if err := encoders[i%2].Encode(int64(i), packets); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+	}
+	// a packet continued over several pages
+	if err := encoders[0].Encode(100, [][]byte{make([]byte, 200000)}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+
+	type scanned struct {
+		serial  uint32
+		granule int64
+		lens    []int
+	}
+	var got []scanned
+	err := ScanPacketLens(bytes.NewReader(b.Bytes()), func(serial uint32, granule int64, lens []int) error {
+		got = append(got, scanned{serial, granule, append([]int(nil), lens...)})
+		return nil
+	})
+	if err != nil {
+		t.Fatal("unexpected ScanPacketLens error:", err)
+	}
+
+	d := NewDecoder(bytes.NewReader(b.Bytes()))
+	for i := 0; ; i++ {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			if i != len(got) {
+				t.Fatalf("expected %d pages, scanned %d", i, len(got))
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		if i >= len(got) {
+			t.Fatal("scanned too few pages:", len(got))
+		}
+		s := got[i]
+		if s.serial != p.Serial || s.granule != p.Granule || len(s.lens) != len(p.Packets) {
+			t.Fatalf("page %d: scanned serial %d, granule %d, %d packets; decoded %d, %d, %d",
+				i, s.serial, s.granule, len(s.lens), p.Serial, p.Granule, len(p.Packets))
+		}
+		for j, pkt := range p.Packets {
+			if s.lens[j] != len(pkt) {
+				t.Fatalf("page %d, packet %d: scanned length %d, decoded %d", i, j, s.lens[j], len(pkt))
+			}
+		}
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = ScanPacketLens(bytes.NewReader(b.Bytes()), func(uint32, int64, []int) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Fatalf("expected fn's error after one call, got %v after %d", err, calls)
+	}
+
+	if err := ScanPacketLens(bytes.NewReader(b.Bytes()[:b.Len()-1]), func(uint32, int64, []int) error { return nil }); err != io.ErrUnexpectedEOF {
+		t.Fatal("expected io.ErrUnexpectedEOF for a truncated stream, got", err)
+	}
+}
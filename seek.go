@@ -0,0 +1,247 @@
+package ogg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// ErrNoGranule is the error used by LastGranule when a logical stream has no page with a granule position.
+var ErrNoGranule = errors.New("no granule position found")
+
+// ErrTooShort is the error used by EstimatePackets when a logical stream
+// has too few granule positions to estimate from.
+var ErrTooShort = errors.New("stream too short to estimate")
+
+// corrupt reports whether err is one Decode returns for a corrupt page,
+// after which decoding may continue.
+func corrupt(err error) bool {
+	switch err.(type) {
+	case ErrBadCrc, ErrPageTooLarge:
+		return true
+	}
+	return err == ErrBadSegs
+}
+
+// LastGranule returns the granule position of the last page of the given logical stream
+// in rs that has one, reading as little as it can from the end of rs.
+// rs is returned to its original position afterwards.
+func LastGranule(rs io.ReadSeeker, serial uint32) (granule int64, err error) {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1, err
+	}
+	defer func() {
+		if _, serr := rs.Seek(start, io.SeekStart); err == nil {
+			err = serr
+		}
+	}()
+
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1, err
+	}
+
+	// Scan ever larger windows at the end of rs until one holds a granule position.
+	for window := int64(2 * maxPageSize); ; window *= 2 {
+		from := end - window
+		if from < 0 {
+			from = 0
+		}
+		if _, err := rs.Seek(from, io.SeekStart); err != nil {
+			return -1, err
+		}
+
+		granule := int64(-1)
+		d := NewDecoder(io.LimitReader(rs, end-from))
+		for {
+			p, _, err := d.Decode()
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				if corrupt(err) {
+					continue
+				}
+				return -1, err
+			}
+			if p.Serial == serial && p.Granule != -1 {
+				granule = p.Granule
+			}
+		}
+
+		if granule != -1 {
+			return granule, nil
+		}
+		if from == 0 {
+			return -1, ErrNoGranule
+		}
+	}
+}
+
+// estimatePages is the number of pages EstimatePackets samples.
+const estimatePages = 64
+
+// EstimatePackets estimates the number of packets in the given logical stream in rs,
+// for uses like progress reporting where exactness isn't required.
+// It samples the pages following rs's position for the average granule advance per packet,
+// then extrapolates from there to the LastGranule.
+// The estimate assumes the stream's packets have roughly equal durations,
+// but doesn't depend on its codec.
+// rs is returned to its original position afterwards.
+//
+// If the sampled pages don't hold two distinct granule positions, the error is ErrTooShort.
+func EstimatePackets(rs io.ReadSeeker, serial uint32) (n int, err error) {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if _, serr := rs.Seek(start, io.SeekStart); err == nil {
+			err = serr
+		}
+	}()
+
+	last, err := LastGranule(rs, serial)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		packets    int   // packets completed so far
+		firstCount int   // packets completed up to the first granule position
+		first      int64 = -1
+		count      int   // packets completed up to the latest granule position
+		granule    int64 = -1
+	)
+	d := NewDecoder(rs)
+	for pages := 0; pages < estimatePages; {
+		p, _, err := d.Decode()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			if corrupt(err) {
+				continue
+			}
+			return 0, err
+		}
+		if p.Serial != serial {
+			continue
+		}
+		pages++
+
+		packets += len(p.Packets)
+		if d.unfinished {
+			packets--
+		}
+		if p.Granule == -1 {
+			continue
+		}
+		if first == -1 {
+			first, firstCount = p.Granule, packets
+		}
+		granule, count = p.Granule, packets
+	}
+
+	if granule <= first || count == firstCount {
+		return 0, ErrTooShort
+	}
+
+	perPacket := float64(granule-first) / float64(count-firstCount)
+	return firstCount + int(float64(last-first)/perPacket+0.5), nil
+}
+
+// ErrNotSeekable is the error used when a Decoder's Reader must be an io.ReadSeeker but isn't.
+var ErrNotSeekable = errors.New("reader is not seekable")
+
+// ErrNoPrevPage is the error used by PrevPage when no page is found before the current position.
+var ErrNoPrevPage = errors.New("no previous page found")
+
+// PrevPage returns the page preceding the current position of d's Reader, which must be an io.ReadSeeker,
+// and repositions the Reader at the start of that page,
+// so that calling PrevPage repeatedly iterates over the pages backward
+// and calling Decode returns the same page again.
+//
+// Since ogg isn't designed to be read backward, PrevPage scans back for the capture pattern,
+// taking the last candidate whose CRC is valid and that ends at the current position,
+// or at a following page.
+// It only searches within the maximum page size, 65307 bytes, before the current position,
+// so the position should be at the end of a page; if no page is found,
+// the error is ErrNoPrevPage and the position is unchanged.
+//
+// PrevPage discards any partly reassembled packets, and isn't subject to d.Conformance.
+// Afterwards, d.Offset is the absolute position of the page.
+func (d *Decoder) PrevPage() (Page, error) {
+	rs, ok := d.r.(io.ReadSeeker)
+	if !ok {
+		return Page{}, ErrNotSeekable
+	}
+
+	pos, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return Page{}, err
+	}
+	if d.peeked {
+		// the current page is the one Peek returned
+		pos -= int64(headsz) + int64(d.peekHeader.Nsegs)
+		d.peeked = false
+	}
+	from := pos - maxPageSize
+	if from < 0 {
+		from = 0
+	}
+	if _, err := rs.Seek(from, io.SeekStart); err != nil {
+		return Page{}, err
+	}
+	window := d.buf[:pos-from]
+	if _, err := io.ReadFull(rs, window); err != nil {
+		return Page{}, err
+	}
+
+	start := int64(-1)
+	for i := bytes.LastIndex(window, oggs); i >= 0; i = bytes.LastIndex(window[:i], oggs) {
+		if validPage(window[i:]) {
+			start = from + int64(i)
+			break
+		}
+	}
+	if start < 0 {
+		if _, err := rs.Seek(pos, io.SeekStart); err != nil {
+			return Page{}, err
+		}
+		return Page{}, ErrNoPrevPage
+	}
+
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return Page{}, err
+	}
+	d.pending = nil
+	d.held = nil
+
+	p, _, err := d.decode(false)
+	if err != nil {
+		return Page{}, err
+	}
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return Page{}, err
+	}
+	d.offset = start
+	return p, nil
+}
+
+// validPage reports whether b starts with a whole page with a valid CRC,
+// that ends at the end of b or at another capture pattern.
+func validPage(b []byte) bool {
+	size, ok := pageSize(b)
+	if !ok || len(b) < size || len(b) > size && !bytes.HasPrefix(b[size:], oggs) {
+		return false
+	}
+
+	var crc [4]byte
+	copy(crc[:], b[22:26])
+	copy(b[22:26], []byte{0, 0, 0, 0})
+	valid := crc32(b[:size]) == byteOrder.Uint32(crc[:])
+	copy(b[22:26], crc[:])
+	return valid
+}
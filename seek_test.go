@@ -0,0 +1,147 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestLastGranule(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	o := NewEncoder(2, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := o.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	for i := int64(1); i <= 200; i++ {
+		if err := e.Encode(i*10, [][]byte{make([]byte, 1000)}); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+	}
+	if err := o.Encode(7, [][]byte{[]byte("x")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := e.Encode(-1, nil); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+
+	r := bytes.NewReader(b.Bytes())
+	r.Seek(10, io.SeekStart)
+	g, err := LastGranule(r, 1)
+	if err != nil {
+		t.Fatal("unexpected LastGranule error:", err)
+	}
+	if g != 2000 {
+		t.Fatal("expected granule 2000, got", g)
+	}
+	if pos, _ := r.Seek(0, io.SeekCurrent); pos != 10 {
+		t.Fatal("expected position 10 to be restored, got", pos)
+	}
+
+	g, err = LastGranule(r, 2)
+	if err != nil {
+		t.Fatal("unexpected LastGranule error:", err)
+	}
+	if g != 7 {
+		t.Fatal("expected granule 7, got", g)
+	}
+
+	_, err = LastGranule(r, 3)
+	if err != ErrNoGranule {
+		t.Fatal("expected ErrNoGranule, got", err)
+	}
+}
+
+func TestEstimatePackets(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	for i := int64(1); i <= 500; i++ {
+		if err := e.Encode(i*1920, [][]byte{[]byte("ab"), []byte("cd")}); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+	}
+
+	n, err := EstimatePackets(bytes.NewReader(b.Bytes()), 1)
+	if err != nil {
+		t.Fatal("unexpected EstimatePackets error:", err)
+	}
+	if n != 1001 {
+		t.Fatal("expected 1001 packets, got", n)
+	}
+}
+
+func TestEstimatePacketsShort(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+
+	_, err := EstimatePackets(bytes.NewReader(b.Bytes()), 1)
+	if err != ErrTooShort {
+		t.Fatal("expected ErrTooShort, got", err)
+	}
+}
+
+func TestPrevPage(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	for i := int64(1); i <= 3; i++ {
+		if err := e.Encode(i, [][]byte{bytes.Repeat([]byte{'O', 'g', 'g', 'S'}, 10000)}); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+	}
+	if err := e.EncodeEOS(4, nil); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	r := bytes.NewReader(b.Bytes())
+	r.Seek(0, io.SeekEnd)
+	d := NewDecoder(r)
+	for i := int64(4); i >= 0; i-- {
+		p, err := d.PrevPage()
+		if err != nil {
+			t.Fatal("unexpected PrevPage error:", err)
+		}
+		if p.Granule != i {
+			t.Fatalf("expected granule %d, got %d", i, p.Granule)
+		}
+	}
+	if _, err := d.PrevPage(); err != ErrNoPrevPage {
+		t.Fatal("expected ErrNoPrevPage, got", err)
+	}
+
+	// Decode continues from the page PrevPage found.
+	r.Seek(0, io.SeekEnd)
+	d.PrevPage()
+	d.PrevPage()
+	p, _, err := d.Decode()
+	if err != nil {
+		t.Fatal("unexpected Decode error:", err)
+	}
+	if p.Granule != 3 {
+		t.Fatal("expected granule 3, got", p.Granule)
+	}
+
+	// After Peek, the previous page is the one before the peeked page.
+	if p, _, err = d.Peek(); err != nil || p.Granule != 4 {
+		t.Fatalf("unexpected Peek result: %+v, %v", p, err)
+	}
+	if p, err = d.PrevPage(); err != nil || p.Granule != 3 {
+		t.Fatalf("unexpected PrevPage result: %+v, %v", p, err)
+	}
+
+	d = NewDecoder(struct{ io.Reader }{r})
+	if _, err := d.PrevPage(); err != ErrNotSeekable {
+		t.Fatal("expected ErrNotSeekable, got", err)
+	}
+}
@@ -0,0 +1,129 @@
+package ogg
+
+import (
+	"io"
+	"time"
+)
+
+// SegmentOpus splits the Opus stream in r into segments of about the given duration,
+// each an independently decodable Ogg Opus stream, as for HLS or DASH.
+// The segments are written to the Writers returned by create, which is called with
+// each segment's index in turn, and each Writer is closed after its segment's EOS page.
+//
+// Each segment starts with copies of the OpusHead and OpusTags headers,
+// and its granule positions are rebased to start from 0.
+// A segment ends at the first packet boundary at or after the duration,
+// so segments are only as precise as the packets' durations.
+// The first segment keeps the stream's pre-skip; later segments have a pre-skip of 0,
+// since their packets follow on from the previous segment's,
+// but a decoder starting on them starts cold.
+// A truncated stream is an error, io.ErrUnexpectedEOF, rather than having its last segment
+// end where the stream was cut.
+func SegmentOpus(r io.Reader, duration time.Duration, create func(i int) (io.WriteCloser, error)) error {
+	o, err := NewOpusReader(r)
+	if err != nil {
+		return err
+	}
+	o.g.d.CopyPackets = true
+
+	s := segmenter{o: o, create: create, target: int64(duration) * 48000 / int64(time.Second)}
+	for {
+		pkt, err := o.g.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.add(pkt); err != nil {
+			return err
+		}
+		if pkt.EOS {
+			return nil
+		}
+	}
+	if s.e == nil {
+		return nil
+	}
+	return s.end(s.samples - s.base)
+}
+
+// segmenter tracks the state of SegmentOpus.
+type segmenter struct {
+	o      *OpusReader
+	create func(i int) (io.WriteCloser, error)
+	target int64 // samples per segment
+
+	i       int
+	w       io.WriteCloser
+	e       *Encoder
+	group   [][]byte
+	base    int64 // samples preceding the current segment
+	samples int64 // samples up to the last packet
+}
+
+// add adds an audio packet to the current segment, starting or ending segments as needed.
+func (s *segmenter) add(pkt Packet) error {
+	if s.e == nil {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+
+	n, err := opusSamples(pkt.Data)
+	if err != nil {
+		return err
+	}
+	s.samples += int64(n)
+	s.group = append(s.group, pkt.Data)
+
+	switch {
+	case pkt.EOS:
+		// The source's final granule position may trim the end.
+		granule := s.samples - s.base
+		if pkt.Granule != -1 {
+			granule = pkt.Granule - s.base
+		}
+		return s.end(granule)
+	case s.samples-s.base >= s.target:
+		return s.end(s.samples - s.base)
+	case pkt.Granule != -1:
+		err := s.e.Encode(s.samples-s.base, s.group)
+		s.group = nil
+		return err
+	}
+	return nil
+}
+
+// start starts a segment by writing its headers.
+func (s *segmenter) start() error {
+	w, err := s.create(s.i)
+	if err != nil {
+		return err
+	}
+	s.w = w
+	s.e = NewEncoder(s.o.g.Serial, w)
+
+	head := s.o.headPacket
+	if s.i > 0 {
+		head = append([]byte(nil), head...)
+		byteOrder.PutUint16(head[10:12], 0)
+	}
+	if err := s.e.EncodeBOS(0, [][]byte{head}); err != nil {
+		return err
+	}
+	return s.e.Encode(0, [][]byte{s.o.tagsPacket})
+}
+
+// end ends the current segment with an EOS page at the given granule position.
+func (s *segmenter) end(granule int64) error {
+	err := s.e.EncodeEOS(granule, s.group)
+	if cerr := s.w.Close(); err == nil {
+		err = cerr
+	}
+	s.group = nil
+	s.e = nil
+	s.base = s.samples
+	s.i++
+	return err
+}
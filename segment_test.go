@@ -0,0 +1,99 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestSegmentOpus(t *testing.T) {
+	var packets [][]byte
+	for i := 0; i < 10; i++ {
+		packets = append(packets, []byte{0x08, byte(i)})
+	}
+	f := opusFile(t, 312, opusTagsPacket("test", "TITLE=x"), packets...)
+
+	var segments []*closeBuffer
+	err := SegmentOpus(bytes.NewReader(f), 60*time.Millisecond, func(i int) (io.WriteCloser, error) {
+		if i != len(segments) {
+			t.Fatalf("expected segment %d, got %d", len(segments), i)
+		}
+		b := &closeBuffer{}
+		segments = append(segments, b)
+		return b, nil
+	})
+	if err != nil {
+		t.Fatal("unexpected SegmentOpus error:", err)
+	}
+	if len(segments) != 4 {
+		t.Fatal("expected 4 segments, got", len(segments))
+	}
+
+	next := byte(0)
+	for i, seg := range segments {
+		if !seg.closed {
+			t.Fatalf("segment %d not closed", i)
+		}
+		if err := VerifyOpusGranules(bytes.NewReader(seg.Bytes())); err != nil {
+			t.Fatalf("segment %d: unexpected VerifyOpusGranules error: %v", i, err)
+		}
+
+		o, err := NewOpusReader(bytes.NewReader(seg.Bytes()))
+		if err != nil {
+			t.Fatalf("segment %d: unexpected NewOpusReader error: %v", i, err)
+		}
+		want := uint16(0)
+		if i == 0 {
+			want = 312
+		}
+		if o.Head.PreSkip != want {
+			t.Fatalf("segment %d: expected pre-skip %d, got %d", i, want, o.Head.PreSkip)
+		}
+		if o.Tags["TITLE"][0] != "x" {
+			t.Fatalf("segment %d: tags not copied", i)
+		}
+		for {
+			data, _, err := o.ReadPacket()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("segment %d: unexpected ReadPacket error: %v", i, err)
+			}
+			if data[1] != next {
+				t.Fatalf("segment %d: expected packet %d, got %d", i, next, data[1])
+			}
+			next++
+		}
+	}
+	if next != 10 {
+		t.Fatal("expected 10 packets, got", next)
+	}
+}
+
+func TestSegmentOpusTruncated(t *testing.T) {
+	f := opusFile(t, 0, opusTagsPacket("test"), []byte{0x08, 'a'}, []byte{0x08, 'b'}, []byte{0x08, 'c'})
+
+	var segments int
+	err := SegmentOpus(bytes.NewReader(f[:len(f)-1]), time.Second, func(i int) (io.WriteCloser, error) {
+		segments++
+		return &closeBuffer{}, nil
+	})
+	if err != io.ErrUnexpectedEOF {
+		t.Fatal("expected io.ErrUnexpectedEOF, got", err)
+	}
+	if segments != 1 {
+		t.Fatal("expected 1 segment, got", segments)
+	}
+}
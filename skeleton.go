@@ -0,0 +1,106 @@
+package ogg
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+var (
+	fisheadMagic = []byte("fishead\x00")
+	fisboneMagic = []byte("fisbone\x00")
+)
+
+// ErrBadSkeleton is the error used when an Ogg Skeleton packet is malformed.
+var ErrBadSkeleton = errors.New("malformed skeleton packet")
+
+// Fishead is the header of an Ogg Skeleton stream, which describes the whole physical stream.
+// Times are given as rationals, in seconds.
+type Fishead struct {
+	VersionMajor, VersionMinor uint16
+	// PresentationNum/PresentationDen is the time at which to start presenting the streams.
+	PresentationNum, PresentationDen int64
+	// BaseNum/BaseDen is the time corresponding to granule position 0 of the streams.
+	BaseNum, BaseDen int64
+	// UTC is the wall-clock time of the base time, in ISO 8601 format, if known.
+	UTC string
+	// SegmentLength and ContentOffset, present from version 4, are the length of the
+	// physical stream and the offset of its first non-header page, in bytes.
+	SegmentLength, ContentOffset uint64
+}
+
+// ParseFishead parses a Skeleton fishead packet, versions 3 and 4.
+func ParseFishead(pkt []byte) (Fishead, error) {
+	if len(pkt) < 64 || !bytes.HasPrefix(pkt, fisheadMagic) {
+		return Fishead{}, ErrBadSkeleton
+	}
+
+	h := Fishead{
+		VersionMajor:    byteOrder.Uint16(pkt[8:]),
+		VersionMinor:    byteOrder.Uint16(pkt[10:]),
+		PresentationNum: int64(byteOrder.Uint64(pkt[12:])),
+		PresentationDen: int64(byteOrder.Uint64(pkt[20:])),
+		BaseNum:         int64(byteOrder.Uint64(pkt[28:])),
+		BaseDen:         int64(byteOrder.Uint64(pkt[36:])),
+		UTC:             string(bytes.TrimRight(pkt[44:64], "\x00")),
+	}
+	if h.VersionMajor >= 4 {
+		if len(pkt) < 80 {
+			return Fishead{}, ErrBadSkeleton
+		}
+		h.SegmentLength = byteOrder.Uint64(pkt[64:])
+		h.ContentOffset = byteOrder.Uint64(pkt[72:])
+	}
+	return h, nil
+}
+
+// Fisbone describes one logical stream of the physical stream that a Skeleton stream is part of.
+type Fisbone struct {
+	// Serial is the serial number of the logical stream described.
+	Serial uint32
+	// HeaderPackets is the number of header packets of the logical stream.
+	HeaderPackets uint32
+	// GranuleRateNum/GranuleRateDen is the number of granules per second.
+	GranuleRateNum, GranuleRateDen int64
+	// BaseGranule is the granule position corresponding to the base time of the fishead.
+	BaseGranule int64
+	// Preroll is the number of packets to decode before a seek target for correct output.
+	Preroll uint32
+	// GranuleShift is the number of low bits of a granule position that don't count granules,
+	// as with the keyframe offsets of Theora.
+	GranuleShift byte
+	// Headers are the message header fields, such as Content-Type.
+	Headers map[string]string
+}
+
+// ParseFisbone parses a Skeleton fisbone packet.
+func ParseFisbone(pkt []byte) (Fisbone, error) {
+	if len(pkt) < 52 || !bytes.HasPrefix(pkt, fisboneMagic) {
+		return Fisbone{}, ErrBadSkeleton
+	}
+
+	// The offset of the message header fields is from the offset field itself.
+	fields := 8 + int(byteOrder.Uint32(pkt[8:]))
+	if fields < 52 || fields > len(pkt) {
+		return Fisbone{}, ErrBadSkeleton
+	}
+
+	b := Fisbone{
+		Serial:         byteOrder.Uint32(pkt[12:]),
+		HeaderPackets:  byteOrder.Uint32(pkt[16:]),
+		GranuleRateNum: int64(byteOrder.Uint64(pkt[20:])),
+		GranuleRateDen: int64(byteOrder.Uint64(pkt[28:])),
+		BaseGranule:    int64(byteOrder.Uint64(pkt[36:])),
+		Preroll:        byteOrder.Uint32(pkt[44:]),
+		GranuleShift:   pkt[48],
+		Headers:        make(map[string]string),
+	}
+	for _, line := range strings.Split(string(pkt[fields:]), "\r\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		b.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return b, nil
+}
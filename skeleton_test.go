@@ -0,0 +1,77 @@
+package ogg
+
+import (
+	"testing"
+)
+
+func TestParseFishead(t *testing.T) {
+	pkt := make([]byte, 80)
+	copy(pkt, "fishead\x00")
+	byteOrder.PutUint16(pkt[8:], 4)
+	byteOrder.PutUint64(pkt[12:], 1)
+	byteOrder.PutUint64(pkt[20:], 1000)
+	byteOrder.PutUint64(pkt[36:], 1000)
+	copy(pkt[44:], "20200101T000000.000Z")
+	byteOrder.PutUint64(pkt[64:], 12345)
+	byteOrder.PutUint64(pkt[72:], 678)
+
+	h, err := ParseFishead(pkt)
+	if err != nil {
+		t.Fatal("unexpected ParseFishead error:", err)
+	}
+	want := Fishead{4, 0, 1, 1000, 0, 1000, "20200101T000000.000Z", 12345, 678}
+	if h != want {
+		t.Fatalf("expected %+v, got %+v", want, h)
+	}
+
+	byteOrder.PutUint16(pkt[8:], 3)
+	h, err = ParseFishead(pkt[:64])
+	if err != nil {
+		t.Fatal("unexpected ParseFishead error:", err)
+	}
+	if h.VersionMajor != 3 || h.SegmentLength != 0 {
+		t.Fatalf("unexpected version 3 header: %+v", h)
+	}
+
+	byteOrder.PutUint16(pkt[8:], 4)
+	if _, err := ParseFishead(pkt[:64]); err != ErrBadSkeleton {
+		t.Fatal("expected ErrBadSkeleton, got", err)
+	}
+	if _, err := ParseFishead([]byte("fisbone\x00")); err != ErrBadSkeleton {
+		t.Fatal("expected ErrBadSkeleton, got", err)
+	}
+}
+
+func TestParseFisbone(t *testing.T) {
+	pkt := make([]byte, 52)
+	copy(pkt, "fisbone\x00")
+	byteOrder.PutUint32(pkt[8:], 44)
+	byteOrder.PutUint32(pkt[12:], 7)
+	byteOrder.PutUint32(pkt[16:], 2)
+	byteOrder.PutUint64(pkt[20:], 48000)
+	byteOrder.PutUint64(pkt[28:], 1)
+	byteOrder.PutUint64(pkt[36:], 312)
+	byteOrder.PutUint32(pkt[44:], 2)
+	pkt[48] = 0
+	pkt = append(pkt, "Content-Type: audio/opus\r\nRole: audio/main\r\n"...)
+
+	b, err := ParseFisbone(pkt)
+	if err != nil {
+		t.Fatal("unexpected ParseFisbone error:", err)
+	}
+	if b.Serial != 7 || b.HeaderPackets != 2 || b.GranuleRateNum != 48000 || b.GranuleRateDen != 1 ||
+		b.BaseGranule != 312 || b.Preroll != 2 || b.GranuleShift != 0 {
+		t.Fatalf("unexpected fisbone: %+v", b)
+	}
+	if b.Headers["Content-Type"] != "audio/opus" || b.Headers["Role"] != "audio/main" {
+		t.Fatalf("unexpected headers: %v", b.Headers)
+	}
+
+	byteOrder.PutUint32(pkt[8:], 1000)
+	if _, err := ParseFisbone(pkt); err != ErrBadSkeleton {
+		t.Fatal("expected ErrBadSkeleton, got", err)
+	}
+	if _, err := ParseFisbone(pkt[:51]); err != ErrBadSkeleton {
+		t.Fatal("expected ErrBadSkeleton, got", err)
+	}
+}
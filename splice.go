@@ -0,0 +1,158 @@
+package ogg
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrOpusMismatch is the error used by SpliceOpus when its streams' channel counts differ.
+var ErrOpusMismatch = errors.New("opus streams have different channel counts")
+
+// SpliceOpus writes to w a single Ogg Opus stream that plays stream a followed by stream b.
+// The Opus stream of a is copied with its serial, minus its EOS flag, and b's audio packets
+// continue it, with their granule positions rebased to follow a's samples.
+// The headers of b are dropped, as are its leading packets that fall entirely within its pre-skip;
+// the remainder of its pre-skip, which can't be cut without re-encoding, is played.
+// Likewise, any end trim of a is played, since a can't end early in the middle of the stream.
+// Both streams are assumed to start at granule position 0, as encoders conventionally do.
+// A truncated stream is an error, io.ErrUnexpectedEOF, rather than being spliced as far as it goes.
+//
+// Only the first Opus stream of each reader is used.
+func SpliceOpus(a, b io.Reader, w io.Writer) error {
+	d := NewDecoder(a)
+	d.CopyPackets = true
+
+	var head OpusHead
+	var serial uint32
+	for {
+		pkt, err := d.DecodePacket()
+		if err == io.EOF {
+			return ErrNoOpusStream
+		}
+		if err != nil {
+			return err
+		}
+		if !pkt.BOS {
+			return ErrNoOpusStream
+		}
+		if IdentifyCodec(pkt.Data) != CodecOpus {
+			continue
+		}
+
+		head, err = ParseOpusHead(pkt.Data)
+		if err != nil {
+			return err
+		}
+		serial = pkt.Serial
+		e := NewEncoder(serial, w)
+		if err := e.EncodeBOS(0, [][]byte{pkt.Data}); err != nil {
+			return err
+		}
+		return spliceOpus(d, e, head, b)
+	}
+}
+
+// spliceOpus copies the rest of the Opus stream of a's Decoder d to e, then continues it with b.
+func spliceOpus(d *Decoder, e *Encoder, head OpusHead, b io.Reader) error {
+	var group [][]byte
+	flush := func(granule int64) error {
+		err := e.Encode(granule, group)
+		group = nil
+		return err
+	}
+
+	// the comment header, then the audio packets of a
+	var samples int64
+	tags := true
+	for {
+		pkt, err := d.DecodePacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if pkt.Serial != e.serial {
+			continue
+		}
+
+		if tags {
+			if err := e.Encode(0, [][]byte{pkt.Data}); err != nil {
+				return err
+			}
+			tags = false
+			if pkt.EOS {
+				break
+			}
+			continue
+		}
+
+		n, err := opusSamples(pkt.Data)
+		if err != nil {
+			return err
+		}
+		samples += int64(n)
+		group = append(group, pkt.Data)
+		if pkt.EOS {
+			// a's end trim is played, so its last page ends at its samples, as b is rebased onto them.
+			break
+		}
+		if pkt.Granule != -1 {
+			if err := flush(pkt.Granule); err != nil {
+				return err
+			}
+		}
+	}
+	if len(group) > 0 {
+		if err := flush(samples); err != nil {
+			return err
+		}
+	}
+
+	o, err := NewOpusReader(b)
+	if err != nil {
+		return err
+	}
+	if o.Head.Channels != head.Channels {
+		return ErrOpusMismatch
+	}
+	o.g.d.CopyPackets = true
+
+	// the audio packets of b, rebased onto the end of a
+	var dropped, kept int64
+	granule := samples
+	for {
+		pkt, err := o.g.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		n, err := opusSamples(pkt.Data)
+		if err != nil {
+			return err
+		}
+		if kept == 0 && dropped+int64(n) <= int64(o.Head.PreSkip) {
+			dropped += int64(n)
+			continue
+		}
+		kept += int64(n)
+
+		group = append(group, pkt.Data)
+		if pkt.Granule == -1 {
+			// If b ends here, its last page is lost; count its samples instead.
+			granule = samples + kept
+			continue
+		}
+		granule = samples + pkt.Granule - dropped
+		if pkt.EOS {
+			break
+		}
+		if err := flush(granule); err != nil {
+			return err
+		}
+	}
+	return e.EncodeEOS(granule, group)
+}
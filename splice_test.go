@@ -0,0 +1,140 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestSpliceOpus(t *testing.T) {
+	tags := opusTagsPacket("test")
+	a := opusFile(t, 0, tags, []byte{0x08, 'a'}, []byte{0x08, 'b'}, []byte{0x08, 'c'})
+	b := opusFile(t, 1000, tags, []byte{0x08, 'd'}, []byte{0x08, 'e'}, []byte{0x08, 'f'}, []byte{0x08, 'g'})
+
+	var out bytes.Buffer
+	if err := SpliceOpus(bytes.NewReader(a), bytes.NewReader(b), &out); err != nil {
+		t.Fatal("unexpected SpliceOpus error:", err)
+	}
+
+	d := NewDecoder(&out)
+	var data string
+	var granules []int64
+	var types []byte
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		if p.Serial != 7 {
+			t.Fatal("expected serial 7, got", p.Serial)
+		}
+		types = append(types, p.Type)
+		granules = append(granules, p.Granule)
+		for _, pkt := range p.Packets {
+			if len(pkt) == 2 {
+				data += string(pkt[1])
+			}
+		}
+	}
+
+	if data != "abcefg" {
+		t.Fatal("expected packets abcefg, got", data)
+	}
+	expected := []int64{0, 0, 960, 1920, 2880, 3840, 4800, 5760}
+	if len(granules) != len(expected) {
+		t.Fatal("expected granules", expected, "got", granules)
+	}
+	for i := range expected {
+		if granules[i] != expected[i] {
+			t.Fatal("expected granules", expected, "got", granules)
+		}
+	}
+	for i, typ := range types {
+		want := byte(0)
+		if i == 0 {
+			want = BOS
+		} else if i == len(types)-1 {
+			want = EOS
+		}
+		if typ != want {
+			t.Fatalf("page %d: expected type %d, got %d", i, want, typ)
+		}
+	}
+}
+
+func TestSpliceOpusEndTrim(t *testing.T) {
+	tags := opusTagsPacket("test")
+	a := opusFile(t, 0, tags, []byte{0x08, 'a'}, []byte{0x08, 'b'}, []byte{0x08, 'c'})
+	b := opusFile(t, 0, tags, []byte{0x08, 'd'}, []byte{0x08, 'e'})
+	// Trim 500 samples from the end of a's last page.
+	last := a[len(a)-headsz-1-2:]
+	byteOrder.PutUint64(last[6:14], 3*960-500)
+	fixCrc(last)
+
+	var out bytes.Buffer
+	if err := SpliceOpus(bytes.NewReader(a), bytes.NewReader(b), &out); err != nil {
+		t.Fatal("unexpected SpliceOpus error:", err)
+	}
+	if err := VerifyOpusGranules(bytes.NewReader(out.Bytes())); err != nil {
+		t.Fatal("unexpected VerifyOpusGranules error:", err)
+	}
+
+	d := NewDecoder(&out)
+	var granules []int64
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		granules = append(granules, p.Granule)
+	}
+	expected := []int64{0, 0, 960, 1920, 2880, 3840, 4800}
+	if len(granules) != len(expected) {
+		t.Fatal("expected granules", expected, "got", granules)
+	}
+	for i := range expected {
+		if granules[i] != expected[i] {
+			t.Fatal("expected granules", expected, "got", granules)
+		}
+	}
+}
+
+func TestSpliceOpusMismatch(t *testing.T) {
+	tags := opusTagsPacket("test")
+	a := opusFile(t, 0, tags, []byte{0x08, 'a'})
+	b := opusFile(t, 0, tags, []byte{0x08, 'b'})
+	b[headsz+1+9] = 1
+	fixCrc(b)
+
+	err := SpliceOpus(bytes.NewReader(a), bytes.NewReader(b), io.Discard)
+	if err != ErrOpusMismatch {
+		t.Fatal("expected ErrOpusMismatch, got", err)
+	}
+
+	err = SpliceOpus(bytes.NewReader(nil), bytes.NewReader(b), io.Discard)
+	if err != ErrNoOpusStream {
+		t.Fatal("expected ErrNoOpusStream, got", err)
+	}
+}
+
+func TestSpliceOpusTruncated(t *testing.T) {
+	tags := opusTagsPacket("test")
+	a := opusFile(t, 0, tags, []byte{0x08, 'a'}, []byte{0x08, 'b'})
+	b := opusFile(t, 0, tags, []byte{0x08, 'c'}, []byte{0x08, 'd'})
+
+	// Cutting off the end of either stream's last page is an error, not a shorter splice.
+	err := SpliceOpus(bytes.NewReader(a[:len(a)-1]), bytes.NewReader(b), io.Discard)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatal("expected io.ErrUnexpectedEOF for a truncated first stream, got", err)
+	}
+	err = SpliceOpus(bytes.NewReader(a), bytes.NewReader(b[:len(b)-1]), io.Discard)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatal("expected io.ErrUnexpectedEOF for a truncated second stream, got", err)
+	}
+}
@@ -0,0 +1,140 @@
+package ogg
+
+import "sort"
+
+// A DecoderState is the progress of a Decoder through its stream, as returned by Decoder.State,
+// from which another Decoder can resume with RestoreState.
+// Its fields are exported so that it can be serialized, as with encoding/gob or encoding/json,
+// to resume after a process restarts.
+type DecoderState struct {
+	// Offset is the Decoder's Offset, where its Reader must be positioned to resume.
+	Offset int64
+	// Pages is the number of pages read, for MaxPages.
+	Pages int
+	// Unfinished is set if the last page's last packet continues on the next page.
+	Unfinished bool
+	// Pending are the packets of the last page that DecodePacket is yet to return.
+	Pending []Packet
+	// Continued are the packets DecodePacket is holding for their continuations, by serial number.
+	Continued []ContinuedPacket
+	// Streams are the logical streams of the current link, as tracked for the conformance checks,
+	// and LinkData is set if any of their pages besides BOS pages have been read.
+	Streams  []StreamState
+	LinkData bool
+	// Timestamped are the first packets of the logical streams that Timestamps is timestamping,
+	// from which their GranuleInterpreters are created again, by serial number.
+	Timestamped map[uint32][]byte
+	// Rebases are the rebasing of the timestamps of the logical streams, for Decoder.RebaseGranules,
+	// by serial number.
+	Rebases map[uint32]GranuleRebase
+}
+
+// A ContinuedPacket is the beginning of a packet continued on a page not yet read.
+type ContinuedPacket struct {
+	Data         []byte
+	Serial       uint32
+	SourceOffset int64
+	// Pages is the number of pages it has been continued on, for Decoder.MaxContinuationPages.
+	Pages int
+}
+
+// A StreamState is what a Decoder tracks about a logical stream.
+type StreamState struct {
+	Serial uint32
+	// Sequence is the sequence number of the stream's last page, and CRC its checksum.
+	Sequence uint32
+	CRC      uint32
+	// Granule is the last granule position other than -1, or -1.
+	Granule int64
+	EOS     bool
+	// Unfinished is set if the stream's last page's last packet continues on a page not yet read,
+	// for CheckTruncation.
+	Unfinished bool
+}
+
+// State returns d's progress through its stream, to resume from with RestoreState.
+// It doesn't include d's options, which the resuming Decoder must be given itself.
+// State must not be called between Peek and the call that reads the rest of the peeked page.
+func (d *Decoder) State() DecoderState {
+	s := DecoderState{
+		Offset:     d.offset,
+		Pages:      d.pages,
+		Unfinished: d.unfinished,
+		LinkData:   d.linkData,
+	}
+	for _, pkt := range d.pending {
+		pkt.Data = append([]byte(nil), pkt.Data...)
+		s.Pending = append(s.Pending, pkt)
+	}
+	for serial, h := range d.held {
+		s.Continued = append(s.Continued, ContinuedPacket{append([]byte(nil), h.data...), serial, h.offset, h.pages})
+	}
+	sort.Slice(s.Continued, func(i, j int) bool { return s.Continued[i].Serial < s.Continued[j].Serial })
+	for serial, st := range d.streams {
+		s.Streams = append(s.Streams, StreamState{serial, st.seq, st.crc, st.granule, st.eos, st.unfinished})
+	}
+	sort.Slice(s.Streams, func(i, j int) bool { return s.Streams[i].Serial < s.Streams[j].Serial })
+	if len(d.tsStreams) > 0 {
+		s.Timestamped = make(map[uint32][]byte)
+		for serial, ts := range d.tsStreams {
+			s.Timestamped[serial] = append([]byte(nil), ts.bos...)
+		}
+	}
+	if len(d.rebases) > 0 {
+		s.Rebases = make(map[uint32]GranuleRebase)
+		for serial, r := range d.rebases {
+			s.Rebases[serial] = *r
+		}
+	}
+	return s
+}
+
+// RestoreState makes d resume from s, as returned by another Decoder's State,
+// discarding d's own progress but keeping its options.
+// d's Reader must be positioned at s.Offset, the offset of the stream at which s was taken.
+func (d *Decoder) RestoreState(s DecoderState) {
+	d.offset = s.Offset
+	d.pages = s.Pages
+	d.unfinished = s.Unfinished
+	d.peeked = false
+	d.atLimit = false
+
+	d.pending = nil
+	for _, pkt := range s.Pending {
+		pkt.Data = append([]byte(nil), pkt.Data...)
+		d.pending = append(d.pending, pkt)
+	}
+
+	d.held = nil
+	for _, c := range s.Continued {
+		if d.held == nil {
+			d.held = make(map[uint32]*heldPacket)
+		}
+		d.held[c.Serial] = &heldPacket{append([]byte(nil), c.Data...), c.SourceOffset, c.Pages}
+	}
+
+	d.streams = make(map[uint32]*streamState)
+	for _, st := range s.Streams {
+		d.streams[st.Serial] = &streamState{seq: st.Sequence, crc: st.CRC, granule: st.Granule, eos: st.EOS, unfinished: st.Unfinished}
+	}
+	d.linkData = s.LinkData
+
+	d.tsStreams = nil
+	for serial, bos := range s.Timestamped {
+		if gi, err := NewGranuleInterpreter(bos); err == nil {
+			if d.tsStreams == nil {
+				d.tsStreams = make(map[uint32]tsStream)
+			}
+			d.tsStreams[serial] = tsStream{gi, append([]byte(nil), bos...)}
+		}
+	}
+
+	d.rebases = nil
+	for serial, r := range s.Rebases {
+		if d.rebases == nil {
+			d.rebases = make(map[uint32]*GranuleRebase)
+		}
+		r := r
+		d.rebases[serial] = &r
+	}
+}
@@ -0,0 +1,169 @@
+package ogg
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// roundTrip serializes and deserializes s, as a checkpoint would.
+func roundTrip(t *testing.T, s DecoderState) DecoderState {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(s); err != nil {
+		t.Fatal("unexpected gob Encode error:", err)
+	}
+	var out DecoderState
+	if err := gob.NewDecoder(&b).Decode(&out); err != nil {
+		t.Fatal("unexpected gob Decode error:", err)
+	}
+	return out
+}
+
+func TestDecoderState(t *testing.T) {
+	var b bytes.Buffer
+	audio := NewEncoder(1, &b)
+	data := NewEncoder(2, &b)
+	// enough 1000-byte packets to need more than a page's 255 segments
+	big := func(c byte) [][]byte {
+		packets := make([][]byte, 70)
+		for i := range packets {
+			packets[i] = bytes.Repeat([]byte{c + byte(i)}, 1000)
+		}
+		return packets
+	}
+	for i, err := range []error{
+		audio.EncodeBOS(0, [][]byte{vorbisIDPacket(1000, 8, 11)}),
+		data.EncodeBOS(0, [][]byte{[]byte("data")}),
+		// packets continued across pages
+		audio.Encode(500, big(0)),
+		data.Encode(1, [][]byte{[]byte("one"), []byte("two"), []byte("three")}),
+		audio.Encode(1000, big(100)),
+		data.EncodeEOS(2, [][]byte{[]byte("four")}),
+		audio.EncodeEOS(1500, big(200)[:1]),
+	} {
+		if err != nil {
+			t.Fatalf("%d: unexpected encoding error: %v", i, err)
+		}
+	}
+	stream := b.Bytes()
+
+	newDecoder := func(r io.Reader) *Decoder {
+		d := NewDecoder(r)
+		d.Conformance = ConformanceStrict
+		d.Timestamps = true
+		return d
+	}
+
+	var want []Packet
+	continued := false
+	d := newDecoder(bytes.NewReader(stream))
+	for {
+		pkt, err := d.DecodePacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected DecodePacket error:", err)
+		}
+		want = append(want, pkt)
+		continued = continued || len(d.held) > 0
+	}
+	if !continued {
+		t.Fatal("expected packets continued across pages")
+	}
+
+	for half := 1; half < len(want); half++ {
+		d := newDecoder(bytes.NewReader(stream))
+		got := make([]Packet, 0, len(want))
+		for len(got) < half {
+			pkt, err := d.DecodePacket()
+			if err != nil {
+				t.Fatal("unexpected DecodePacket error:", err)
+			}
+			got = append(got, pkt)
+		}
+
+		s := roundTrip(t, d.State())
+		d = newDecoder(bytes.NewReader(stream[s.Offset:]))
+		d.RestoreState(s)
+		for {
+			pkt, err := d.DecodePacket()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("resuming after %d packets: unexpected DecodePacket error: %v", half, err)
+			}
+			got = append(got, pkt)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("resuming after %d packets: expected packets %v, got %v", half, want, got)
+		}
+	}
+
+	// Pages are timestamped and checked as before.
+	d = newDecoder(bytes.NewReader(stream))
+	for i := 0; i < 4; i++ {
+		if _, _, err := d.Decode(); err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+	}
+	s := roundTrip(t, d.State())
+	d = newDecoder(bytes.NewReader(stream[s.Offset:]))
+	d.RestoreState(s)
+	var last Page
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected Decode error after resuming:", err)
+		}
+		if p.Serial == 1 {
+			last = p
+		}
+	}
+	if last.Timestamp != 1500*time.Millisecond || !d.CleanEOF() {
+		t.Fatalf("expected the last audio page at 1.5s and every stream ended, got %v, %v", last.Timestamp, d.CleanEOF())
+	}
+}
+
+func TestDecoderStateTruncation(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("header")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	n := b.Len()
+	if err := e.Encode(1, [][]byte{make([]byte, mps+10)}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	// the stream, cut off after the page that begins the long packet
+	stream := b.Bytes()[:n+headsz+mss+mps]
+
+	d := NewDecoder(bytes.NewReader(stream))
+	d.Conformance = ConformanceStrict
+	for i := 0; i < 2; i++ {
+		if _, _, err := d.Decode(); err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+	}
+
+	s := roundTrip(t, d.State())
+	if len(s.Streams) != 1 || !s.Streams[0].Unfinished {
+		t.Fatal("expected the stream's packet unfinished, got", s.Streams)
+	}
+	d = NewDecoder(bytes.NewReader(stream[s.Offset:]))
+	d.Conformance = ConformanceStrict
+	d.RestoreState(s)
+	if _, _, err := d.Decode(); err != (ErrTruncatedFinalPacket{1}) {
+		t.Fatal("expected ErrTruncatedFinalPacket after resuming, got", err)
+	}
+	if _, _, err := d.Decode(); err != io.EOF {
+		t.Fatal("expected EOF, got", err)
+	}
+}
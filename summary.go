@@ -0,0 +1,91 @@
+package ogg
+
+import (
+	"io"
+	"time"
+)
+
+// A Summary describes a physical stream as read by DecodeAll.
+type Summary struct {
+	// Bytes and Pages are the size of the stream, and the number of pages in it.
+	Bytes int64
+	Pages int
+	// Streams are the logical streams, in the order their first pages appear.
+	// A chain may repeat a serial number, in which case each link's stream is listed.
+	Streams []StreamSummary
+}
+
+// A StreamSummary describes a logical stream as read by DecodeAll.
+type StreamSummary struct {
+	Serial uint32
+	Codec  Codec
+	// Pages and Packets are the numbers of pages and complete packets in the stream.
+	Pages, Packets int
+	// LastGranule is the granule position of the stream's last page that has one, or -1.
+	LastGranule int64
+	// Duration is the time at LastGranule, if a GranuleInterpreter is registered for the codec.
+	// It accounts for the pre-skip of Opus.
+	Duration time.Duration
+	// EOS is set if the stream ended with an EOS page.
+	EOS bool
+}
+
+// DecodeAll decodes the whole of r in one pass, returning its pages, with their packets copied,
+// and a Summary of the stream.
+// Unlike ListStreams, LastGranule, and the like, it doesn't need to seek,
+// so it suits readers that can't, such as pipes and the entries of tar and zip archives,
+// at the cost of holding every page in memory.
+// On an error, DecodeAll returns the pages and summary of the stream up to the error.
+func DecodeAll(r io.Reader) ([]Page, Summary, error) {
+	d := NewDecoder(r)
+	d.CopyPackets = true
+
+	var pages []Page
+	var sum Summary
+	// the index into sum.Streams of each serial's current stream, and its granule interpreter
+	current := make(map[uint32]int)
+	interps := make(map[uint32]GranuleInterpreter)
+	for {
+		p, n, err := d.Decode()
+		sum.Bytes += int64(n)
+		if err == io.EOF {
+			return pages, sum, nil
+		}
+		if err != nil {
+			return pages, sum, err
+		}
+		pages = append(pages, p)
+		sum.Pages++
+
+		i, ok := current[p.Serial]
+		if !ok || p.Type&BOS != 0 {
+			s := StreamSummary{Serial: p.Serial, LastGranule: -1}
+			if p.Type&BOS != 0 && len(p.Packets) > 0 {
+				s.Codec = IdentifyCodec(p.Packets[0])
+				if gi, err := NewGranuleInterpreter(p.Packets[0]); err == nil {
+					interps[p.Serial] = gi
+				} else {
+					delete(interps, p.Serial)
+				}
+			}
+			i = len(sum.Streams)
+			current[p.Serial] = i
+			sum.Streams = append(sum.Streams, s)
+		}
+
+		s := &sum.Streams[i]
+		s.Pages++
+		// packets are counted on the page they end on
+		s.Packets += len(p.Packets)
+		if p.Unfinished {
+			s.Packets--
+		}
+		if p.Granule != -1 {
+			s.LastGranule = p.Granule
+			if gi, ok := interps[p.Serial]; ok {
+				s.Duration = gi.GranuleToDuration(p.Granule)
+			}
+		}
+		s.EOS = s.EOS || p.Type&EOS != 0
+	}
+}
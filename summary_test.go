@@ -0,0 +1,76 @@
+package ogg
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestDecodeAll(t *testing.T) {
+	opus := opusFile(t, 480, opusTagsPacket("test"), []byte{0x08}, []byte{0x08})
+
+	var b bytes.Buffer
+	b.Write(opus)
+	e := NewEncoder(2, &b)
+	for i, err := range []error{
+		e.EncodeBOS(0, [][]byte{vorbisIDPacket(44100, 8, 11)}),
+		e.Encode(-1, [][]byte{[]byte("comments"), bytes.Repeat([]byte("x"), mps)}),
+		e.EncodeEOS(88200, [][]byte{[]byte("audio")}),
+	} {
+		if err != nil {
+			t.Fatalf("%d: unexpected encoding error: %v", i, err)
+		}
+	}
+
+	// from a zip entry, which can't seek
+	var archive bytes.Buffer
+	z := zip.NewWriter(&archive)
+	f, err := z.Create("chain.ogg")
+	if err != nil {
+		t.Fatal("unexpected zip error:", err)
+	}
+	f.Write(b.Bytes())
+	if err := z.Close(); err != nil {
+		t.Fatal("unexpected zip error:", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatal("unexpected zip error:", err)
+	}
+	entry, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatal("unexpected zip error:", err)
+	}
+	defer entry.Close()
+
+	pages, sum, err := DecodeAll(entry)
+	if err != nil {
+		t.Fatal("unexpected DecodeAll error:", err)
+	}
+	if len(pages) != sum.Pages || sum.Pages != 8 || sum.Bytes != int64(b.Len()) {
+		t.Fatalf("unexpected %d pages in summary %+v", len(pages), sum)
+	}
+	want := []StreamSummary{
+		{Serial: 7, Codec: CodecOpus, Pages: 4, Packets: 4, LastGranule: 1920, Duration: 30 * time.Millisecond, EOS: true},
+		{Serial: 2, Codec: CodecVorbis, Pages: 4, Packets: 4, LastGranule: 88200, Duration: 2 * time.Second, EOS: true},
+	}
+	if len(sum.Streams) != len(want) {
+		t.Fatalf("expected streams %+v, got %+v", want, sum.Streams)
+	}
+	for i := range want {
+		if sum.Streams[i] != want[i] {
+			t.Fatalf("expected stream %+v, got %+v", want[i], sum.Streams[i])
+		}
+	}
+	// the pages are copies, so they survive decoding
+	if string(pages[len(pages)-1].Packets[0]) != "audio" {
+		t.Fatalf("unexpected last packet %q", pages[len(pages)-1].Packets[0])
+	}
+
+	pages, sum, err = DecodeAll(bytes.NewReader(b.Bytes()[:len(opus)+10]))
+	if err != io.ErrUnexpectedEOF || len(pages) != 4 || len(sum.Streams) != 1 {
+		t.Fatalf("expected ErrUnexpectedEOF after 4 pages, got %v after %d", err, len(pages))
+	}
+}
@@ -0,0 +1,162 @@
+package ogg
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// ErrUnsupportedCodec is returned by GranuleRate and NewGranuleInterpreter when the codec of a stream is not recognized,
+// or has no fixed granule rate.
+var ErrUnsupportedCodec = errors.New("unsupported codec")
+
+// ErrBadCodecHeader is returned by GranuleRate when a Theora, Speex, or FLAC header is malformed.
+var ErrBadCodecHeader = errors.New("malformed codec header")
+
+// GranuleRate returns the number of granules per second of the logical stream whose first packet is bosPacket:
+// 48000 for Opus, whatever the rate of the input, the sample rate for Vorbis, Speex, and FLAC,
+// and the frame rate, rounded to the nearest integer, for Theora.
+// Theora granule positions also encode the last keyframe, so they must be split before applying the rate.
+func GranuleRate(bosPacket []byte) (int, error) {
+	switch IdentifyCodec(bosPacket) {
+	case CodecOpus:
+		if _, err := ParseOpusHead(bosPacket); err != nil {
+			return 0, err
+		}
+		return 48000, nil
+	case CodecVorbis:
+		id, err := ParseVorbisID(bosPacket)
+		if err != nil {
+			return 0, err
+		}
+		if id.SampleRate == 0 {
+			return 0, ErrBadVorbisHeader
+		}
+		return int(id.SampleRate), nil
+	case CodecTheora:
+		// the frame rate numerator and denominator follow the version, and the frame and picture dimensions
+		if len(bosPacket) < 30 {
+			return 0, ErrBadCodecHeader
+		}
+		num := uint64(binary.BigEndian.Uint32(bosPacket[22:]))
+		den := uint64(binary.BigEndian.Uint32(bosPacket[26:]))
+		if num == 0 || den == 0 {
+			return 0, ErrBadCodecHeader
+		}
+		return int((num + den/2) / den), nil
+	case CodecSpeex:
+		// the rate follows the 8-byte magic, 20-byte version string, and two 4-byte fields
+		if len(bosPacket) < 40 {
+			return 0, ErrBadCodecHeader
+		}
+		if rate := byteOrder.Uint32(bosPacket[36:]); rate > 0 {
+			return int(rate), nil
+		}
+		return 0, ErrBadCodecHeader
+	case CodecFLAC:
+		// the mapping header is followed by the native signature and the STREAMINFO block,
+		// whose rate is 20 bits, 10 bytes in
+		if len(bosPacket) < 30 || string(bosPacket[9:13]) != "fLaC" {
+			return 0, ErrBadCodecHeader
+		}
+		if rate := int(bosPacket[27])<<12 | int(bosPacket[28])<<4 | int(bosPacket[29])>>4; rate > 0 {
+			return rate, nil
+		}
+		return 0, ErrBadCodecHeader
+	}
+	return 0, ErrUnsupportedCodec
+}
+
+// granuleRate returns the number of granules per second of the logical stream whose first packet is bos,
+// and the granule position at which its presentation starts, if its granule positions count samples:
+// Opus, Vorbis, Speex, or FLAC.
+func granuleRate(bos []byte) (rate, start int64, ok bool) {
+	switch IdentifyCodec(bos) {
+	case CodecTheora:
+		return 0, 0, false
+	case CodecOpus:
+		h, err := ParseOpusHead(bos)
+		if err != nil {
+			return 0, 0, false
+		}
+		return 48000, int64(h.PreSkip), true
+	}
+	r, err := GranuleRate(bos)
+	return int64(r), 0, err == nil
+}
+
+// granuleDuration converts a count of granules to a time.Duration, given their rate per second.
+func granuleDuration(granules, rate int64) time.Duration {
+	return time.Duration(granules/rate)*time.Second + time.Duration(granules%rate)*time.Second/time.Duration(rate)
+}
+
+// A tsStream is a logical stream timestamped by Decoder.Timestamps:
+// its GranuleInterpreter, and the first packet it was created from, for DecoderState.
+type tsStream struct {
+	gi  GranuleInterpreter
+	bos []byte
+}
+
+// timestamp returns the timestamp of a page with the given header and first packet, if any,
+// for Decoder.Timestamps.
+func (d *Decoder) timestamp(h *pageHeader, first []byte) time.Duration {
+	if h.HeaderType&BOS != 0 && first != nil {
+		if d.tsStreams == nil {
+			d.tsStreams = make(map[uint32]tsStream)
+		}
+		if gi, err := NewGranuleInterpreter(first); err == nil {
+			d.tsStreams[h.Serial] = tsStream{gi, append([]byte(nil), first...)}
+		} else {
+			// A chain may reuse the serial of an earlier stream.
+			delete(d.tsStreams, h.Serial)
+		}
+		delete(d.rebases, h.Serial)
+	}
+
+	gi := d.tsStreams[h.Serial].gi
+	r := d.rebases[h.Serial]
+	if h.HeaderType&EOS != 0 {
+		delete(d.tsStreams, h.Serial)
+		delete(d.rebases, h.Serial)
+	}
+	if rate, ok := d.GranuleRates[h.Serial]; ok {
+		// An overridden rate keeps a sample-counting stream's start.
+		s, _ := gi.(sampleInterpreter)
+		s.rate = int64(rate)
+		gi = s
+	}
+	if gi == nil || h.Granule == -1 {
+		return 0
+	}
+	if s, ok := gi.(sampleInterpreter); ok && s.rate <= 0 {
+		return 0
+	}
+	if !d.RebaseGranules {
+		return gi.GranuleToDuration(h.Granule)
+	}
+
+	if r == nil {
+		r = &GranuleRebase{Granule: h.Granule}
+		if h.HeaderType&EOS == 0 {
+			if d.rebases == nil {
+				d.rebases = make(map[uint32]*GranuleRebase)
+			}
+			d.rebases[h.Serial] = r
+		}
+	}
+	if h.Granule < r.Granule {
+		// The counter restarted: continue from the last timestamp, by the time since 0.
+		r.Offset += gi.GranuleToDuration(r.Granule) - gi.GranuleToDuration(0)
+	}
+	r.Granule = h.Granule
+	return r.Offset + gi.GranuleToDuration(h.Granule)
+}
+
+// A GranuleRebase is how Decoder.RebaseGranules rebases the timestamps of a logical stream
+// whose granule counter has restarted.
+type GranuleRebase struct {
+	// Granule is the stream's last granule position other than -1.
+	Granule int64
+	// Offset is added to the timestamps of the granule positions since the last restart.
+	Offset time.Duration
+}
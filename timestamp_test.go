@@ -0,0 +1,233 @@
+package ogg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+)
+
+func pageTimestamps(t *testing.T, b []byte) []time.Duration {
+	t.Helper()
+	d := NewDecoder(bytes.NewReader(b))
+	d.Timestamps = true
+	var ts []time.Duration
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			return ts
+		}
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		ts = append(ts, p.Timestamp)
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	opus := opusFile(t, 480, opusTagsPacket("test"), []byte{0x08}, []byte{0x08})
+
+	var vorbis bytes.Buffer
+	e := NewEncoder(2, &vorbis)
+	if err := e.EncodeBOS(0, [][]byte{vorbisIDPacket(44100, 8, 11)}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.Encode(-1, [][]byte{[]byte("comments")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := e.EncodeEOS(88200, [][]byte{[]byte("audio")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	var unknown bytes.Buffer
+	e = NewEncoder(3, &unknown)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("mystery")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.EncodeEOS(1000, [][]byte{[]byte("data")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	tests := []struct {
+		data []byte
+		want []time.Duration
+	}{
+		{opus, []time.Duration{-10 * time.Millisecond, -10 * time.Millisecond, 10 * time.Millisecond, 30 * time.Millisecond}},
+		{vorbis.Bytes(), []time.Duration{0, 0, 2 * time.Second}},
+		{unknown.Bytes(), []time.Duration{0, 0}},
+		// chained, the second link is timestamped by its own rate
+		{append(append([]byte(nil), opus...), vorbis.Bytes()...), []time.Duration{
+			-10 * time.Millisecond, -10 * time.Millisecond, 10 * time.Millisecond, 30 * time.Millisecond,
+			0, 0, 2 * time.Second,
+		}},
+	}
+	for i, test := range tests {
+		ts := pageTimestamps(t, test.data)
+		if len(ts) != len(test.want) {
+			t.Fatalf("%d: expected timestamps %v, got %v", i, test.want, ts)
+		}
+		for j := range ts {
+			if ts[j] != test.want[j] {
+				t.Fatalf("%d: expected timestamps %v, got %v", i, test.want, ts)
+			}
+		}
+	}
+}
+
+func TestMultiplexedTimestamps(t *testing.T) {
+	var b bytes.Buffer
+	opus := NewEncoder(1, &b)
+	vorbis := NewEncoder(2, &b)
+	data := NewEncoder(3, &b)
+	for i, err := range []error{
+		opus.EncodeBOS(0, [][]byte{opusHeadPacket(2, 480)}),
+		vorbis.EncodeBOS(0, [][]byte{vorbisIDPacket(44100, 8, 11)}),
+		data.EncodeBOS(0, [][]byte{[]byte("mystery")}),
+		opus.Encode(48480, [][]byte{[]byte("audio")}),
+		vorbis.Encode(22050, [][]byte{[]byte("audio")}),
+		data.Encode(250, [][]byte{[]byte("data")}),
+		opus.EncodeEOS(96480, [][]byte{[]byte("audio")}),
+		vorbis.EncodeEOS(88200, [][]byte{[]byte("audio")}),
+		data.EncodeEOS(500, [][]byte{[]byte("data")}),
+	} {
+		if err != nil {
+			t.Fatalf("%d: unexpected encoding error: %v", i, err)
+		}
+	}
+
+	tests := []struct {
+		rates map[uint32]int
+		want  []time.Duration
+	}{
+		{nil, []time.Duration{
+			-10 * time.Millisecond, 0, 0,
+			time.Second, 500 * time.Millisecond, 0,
+			2 * time.Second, 2 * time.Second, 0,
+		}},
+		// the unrecognized stream's rate is given, and the Vorbis stream's overridden
+		{map[uint32]int{3: 1000, 2: 88200}, []time.Duration{
+			-10 * time.Millisecond, 0, 0,
+			time.Second, 250 * time.Millisecond, 250 * time.Millisecond,
+			2 * time.Second, time.Second, 500 * time.Millisecond,
+		}},
+	}
+	for i, test := range tests {
+		d := NewDecoder(bytes.NewReader(b.Bytes()))
+		d.Timestamps = true
+		d.GranuleRates = test.rates
+		for j, want := range test.want {
+			p, _, err := d.Decode()
+			if err != nil {
+				t.Fatalf("%d: unexpected Decode error: %v", i, err)
+			}
+			if p.Timestamp != want {
+				t.Fatalf("%d: page %d of stream %d: expected timestamp %v, got %v", i, j, p.Serial, want, p.Timestamp)
+			}
+		}
+	}
+}
+
+func TestRebaseGranules(t *testing.T) {
+	// An Opus stream whose granule counter restarts after three 20ms pages.
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{opusHeadPacket(2, 0)}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	for _, g := range []int64{0, 960, 1920, 2880, 960, 1920} {
+		if err := e.Encode(g, [][]byte{{0x08}}); err != nil {
+			t.Fatal("unexpected Encode error:", err)
+		}
+	}
+
+	ms := time.Millisecond
+	got := pageTimestamps(t, b.Bytes())
+	for i, w := range []time.Duration{0, 0, 20 * ms, 40 * ms, 60 * ms, 20 * ms, 40 * ms} {
+		if got[i] != w {
+			t.Fatalf("page %d: expected timestamp %v without rebasing, got %v", i, w, got[i])
+		}
+	}
+
+	want := []time.Duration{0, 0, 20 * ms, 40 * ms, 60 * ms, 80 * ms, 100 * ms}
+	d := NewDecoder(bytes.NewReader(b.Bytes()))
+	d.Timestamps = true
+	d.RebaseGranules = true
+	for i, w := range want {
+		if i == 6 {
+			// Resuming from the state keeps the rebasing.
+			s := d.State()
+			d = NewDecoder(bytes.NewReader(b.Bytes()[s.Offset:]))
+			d.Timestamps = true
+			d.RebaseGranules = true
+			d.RestoreState(s)
+		}
+		p, _, err := d.Decode()
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		if p.Timestamp != w {
+			t.Fatalf("page %d: expected timestamp %v, got %v", i, w, p.Timestamp)
+		}
+	}
+}
+
+func TestGranuleRate(t *testing.T) {
+	speex := make([]byte, 80)
+	copy(speex, "Speex   ")
+	byteOrder.PutUint32(speex[36:], 16000)
+
+	flac := append([]byte("\x7fFLAC\x01\x00\x00\x01fLaC\x00\x00\x00\x22"), make([]byte, 34)...)
+	// 44100 Hz in the 20 bits following the block and frame sizes
+	flac[27], flac[28], flac[29] = 0x0a, 0xc4, 0x42
+
+	tests := []struct {
+		bos  []byte
+		rate int64
+	}{
+		{speex, 16000},
+		{flac, 44100},
+		{speex[:39], 0},
+		{[]byte("\x7fFLAC"), 0},
+	}
+	for i, test := range tests {
+		rate, _, ok := granuleRate(test.bos)
+		if rate != test.rate || ok != (test.rate != 0) {
+			t.Fatalf("%d: expected rate %d, got %d", i, test.rate, rate)
+		}
+	}
+}
+
+func TestGranuleRateExported(t *testing.T) {
+	theora := make([]byte, 42)
+	copy(theora, "\x80theora\x03\x02\x01")
+	// 30000/1001 frames per second
+	binary.BigEndian.PutUint32(theora[22:], 30000)
+	binary.BigEndian.PutUint32(theora[26:], 1001)
+
+	speex := make([]byte, 80)
+	copy(speex, "Speex   ")
+	byteOrder.PutUint32(speex[36:], 8000)
+
+	tests := []struct {
+		bos  []byte
+		rate int
+		err  error
+	}{
+		{opusHeadPacket(2, 312), 48000, nil},
+		{vorbisIDPacket(22050, 8, 11), 22050, nil},
+		{theora, 30, nil},
+		{speex, 8000, nil},
+		{theora[:29], 0, ErrBadCodecHeader},
+		{speex[:30], 0, ErrBadCodecHeader},
+		{[]byte("OpusHead"), 0, ErrBadOpusHead},
+		{[]byte("fishead\x00"), 0, ErrUnsupportedCodec},
+		{[]byte("mystery"), 0, ErrUnsupportedCodec},
+	}
+	for i, test := range tests {
+		rate, err := GranuleRate(test.bos)
+		if rate != test.rate || err != test.err {
+			t.Fatalf("%d: expected %d, %v, got %d, %v", i, test.rate, test.err, rate, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package ogg
+
+import "io"
+
+// Transcode decodes the packets of the ogg stream in in, passes each through transform,
+// and encodes the packets it returns to out, for any number of logical streams, multiplexed or chained.
+// transform may return any number of packets for each it's given, and may hold packets back
+// to return them with later ones; an error from it stops Transcode, which returns it.
+// The packets it's given have their Data copied, so it may keep them.
+//
+// The packets transform returns go in the logical stream of the packet it was given;
+// only their Data and Granule are used. Header packets are passed to transform like any others,
+// and the first packet returned for a stream goes alone on its BOS page, with granule position 0.
+// A packet with Granule -1 takes the position of the page of in it ends with, if any;
+// otherwise 0 if it's a header packet, or for Opus, the next position less the next packet's duration,
+// and for other codecs, a position interpolated between those around it.
+// Pages are ended where the pages of in ended, after the packets returned up to the last packet
+// to end on each, and the stream is ended with an EOS page after the packet with EOS has been transformed.
+func Transcode(in io.Reader, out io.Writer, transform func(Packet) ([]Packet, error)) error {
+	d := NewDecoder(in)
+	d.CopyPackets = true
+	streams := make(map[uint32]*transcodeStream)
+	// the streams, in the order they began, for flushing those that end without an EOS page
+	var order []*transcodeStream
+	for {
+		pkt, err := d.DecodePacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		s := streams[pkt.Serial]
+		if s == nil {
+			s = &transcodeStream{e: NewEncoder(pkt.Serial, out)}
+			streams[pkt.Serial] = s
+			order = append(order, s)
+		}
+		pkts, err := transform(pkt)
+		if err != nil {
+			return err
+		}
+		s.queue = append(s.queue, pkts...)
+		if pkt.Granule == -1 && !pkt.EOS {
+			continue
+		}
+		if err := s.flush(pkt.Granule, pkt.EOS); err != nil {
+			return err
+		}
+		if pkt.EOS {
+			s.ended = true
+			delete(streams, pkt.Serial)
+		}
+	}
+
+	for _, s := range order {
+		if !s.ended {
+			if err := s.flush(-1, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// A transcodeStream is a logical stream written by Transcode.
+type transcodeStream struct {
+	e     *Encoder
+	codec Codec
+	// the packets transformed but not yet written
+	queue []Packet
+	// the number of packets written, and the granule position of the last
+	n       int
+	granule int64
+	ended   bool
+}
+
+// flush writes the queued packets, the last of which ends a page at granule position granule,
+// or at its own, or at the last packet's if both are -1.
+// If eos is set, they end the stream.
+func (s *transcodeStream) flush(granule int64, eos bool) error {
+	pkts := s.queue
+	s.queue = nil
+	if s.n == 0 {
+		if len(pkts) == 0 {
+			return nil
+		}
+		s.codec = IdentifyCodec(pkts[0].Data)
+		kind := byte(BOS)
+		if eos && len(pkts) == 1 {
+			kind |= EOS
+		}
+		if err := s.e.writeEach(kind, 0, nil, [][]byte{pkts[0].Data}); err != nil {
+			return err
+		}
+		s.n = 1
+		if pkts = pkts[1:]; len(pkts) == 0 {
+			return nil
+		}
+	}
+	if len(pkts) == 0 {
+		if !eos {
+			return nil
+		}
+		return s.e.EncodeEOS(s.granule, nil)
+	}
+
+	s.setGranules(pkts, granule)
+	pkts[0].BOS = false
+	pkts[len(pkts)-1].EOS = eos
+	s.n += len(pkts)
+	s.granule = pkts[len(pkts)-1].Granule
+	return s.e.EncodePackets(pkts)
+}
+
+// setGranules gives the packets with Granule -1 positions, the last of which ends at granule.
+func (s *transcodeStream) setGranules(pkts []Packet, granule int64) {
+	last := len(pkts) - 1
+	if pkts[last].Granule == -1 {
+		if granule == -1 {
+			granule = s.granule
+		}
+		pkts[last].Granule = granule
+	}
+	for i := range pkts {
+		if pkts[i].Granule == -1 && ClassifyPacket(s.codec, s.n+i, pkts[i].Data) != PacketData {
+			pkts[i].Granule = 0
+		}
+	}
+
+	if s.codec == CodecOpus {
+		for i := last - 1; i >= 0; i-- {
+			if pkts[i].Granule != -1 {
+				continue
+			}
+			next := pkts[i+1]
+			if samples, err := opusSamples(next.Data); err == nil && next.Granule >= int64(samples) {
+				pkts[i].Granule = next.Granule - int64(samples)
+			}
+		}
+	}
+
+	prev := s.granule
+	for i := range pkts {
+		if pkts[i].Granule == -1 {
+			j := i + 1
+			for pkts[j].Granule == -1 {
+				j++
+			}
+			pkts[i].Granule = prev + scale(pkts[j].Granule-prev, 1, int64(j-i+1))
+		}
+		prev = pkts[i].Granule
+	}
+}
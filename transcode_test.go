@@ -0,0 +1,150 @@
+package ogg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestTranscodeIdentity(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(3, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.Encode(10, [][]byte{[]byte("a"), bytes.Repeat([]byte("b"), 1000), []byte("c")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := e.EncodeEOS(20, [][]byte{[]byte("d")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	var out bytes.Buffer
+	err := Transcode(bytes.NewReader(b.Bytes()), &out, func(p Packet) ([]Packet, error) {
+		return []Packet{p}, nil
+	})
+	if err != nil {
+		t.Fatal("unexpected Transcode error:", err)
+	}
+	if !bytes.Equal(out.Bytes(), b.Bytes()) {
+		t.Fatal("expected the stream to be copied unchanged")
+	}
+}
+
+func TestTranscodeSplit(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(3, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.Encode(40, [][]byte{[]byte("aa"), []byte("bb")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := e.EncodeEOS(80, [][]byte{[]byte("cc"), []byte("dd")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	// Split each data packet in two, leaving their positions to be interpolated.
+	var out bytes.Buffer
+	err := Transcode(bytes.NewReader(b.Bytes()), &out, func(p Packet) ([]Packet, error) {
+		if p.BOS {
+			return []Packet{p}, nil
+		}
+		return []Packet{{Data: p.Data[:1], Granule: -1}, {Data: p.Data[1:], Granule: -1}}, nil
+	})
+	if err != nil {
+		t.Fatal("unexpected Transcode error:", err)
+	}
+
+	d := NewDecoder(&out)
+	d.Conformance = ConformanceStrict
+	var got []string
+	var granules []int64
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		for _, pkt := range p.Packets {
+			got = append(got, string(pkt))
+		}
+		granules = append(granules, p.Granule)
+		if p.Type&EOS != 0 != (len(granules) == 3) {
+			t.Fatal("expected only the last page to be an EOS page")
+		}
+	}
+	want := []string{"head", "a", "a", "b", "b", "c", "c", "d", "d"}
+	if len(got) != len(want) {
+		t.Fatalf("expected packets %q, got %q", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected packets %q, got %q", want, got)
+		}
+	}
+	if len(granules) != 3 || granules[0] != 0 || granules[1] != 40 || granules[2] != 80 {
+		t.Fatal("expected granule positions 0, 40, 80, got", granules)
+	}
+}
+
+func TestTranscodeOpusGranules(t *testing.T) {
+	// 20 ms packets, large enough that the pages end after each.
+	pkt := append([]byte{0x08}, bytes.Repeat([]byte{0}, 60000)...)
+	in := opusFile(t, 312, opusTagsPacket("enc"), pkt, pkt)
+
+	// Merge the two audio pages' packets into one page's worth.
+	var held []Packet
+	var out bytes.Buffer
+	err := Transcode(bytes.NewReader(in), &out, func(p Packet) ([]Packet, error) {
+		if p.Granule > 0 && !p.EOS {
+			held = append(held, Packet{Data: p.Data, Granule: -1})
+			return nil, nil
+		}
+		p.Granule = -1
+		return append(held, p), nil
+	})
+	if err != nil {
+		t.Fatal("unexpected Transcode error:", err)
+	}
+
+	d := NewDecoder(&out)
+	var granules []int64
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		granules = append(granules, p.Granule)
+	}
+	// The first audio packet ends on the first page, and is counted back from the second's end.
+	want := []int64{0, 0, 960, 1920}
+	if len(granules) != len(want) {
+		t.Fatalf("expected granule positions %v, got %v", want, granules)
+	}
+	for i := range want {
+		if granules[i] != want[i] {
+			t.Fatalf("expected granule positions %v, got %v", want, granules)
+		}
+	}
+}
+
+func TestTranscodeError(t *testing.T) {
+	in := opusFile(t, 0, opusTagsPacket("enc"), []byte{0x08})
+	errTransform := errors.New("transform failed")
+	err := Transcode(bytes.NewReader(in), io.Discard, func(p Packet) ([]Packet, error) {
+		if p.EOS {
+			return nil, errTransform
+		}
+		return []Packet{p}, nil
+	})
+	if err != errTransform {
+		t.Fatal("expected the transform's error, got", err)
+	}
+}
@@ -0,0 +1,70 @@
+package ogg
+
+import (
+	"errors"
+	"io"
+	"math"
+)
+
+// Transmux decodes the ogg stream in r and re-encodes it to w, page by page,
+// for any number of logical streams, multiplexed or chained.
+// Each page keeps its logical stream, type flags, granule position, and sequence number,
+// and the packets it holds, including any continued from the previous page
+// and any left unfinished for the next, so a conformant stream is copied byte for byte.
+func Transmux(r io.Reader, w io.Writer) error {
+	d := NewDecoder(r)
+	encoders := make(map[uint32]*Encoder)
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		e := encoders[p.Serial]
+		if e == nil || p.Type&BOS != 0 {
+			e = NewEncoder(p.Serial, w)
+			encoders[p.Serial] = e
+		}
+		e.SetSequence(p.Sequence)
+		if err := e.EncodePage(p); err != nil {
+			return err
+		}
+	}
+}
+
+// ErrGranuleRange is the error used by OffsetGranules when a granule position would leave
+// the range of valid positions: less than 0, or more than the largest int64.
+var ErrGranuleRange = errors.New("granule position out of range")
+
+// OffsetGranules copies the pages decoded by d to e, adding delta to each granule position
+// other than -1, so as to shift the stream in time.
+// The pages are otherwise copied as they are, with only their CRCs recomputed,
+// so they keep their logical streams and sequence numbers.
+// It sets d.KeepRawPage, and stops at the end of d's stream or at the first error.
+func OffsetGranules(d *Decoder, e *Encoder, delta int64) error {
+	d.KeepRawPage = true
+	for {
+		p, _, err := d.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if p.Granule != -1 {
+			if delta > 0 && p.Granule > math.MaxInt64-delta || p.Granule+delta < 0 {
+				return ErrGranuleRange
+			}
+			byteOrder.PutUint64(p.Raw[6:14], uint64(p.Granule+delta))
+			byteOrder.PutUint32(p.Raw[22:26], 0)
+			byteOrder.PutUint32(p.Raw[22:26], crc32(p.Raw))
+		}
+		if err := e.WriteRawPage(p.Raw); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestTransmux(t *testing.T) {
+	var b bytes.Buffer
+	a := NewEncoder(1, &b)
+	v := NewEncoder(2, &b)
+	if err := a.EncodeBOS(0, [][]byte{[]byte("head a")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := v.EncodeBOS(0, [][]byte{[]byte("head v")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	// packets continued across pages, including one ending exactly on a page
+	if err := a.Encode(1, [][]byte{make([]byte, 3*mps), make([]byte, mps), []byte("x")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := v.Encode(-1, [][]byte{make([]byte, 2*mps-mss)}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	v.SetSequence(10)
+	if err := v.EncodeEOS(2, nil); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+	if err := a.EncodeEOS(2, [][]byte{[]byte("a")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+	// a chained link reusing a serial
+	c := NewEncoder(1, &b)
+	if err := c.EncodeBOS(0, [][]byte{[]byte("head c")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := c.EncodeEOS(1, [][]byte{[]byte("c")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	// Split pages with an unfinished packet at the end by hand,
+	// as another muxer might: one page of 255 255-byte segments, then its continuation.
+	var in bytes.Buffer
+	in.Write(b.Bytes())
+	raw := NewEncoder(3, &in)
+	if err := raw.EncodePage(Page{Type: BOS, Packets: [][]byte{[]byte("head r")}}); err != nil {
+		t.Fatal("unexpected EncodePage error:", err)
+	}
+	if err := raw.EncodePage(Page{Granule: -1, Packets: [][]byte{[]byte("r"), make([]byte, 254*mss)}, Unfinished: true}); err != nil {
+		t.Fatal("unexpected EncodePage error:", err)
+	}
+	if err := raw.EncodePage(Page{Type: COP | EOS, Granule: 1, Packets: [][]byte{[]byte("rest")}}); err != nil {
+		t.Fatal("unexpected EncodePage error:", err)
+	}
+
+	var out bytes.Buffer
+	if err := Transmux(bytes.NewReader(in.Bytes()), &out); err != nil {
+		t.Fatal("unexpected Transmux error:", err)
+	}
+	if !bytes.Equal(out.Bytes(), in.Bytes()) {
+		t.Fatal("transmuxed stream differs from the original")
+	}
+
+	// The unfinished packet is reassembled.
+	pd := NewDecoder(bytes.NewReader(out.Bytes()))
+	var last Packet
+	for {
+		pkt, err := pd.DecodePacket()
+		if err != nil {
+			break
+		}
+		last = pkt
+	}
+	if last.Serial != 3 || len(last.Data) != 254*mss+4 || !last.EOS {
+		t.Fatalf("unexpected last packet: serial %d, %d bytes", last.Serial, len(last.Data))
+	}
+}
+
+func TestOffsetGranules(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(1, &b)
+	if err := e.EncodeBOS(0, [][]byte{[]byte("head")}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.Encode(-1, [][]byte{[]byte("a")}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := e.EncodeEOS(10, [][]byte{[]byte("b")}); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	var out bytes.Buffer
+	err := OffsetGranules(NewDecoder(bytes.NewReader(b.Bytes())), NewEncoder(1, &out), 1000)
+	if err != nil {
+		t.Fatal("unexpected OffsetGranules error:", err)
+	}
+
+	expected := []int64{1000, -1, 1010}
+	d := NewDecoder(&out)
+	for i, want := range expected {
+		p, _, err := d.Decode()
+		if err != nil {
+			t.Fatal("unexpected Decode error:", err)
+		}
+		if p.Granule != want || p.Sequence != uint32(i) {
+			t.Fatalf("page %d: expected granule %d, got %d", i, want, p.Granule)
+		}
+	}
+
+	err = OffsetGranules(NewDecoder(bytes.NewReader(b.Bytes())), NewEncoder(1, io.Discard), math.MaxInt64)
+	if err != ErrGranuleRange {
+		t.Fatal("expected ErrGranuleRange, got", err)
+	}
+	err = OffsetGranules(NewDecoder(bytes.NewReader(b.Bytes())), NewEncoder(1, io.Discard), -1)
+	if err != ErrGranuleRange {
+		t.Fatal("expected ErrGranuleRange, got", err)
+	}
+}
@@ -0,0 +1,321 @@
+package ogg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"time"
+)
+
+// VorbisID is the identification header of a Vorbis stream,
+// as defined in section 4.2.2 of the Vorbis I specification.
+type VorbisID struct {
+	Version    uint32
+	Channels   byte
+	SampleRate uint32
+	// Bitrate hints, in bits per second; zero when unset.
+	BitrateMax     int32
+	BitrateNominal int32
+	BitrateMin     int32
+	// The short and long block sizes, in samples.
+	Blocksize0 int
+	Blocksize1 int
+}
+
+var (
+	vorbisIDMagic      = []byte("\x01vorbis")
+	vorbisCommentMagic = []byte("\x03vorbis")
+	vorbisSetupMagic   = []byte("\x05vorbis")
+)
+
+// ErrBadVorbisHeader is the error used when a Vorbis header packet is malformed.
+var ErrBadVorbisHeader = errors.New("malformed vorbis header")
+
+// ParseVorbisID parses the identification header packet of a Vorbis stream.
+func ParseVorbisID(pkt []byte) (VorbisID, error) {
+	if len(pkt) < 30 || !bytes.HasPrefix(pkt, vorbisIDMagic) {
+		return VorbisID{}, ErrBadVorbisHeader
+	}
+
+	id := VorbisID{
+		Version:        byteOrder.Uint32(pkt[7:]),
+		Channels:       pkt[11],
+		SampleRate:     byteOrder.Uint32(pkt[12:]),
+		BitrateMax:     int32(byteOrder.Uint32(pkt[16:])),
+		BitrateNominal: int32(byteOrder.Uint32(pkt[20:])),
+		BitrateMin:     int32(byteOrder.Uint32(pkt[24:])),
+		Blocksize0:     1 << (pkt[28] & 0x0f),
+		Blocksize1:     1 << (pkt[28] >> 4),
+	}
+
+	if id.Version != 0 || id.Channels == 0 || id.SampleRate == 0 ||
+		id.Blocksize0 < 64 || id.Blocksize0 > id.Blocksize1 || id.Blocksize1 > 8192 ||
+		pkt[29]&1 == 0 {
+		return VorbisID{}, ErrBadVorbisHeader
+	}
+	return id, nil
+}
+
+// ParseVorbisComment parses the comment header packet of a Vorbis stream.
+func ParseVorbisComment(pkt []byte) (vendor string, comments map[string][]string, err error) {
+	if !bytes.HasPrefix(pkt, vorbisCommentMagic) {
+		return "", nil, ErrBadVorbisHeader
+	}
+	return ParseComments(pkt[len(vorbisCommentMagic):])
+}
+
+// vorbisModes returns the block flag of each mode in a Vorbis setup header.
+//
+// The modes are the last thing in the setup header, but finding them from the front
+// means decoding the codebooks, floors, residues, and mappings that precede them.
+// Instead, as libavcodec does, read the header backward from its framing bit:
+// each mode is 41 bits whose window and transform types must be zero, and the
+// mode count precedes them. Keep the longest run of modes whose count matches.
+func vorbisModes(pkt []byte) ([]bool, error) {
+	if !bytes.HasPrefix(pkt, vorbisSetupMagic) {
+		return nil, ErrBadVorbisHeader
+	}
+
+	r := revBits{b: pkt[len(vorbisSetupMagic):]}
+	for r.left() > 97 && r.read(1) == 0 {
+	}
+	if r.left() <= 97 {
+		return nil, ErrBadVorbisHeader
+	}
+	start := r.pos
+
+	count, found := 0, 0
+	for r.left() >= 97 {
+		if r.read(8) > 63 || r.read(16) != 0 || r.read(16) != 0 {
+			break
+		}
+		r.read(1)
+		count++
+		if count > 64 {
+			break
+		}
+		peek := r
+		if int(peek.read(6))+1 == count {
+			found = count
+		}
+	}
+	if found == 0 {
+		return nil, ErrBadVorbisHeader
+	}
+
+	r.pos = start
+	flags := make([]bool, found)
+	for i := found - 1; i >= 0; i-- {
+		r.read(40)
+		flags[i] = r.read(1) == 1
+	}
+	return flags, nil
+}
+
+// revBits reads a Vorbis (LSB-first) bitstream backward from its end.
+// Each field read this way comes out with its bits in their usual order.
+type revBits struct {
+	b   []byte
+	pos int // bits read so far, from the end
+}
+
+func (r *revBits) left() int {
+	return len(r.b)*8 - r.pos
+}
+
+func (r *revBits) read(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		idx := len(r.b)*8 - 1 - r.pos
+		r.pos++
+		v = v<<1 | uint32(r.b[idx/8]>>(idx%8)&1)
+	}
+	return v
+}
+
+// ilog returns the number of bits needed to represent v, per the Vorbis I specification.
+func ilog(v int) int {
+	n := 0
+	for v > 0 {
+		n++
+		v >>= 1
+	}
+	return n
+}
+
+// A VorbisReader reads the audio packets of a Vorbis stream in ogg,
+// taking care of its headers, pages, and timestamps.
+// If the ogg stream is multiplexed, only its first Vorbis logical stream is read.
+type VorbisReader struct {
+	ID       VorbisID
+	Vendor   string
+	Comments map[string][]string
+
+	g     *GenericReader
+	modes []bool
+
+	// the previous audio packet's block size, or 0 before the first
+	prevBlock int
+	// samples in the packets returned so far, and the offset to apply to
+	// them once known from a granule position
+	samples int64
+	offset  int64
+	synced  bool
+	queue   []vorbisPacket
+
+	// the samples to trim from the end, once the EOS page is read
+	endTrim int64
+}
+
+type vorbisPacket struct {
+	data  []byte
+	start int64 // in samples, before offset is known
+}
+
+// NewVorbisReader creates a VorbisReader, reading the three Vorbis headers from r.
+func NewVorbisReader(r io.Reader) (*VorbisReader, error) {
+	g, pkt, err := openStream(r, func(bos []byte) bool { return IdentifyCodec(bos) == CodecVorbis })
+	if err == errNoMatch {
+		return nil, ErrBadVorbisHeader
+	}
+	if err != nil {
+		return nil, err
+	}
+	v := &VorbisReader{g: g}
+	v.ID, err = ParseVorbisID(pkt.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	pkt, err = g.next()
+	if err != nil {
+		return nil, headerErr(err)
+	}
+	v.Vendor, v.Comments, err = ParseVorbisComment(pkt.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	pkt, err = g.next()
+	if err != nil {
+		return nil, headerErr(err)
+	}
+	v.modes, err = vorbisModes(pkt.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// headerErr converts an EOF while reading headers to ErrBadVorbisHeader.
+func headerErr(err error) error {
+	if err == io.EOF {
+		return ErrBadVorbisHeader
+	}
+	return err
+}
+
+// blocksize returns the block size of an audio packet.
+func (v *VorbisReader) blocksize(pkt []byte) (int, error) {
+	if len(pkt) == 0 || pkt[0]&1 != 0 {
+		return 0, ErrBadVorbisHeader
+	}
+
+	// The mode number follows the packet type bit, LSB first.
+	bits := ilog(len(v.modes) - 1)
+	mode := 0
+	for i := 0; i < bits; i++ {
+		idx := 1 + i
+		if idx/8 >= len(pkt) {
+			return 0, ErrBadVorbisHeader
+		}
+		mode |= int(pkt[idx/8]>>(idx%8)&1) << i
+	}
+	if mode >= len(v.modes) {
+		return 0, ErrBadVorbisHeader
+	}
+
+	if v.modes[mode] {
+		return v.ID.Blocksize1, nil
+	}
+	return v.ID.Blocksize0, nil
+}
+
+// ReadPacket returns the next audio packet and the presentation time of
+// the first sample it produces.
+// Each packet produces a quarter of its own block size plus a quarter of the
+// previous packet's, as the overlapping halves of the two blocks are added;
+// the first packet produces none.
+// These counts are aligned to the stream's granule positions as soon as one is seen,
+// so streams that don't start at zero or that trim their first samples get
+// correct timestamps; these may be negative for trimmed samples.
+// A granule position on the EOS page isn't used for this, since a final position
+// short of the samples trims them from the end, as EndTrim reports.
+// The error is io.EOF after the end of the logical stream.
+func (v *VorbisReader) ReadPacket() (data []byte, timestamp time.Duration, err error) {
+	if len(v.queue) == 0 {
+		if err := v.fill(); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	p := v.queue[0]
+	v.queue = v.queue[1:]
+	ts := time.Duration(p.start+v.offset) * time.Second / time.Duration(v.ID.SampleRate)
+	return p.data, ts, nil
+}
+
+// EndTrim returns the number of samples to discard from the end of the decoded output:
+// the amount by which the samples of the stream's packets exceed its final granule position,
+// as the Vorbis I specification allows of the last page.
+// It is only known once ReadPacket has returned the stream's last packet; until then it is 0.
+func (v *VorbisReader) EndTrim() int {
+	if len(v.queue) > 0 {
+		return 0
+	}
+	return int(v.endTrim)
+}
+
+// fill queues the next audio packet, and aligns sample counts to granule positions
+// if it has one. Until the first granule position is seen, packets stay queued.
+func (v *VorbisReader) fill() error {
+	for {
+		pkt, err := v.g.next()
+		if err == io.EOF && !v.synced && len(v.queue) > 0 {
+			// No granule position to go on; assume the stream starts at zero.
+			v.synced = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		bs, err := v.blocksize(pkt.Data)
+		if err != nil {
+			return err
+		}
+		n := 0
+		if v.prevBlock != 0 {
+			n = (v.prevBlock + bs) / 4
+		}
+		v.prevBlock = bs
+
+		v.queue = append(v.queue, vorbisPacket{pkt.Data, v.samples})
+		v.samples += int64(n)
+
+		if pkt.Granule != -1 {
+			// A short granule position on the EOS page trims the end, not the start.
+			if !v.synced && !pkt.EOS {
+				v.offset = pkt.Granule - v.samples
+			}
+			v.synced = true
+			if pkt.EOS && v.samples+v.offset > pkt.Granule {
+				v.endTrim = v.samples + v.offset - pkt.Granule
+			}
+		}
+		if v.synced {
+			return nil
+		}
+	}
+}
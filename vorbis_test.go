@@ -0,0 +1,170 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// bitWriter packs bits LSB first, as Vorbis does.
+type bitWriter struct {
+	b []byte
+	n int
+}
+
+func (w *bitWriter) write(v uint32, bits int) {
+	for i := 0; i < bits; i++ {
+		if w.n%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		w.b[w.n/8] |= byte(v>>i&1) << (w.n % 8)
+		w.n++
+	}
+}
+
+func vorbisIDPacket(rate uint32, bs0, bs1 byte) []byte {
+	p := append([]byte(nil), vorbisIDMagic...)
+	p = append(p, 0, 0, 0, 0, 2, 0, 0, 0, 0)
+	byteOrder.PutUint32(p[12:], rate)
+	p = append(p, make([]byte, 12)...)
+	return append(p, bs1<<4|bs0, 1)
+}
+
+// vorbisSetupPacket builds a setup header whose contents are junk,
+// except for the trailing modes.
+func vorbisSetupPacket(blockflags ...bool) []byte {
+	w := bitWriter{b: bytes.Repeat([]byte{0xff}, 20), n: 160}
+	w.write(uint32(len(blockflags)-1), 6)
+	for i, f := range blockflags {
+		flag := uint32(0)
+		if f {
+			flag = 1
+		}
+		w.write(flag, 1)
+		w.write(0, 16)
+		w.write(0, 16)
+		w.write(uint32(i), 8)
+	}
+	w.write(1, 1)
+	return append(append([]byte(nil), vorbisSetupMagic...), w.b...)
+}
+
+func TestParseVorbisID(t *testing.T) {
+	id, err := ParseVorbisID(vorbisIDPacket(44100, 8, 11))
+	if err != nil {
+		t.Fatal("unexpected ParseVorbisID error:", err)
+	}
+	if id.Channels != 2 || id.SampleRate != 44100 || id.Blocksize0 != 256 || id.Blocksize1 != 2048 {
+		t.Fatalf("unexpected header: %+v", id)
+	}
+
+	_, err = ParseVorbisID(vorbisIDPacket(44100, 11, 8))
+	if err != ErrBadVorbisHeader {
+		t.Fatal("expected ErrBadVorbisHeader, got:", err)
+	}
+}
+
+func TestVorbisModes(t *testing.T) {
+	expect := []bool{false, true, true, false, true}
+	modes, err := vorbisModes(vorbisSetupPacket(expect...))
+	if err != nil {
+		t.Fatal("unexpected vorbisModes error:", err)
+	}
+	if len(modes) != len(expect) {
+		t.Fatalf("got %d modes, expected %d", len(modes), len(expect))
+	}
+	for i := range expect {
+		if modes[i] != expect[i] {
+			t.Fatalf("mode %d = %v, expected %v", i, modes[i], expect[i])
+		}
+	}
+}
+
+func TestVorbisReader(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(3, &b)
+	if err := e.EncodeBOS(0, [][]byte{vorbisIDPacket(48000, 8, 11)}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	comment := append(append([]byte(nil), vorbisCommentMagic...), commentHeader("v", "TITLE=x")...)
+	if err := e.Encode(0, [][]byte{comment, vorbisSetupPacket(false, true)}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+
+	// Mode 0 is short, mode 1 is long.
+	short, long := []byte{0 << 1}, []byte{1 << 1}
+	packets := [][]byte{short, long, long, short}
+	// Samples produced: 0, (256+2048)/4, (2048+2048)/4, (2048+256)/4 = 2176 in all,
+	// but the final granule position says 2076, so the last 100 are trimmed.
+	if err := e.EncodeEOS(2076, packets); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+
+	r, err := NewVorbisReader(&b)
+	if err != nil {
+		t.Fatal("unexpected NewVorbisReader error:", err)
+	}
+	if r.Vendor != "v" || r.Comments["TITLE"][0] != "x" || r.ID.SampleRate != 48000 {
+		t.Fatalf("unexpected headers: %+v %q %q", r.ID, r.Vendor, r.Comments)
+	}
+
+	expect := []int64{0, 0, 576, 1600}
+	for i, samples := range expect {
+		if r.EndTrim() != 0 {
+			t.Fatal("expected no end trim before the last packet, got", r.EndTrim())
+		}
+		data, ts, err := r.ReadPacket()
+		if err != nil {
+			t.Fatal("unexpected ReadPacket error:", err)
+		}
+		if !bytes.Equal(data, packets[i]) {
+			t.Fatalf("packet %d = %x, expected %x", i, data, packets[i])
+		}
+		want := time.Duration(samples) * time.Second / 48000
+		if ts != want {
+			t.Fatalf("packet %d timestamp = %v, expected %v", i, ts, want)
+		}
+	}
+
+	if r.EndTrim() != 100 {
+		t.Fatal("expected 100 samples trimmed from the end, got", r.EndTrim())
+	}
+
+	_, _, err = r.ReadPacket()
+	if err != io.EOF {
+		t.Fatal("expected EOF, got:", err)
+	}
+
+	// A short granule position before the EOS page trims the start instead.
+	b.Reset()
+	e = NewEncoder(3, &b)
+	if err := e.EncodeBOS(0, [][]byte{vorbisIDPacket(48000, 8, 11)}); err != nil {
+		t.Fatal("unexpected EncodeBOS error:", err)
+	}
+	if err := e.Encode(0, [][]byte{comment, vorbisSetupPacket(false, true)}); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := e.Encode(476, packets[:2]); err != nil {
+		t.Fatal("unexpected Encode error:", err)
+	}
+	if err := e.EncodeEOS(2076, packets[2:]); err != nil {
+		t.Fatal("unexpected EncodeEOS error:", err)
+	}
+	r, err = NewVorbisReader(&b)
+	if err != nil {
+		t.Fatal("unexpected NewVorbisReader error:", err)
+	}
+	for i, samples := range []int64{-100, -100, 476, 1500} {
+		_, ts, err := r.ReadPacket()
+		if err != nil {
+			t.Fatal("unexpected ReadPacket error:", err)
+		}
+		if want := time.Duration(samples) * time.Second / 48000; ts != want {
+			t.Fatalf("packet %d timestamp = %v, expected %v", i, ts, want)
+		}
+	}
+	if r.EndTrim() != 0 {
+		t.Fatal("expected no end trim, got", r.EndTrim())
+	}
+}